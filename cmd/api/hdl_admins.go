@@ -8,6 +8,7 @@ import (
 	"viadro_api/utils"
 
 	"github.com/charmbracelet/log"
+	"github.com/go-playground/validator/v10"
 )
 
 // Grant admin privileges
@@ -19,6 +20,7 @@ import (
 //	@Success      200  {string}  "User activated"
 //	@Failure      400  {string}  "Bad json request"
 //	@Failure      422  {string}  "Invalid or expired token"
+//	@Failure      409  {string}  "Edit conflict"
 //	@Failure      500  {string}  "Internal server error"
 //	@Router       /admin/user/:id [patch]
 func (app *application) adminGrantPrivilegesHandler(w http.ResponseWriter, r *http.Request) {
@@ -43,8 +45,13 @@ func (app *application) adminGrantPrivilegesHandler(w http.ResponseWriter, r *ht
 
 	err = app.data_access.Users.Update(user)
 	if err != nil {
-		log.Error("failed updating user activated field", err) //? http.StatusInternalServerError - 500
-		utils.ServerErrorResponse(w, r, err)
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			utils.EditConflictResponse(w, r) //? http.StatusConflict - 409
+		default:
+			log.Error("failed updating user activated field", err) //? http.StatusInternalServerError - 500
+			utils.ServerErrorResponse(w, r, err)
+		}
 		return
 	}
 
@@ -55,6 +62,74 @@ func (app *application) adminGrantPrivilegesHandler(w http.ResponseWriter, r *ht
 	}
 }
 
+// Set user's upload limit
+//
+//	@Summary      Set user's upload limit
+//	@Description  Set maximum size of single upload for user, null restores application default
+//	@Tags         admin
+//	@Accept       json
+//	@Produce      json
+//	@Success      200  {object}  data.User
+//	@Failure      400  {string}  "Bad json request"
+//	@Failure      404  {string}  "User not found"
+//	@Failure      422  {string}  "Invalid upload limit"
+//	@Failure      409  {string}  "Edit conflict"
+//	@Failure      500  {string}  "Internal server error"
+//	@Router       /admin/user/:id/upload-limit [patch]
+func (app *application) adminSetUploadLimitHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := utils.ReadIDParam(r)
+	if err != nil {
+		utils.NotFoundResponse(w, r) //? http.StatusNotFound - 404
+		return
+	}
+
+	input := struct {
+		Max_upload_size *int64 `validate:"omitempty,gt=0" json:"max_upload_size"`
+	}{}
+
+	err = utils.ReadJSON(w, r, &input)
+	if err != nil {
+		utils.BadRequestResponse(w, r, err) //? http.StatusBadRequest - 400
+		return
+	}
+
+	validate := validator.New()
+	err = validate.Struct(input)
+	if err != nil {
+		utils.FailedValidationResponseValidator(w, r, err) //? http.StatusUnprocessableEntity - 422
+		return
+	}
+
+	user, err := app.data_access.Users.GetById(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			utils.NotFoundResponse(w, r) //? http.StatusNotFound - 404
+		default:
+			utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+		}
+		return
+	}
+
+	user.Max_upload_size = input.Max_upload_size
+
+	err = app.data_access.Users.Update(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			utils.EditConflictResponse(w, r) //? http.StatusConflict - 409
+		default:
+			utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+		}
+		return
+	}
+
+	err = utils.WriteJSON(w, http.StatusOK, utils.Wrap{"user": user}, nil)
+	if err != nil {
+		utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+	}
+}
+
 // Get all users
 //
 //	@Summary      Get all users
@@ -127,7 +202,7 @@ func (app *application) adminGetAllDocumentsHandler(w http.ResponseWriter, r *ht
 			ID:          document.Document_id,
 			User_id:     document.User_id,
 			Title:       document.Title,
-			Link:        document.Url_s3,
+			Link:        downloadLink(document.Document_id),
 			Tags:        document.Tags,
 			Uploaded_at: document.Uploaded_at,
 			Is_hidden:   document.Is_hidden,
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"viadro_api/internal/data"
+	"viadro_api/utils"
+
+	"github.com/charmbracelet/log"
+	"github.com/go-playground/validator/v10"
+)
+
+const bulkLimit = 1000
+
+type bulkResult struct {
+	Document_id int    `json:"document_id"`
+	Ok          bool   `json:"ok"`
+	Error       string `json:"error,omitempty"`
+}
+
+// documentSelection selects documents for bulk operations and exports, either explicitly by ids
+// or by title and tags filter over current user's own documents.
+type documentSelection struct {
+	Ids    []int `validate:"omitempty,max=1000,dive,gt=0" json:"ids"`
+	Filter *struct {
+		Title string   `json:"title"`
+		Tags  []string `json:"tags"`
+	} `json:"filter"`
+}
+
+// resolveSelection returns ids of selected documents, writes error response and returns false when selection can't be used.
+func (app *application) resolveSelection(w http.ResponseWriter, r *http.Request, selection documentSelection) ([]int, bool) {
+	if (len(selection.Ids) == 0) == (selection.Filter == nil) {
+		utils.FailedValidationResponse(w, r, map[string]string{"ids": "either ids or filter must be provided"}) //? http.StatusUnprocessableEntity - 422
+		return nil, false
+	}
+
+	if selection.Filter == nil {
+		return selection.Ids, true
+	}
+
+	tags := selection.Filter.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+
+	user := app.contextGetUser(r)
+
+	//? one more than the limit is fetched, selection which doesn't fit is refused rather than silently cut
+	ids, err := app.data_access.Documents.FindIDs(selection.Filter.Title, tags, user.User_id, bulkLimit+1)
+	if err != nil {
+		utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+		return nil, false
+	}
+
+	if len(ids) > bulkLimit {
+		utils.FailedValidationResponse(w, r, map[string]string{"filter": fmt.Sprintf("matches more than %d documents, narrow it down", bulkLimit)}) //? http.StatusUnprocessableEntity - 422
+		return nil, false
+	}
+
+	return ids, true
+}
+
+// authorizeSelection fetches selected documents and authorizes user for access to each of them. Results report every
+// requested id once and in order, returned documents are the allowed ones. Optional check rejects otherwise allowed
+// document for the reason it returns.
+func (app *application) authorizeSelection(user *data.User, ids []int, access documentAccess, check func(document *data.Document) string) ([]*data.Document, []bulkResult, error) {
+	documents, err := app.data_access.Documents.GetMany(ids)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	found := map[int]*data.Document{}
+	for i := range documents {
+		found[documents[i].Document_id] = &documents[i]
+	}
+
+	allowed := []*data.Document{}
+	results := []bulkResult{}
+	seen := map[int]bool{}
+
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		document, ok := found[id]
+		if !ok {
+			results = append(results, bulkResult{Document_id: id, Error: "not found"})
+			continue
+		}
+
+		permitted, err := app.authorizeDocument(user, document, access)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !permitted {
+			results = append(results, bulkResult{Document_id: id, Error: "forbidden"})
+			continue
+		}
+
+		if check != nil {
+			reason := check(document)
+			if reason != "" {
+				results = append(results, bulkResult{Document_id: id, Error: reason})
+				continue
+			}
+		}
+
+		allowed = append(allowed, document)
+		results = append(results, bulkResult{Document_id: id, Ok: true})
+	}
+
+	return allowed, results, nil
+}
+
+// Bulk document operation
+//
+//	@Summary      Bulk document operation
+//	@Description  Delete, hide, unhide, add-tags, remove-tags or move-to-folder many documents at once, selected by ids or by title and tags filter over own documents (up to 1000, filter matching more is refused). Every document is authorized separately and reported in results, allowed ones are changed in a single statement
+//	@Tags         document
+//	@Accept       json
+//	@Produce      json
+//	@Success      200  {string}  "Per-document results"
+//	@Failure      400  {string}  "Bad json request"
+//	@Failure      401  {string}  "Unauthorized"
+//	@Failure      422  {string}  "Invalid action, selection or arguments"
+//	@Failure      500  {string}  "Internal server error"
+//	@Router       /documents/bulk [post]
+func (app *application) documentBulkHandler(w http.ResponseWriter, r *http.Request) {
+	input := struct {
+		documentSelection
+		Action    string   `validate:"required,oneof=delete hide unhide add-tags remove-tags move-to-folder" json:"action"`
+		Tags      []string `validate:"required_if=Action add-tags,required_if=Action remove-tags" json:"tags"`
+		Folder_id *int     `validate:"required_if=Action move-to-folder,omitempty,gte=0" json:"folder_id"`
+	}{}
+
+	err := utils.ReadJSON(w, r, &input)
+	if err != nil {
+		utils.BadRequestResponse(w, r, err) //? http.StatusBadRequest - 400
+		return
+	}
+
+	validate := validator.New()
+	err = validate.Struct(input)
+	if err != nil {
+		utils.FailedValidationResponseValidator(w, r, err) //? http.StatusUnprocessableEntity - 422
+		return
+	}
+
+	ids, ok := app.resolveSelection(w, r, input.documentSelection)
+	if !ok {
+		return
+	}
+
+	//? target folder is checked once, per document it then has to belong to document's owner
+	var folder *data.Folder
+	var check func(document *data.Document) string
+	if input.Action == "move-to-folder" && *input.Folder_id != 0 {
+		folder, err = app.data_access.Folders.Get(*input.Folder_id)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				utils.FailedValidationResponse(w, r, map[string]string{"folder_id": "folder does not exist"}) //? http.StatusUnprocessableEntity - 422
+			default:
+				utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+			}
+			return
+		}
+
+		check = func(document *data.Document) string {
+			if folder.User_id != document.User_id {
+				return "folder belongs to another user"
+			}
+			return ""
+		}
+	}
+
+	access := accessManage
+	if input.Action == "add-tags" || input.Action == "remove-tags" {
+		access = accessEdit
+	}
+
+	user := app.contextGetUser(r)
+
+	documents, results, err := app.authorizeSelection(user, ids, access, check)
+	if err != nil {
+		utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+		return
+	}
+
+	allowed := []int{}
+	for _, document := range documents {
+		allowed = append(allowed, document.Document_id)
+	}
+
+	updated := []int{}
+	if len(allowed) > 0 {
+		switch input.Action {
+		case "delete":
+			updated, err = app.data_access.Documents.TrashMany(allowed)
+		case "hide":
+			updated, err = app.data_access.Documents.SetHiddenMany(allowed, true)
+		case "unhide":
+			updated, err = app.data_access.Documents.SetHiddenMany(allowed, false)
+		case "add-tags":
+			updated, err = app.data_access.Documents.AddTagsMany(allowed, input.Tags)
+		case "remove-tags":
+			updated, err = app.data_access.Documents.RemoveTagsMany(allowed, input.Tags)
+		case "move-to-folder":
+			if folder == nil {
+				updated, err = app.data_access.Documents.MoveMany(allowed, nil)
+			} else {
+				updated, err = app.data_access.Documents.MoveMany(allowed, &folder.Folder_id)
+			}
+		}
+		if err != nil {
+			utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+			return
+		}
+	}
+
+	//? documents deleted between the read and the update are reported as not found
+	changed := map[int]bool{}
+	for _, id := range updated {
+		changed[id] = true
+	}
+
+	succeeded := 0
+	for i := range results {
+		if results[i].Ok && !changed[results[i].Document_id] {
+			results[i].Ok = false
+			results[i].Error = "not found"
+		}
+		if results[i].Ok {
+			succeeded++
+		}
+	}
+
+	err = utils.WriteJSON(w, http.StatusOK, utils.Wrap{"action": input.Action, "succeeded": succeeded, "failed": len(results) - succeeded, "results": results}, nil)
+	if err != nil {
+		utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+	}
+
+	if succeeded > 0 {
+		err = app.redis_client.FlushAll(context.TODO()).Err()
+		if err != nil {
+			log.Error("Failed flushing cache", err)
+		}
+	}
+}
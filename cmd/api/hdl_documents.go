@@ -1,33 +1,324 @@
 package main
 
 import (
+	"bufio"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"io"
+	"mime"
 	"net/http"
 	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"viadro_api/internal/data"
+	"viadro_api/internal/pdf"
+	"viadro_api/internal/storage"
 	"viadro_api/utils"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/charmbracelet/log"
+	"github.com/go-playground/validator/v10"
 )
 
 var (
 	ErrRecordNotFound = errors.New("record not found")
 )
 
+func (app *application) uploadLimit(user *data.User) int64 {
+	if user.Max_upload_size != nil {
+		return *user.Max_upload_size
+	}
+
+	return app.settings.Max_upload_size
+}
+
+// downloadLink is the only link to document's content exposed to clients, objects themselves are private.
+func downloadLink(document_id int) string {
+	return fmt.Sprintf("/v1/document/%d/download", document_id)
+}
+
+// previewLink points to preview of document's first page, nil while it isn't generated or when there is none.
+func previewLink(document *data.Document) *string {
+	if document.Preview_key == nil || *document.Preview_key == "" {
+		return nil
+	}
+
+	link := fmt.Sprintf("/v1/document/%d/preview", document.Document_id)
+	return &link
+}
+
+// previewFor links preview of document for user. Previews aren't stamped, so it is withheld from those
+// whose downloads are watermarked.
+func (app *application) previewFor(user *data.User, document *data.Document) (*string, error) {
+	watermark, err := app.watermarkFor(user, document)
+	if err != nil || watermark != nil {
+		return nil, err
+	}
+
+	return previewLink(document), nil
+}
+
+// sendBlob redirects to short-lived link to blob which is downloaded as a file with given name. Blobs storage can't
+// link to (encrypted ones) are decrypted and streamed through the API instead.
+func (app *application) sendBlob(w http.ResponseWriter, r *http.Request, storage_key string, filename string, content_type string) {
+	link, err := app.presignBlob(r.Context(), storage_key, filename, content_type)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrNotPresignable):
+			w.Header().Set("Cache-Control", "no-store")
+			app.streamBlob(w, r, storage_key, filename, content_type, "inline", time.Time{})
+		default:
+			utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+		}
+		return
+	}
+
+	redirectBlob(w, r, link)
+}
+
+// presignBlob returns short-lived link to blob downloaded as a file with given name, storage.ErrNotPresignable
+// when blob has to be streamed through the API.
+func (app *application) presignBlob(ctx context.Context, storage_key string, filename string, content_type string) (string, error) {
+	return app.storage.PresignGet(ctx, storage_key, app.settings.Download_url_ttl, storage.PresignOptions{
+		Content_type:        content_type,
+		Content_disposition: contentDisposition(filename),
+	})
+}
+
+func redirectBlob(w http.ResponseWriter, r *http.Request, link string) {
+	w.Header().Set("Cache-Control", "no-store")
+	http.Redirect(w, r, link, http.StatusFound) //? http.StatusFound - 302
+}
+
+// streamBlob serves blob through the API with support for ranges and conditional requests, validators
+// like ETag are left to the caller.
+func (app *application) streamBlob(w http.ResponseWriter, r *http.Request, storage_key string, filename string, content_type string, disposition string, modified time.Time) {
+	info, err := app.storage.Stat(r.Context(), storage_key)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrObjectNotFound):
+			utils.NotFoundResponse(w, r) //? http.StatusNotFound - 404
+		default:
+			utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+		}
+		return
+	}
+
+	//? transfers of large files take longer than server-wide write timeout allows
+	controller := http.NewResponseController(w)
+	err = controller.SetWriteDeadline(time.Now().Add(app.settings.Upload_timeout))
+	if err != nil {
+		log.Error("failed extending download write deadline", err)
+	}
+
+	blob := storage.NewRangeReader(r.Context(), app.storage, storage_key, info.Size)
+	defer blob.Close()
+
+	w.Header().Set("Content-Type", content_type)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": filename}))
+
+	//? ServeContent handles Range, If-Range, If-None-Match and If-Modified-Since
+	http.ServeContent(w, r, filename, modified, blob)
+}
+
+// contentETag identifies document's content rather than its metadata, blobs are never modified
+// so checksum (or storage key for blobs stored before checksums) is a strong validator.
+func contentETag(document *data.Document) string {
+	if document.Checksum != nil {
+		return `"` + *document.Checksum + `"`
+	}
+
+	key_hash := sha256.Sum256([]byte(document.Storage_key))
+	return `"` + hex.EncodeToString(key_hash[:]) + `"`
+}
+
+func contentDisposition(filename string) string {
+	return mime.FormatMediaType("inline", map[string]string{"filename": filename})
+}
+
+// storeBlob registers object just stored under storage_key, when the same content is already stored
+// the existing blob is returned instead and the duplicate object is deleted.
+func (app *application) storeBlob(storage_key string, location string, checksum string) (*data.Blob, error) {
+	blob := &data.Blob{
+		Storage_key: storage_key,
+		Checksum:    &checksum,
+		Location:    location,
+	}
+
+	err := app.data_access.Blobs.Acquire(blob)
+	if err != nil {
+		delete_err := app.storage.Delete(context.TODO(), storage_key)
+		if delete_err != nil {
+			log.Error("failed deleting unregistered object", delete_err)
+		}
+		return nil, err
+	}
+
+	if blob.Storage_key != storage_key {
+		err = app.storage.Delete(context.TODO(), storage_key)
+		if err != nil {
+			log.Error("failed deleting duplicate object", err)
+		}
+	}
+
+	return blob, nil
+}
+
+// releaseBlob drops a reference to blob and deletes the object once nothing points to it anymore.
+func (app *application) releaseBlob(storage_key string) {
+	last, err := app.data_access.Blobs.Release(storage_key)
+	if err != nil {
+		log.Error("failed releasing blob", err)
+		return
+	}
+
+	if last {
+		err = app.storage.Delete(context.TODO(), storage_key)
+		if err != nil {
+			log.Error("failed deleting blob object", err)
+		}
+
+		err = app.storage.Delete(context.TODO(), storage.PreviewKey(storage_key))
+		if err != nil && !errors.Is(err, storage.ErrObjectNotFound) {
+			log.Error("failed deleting blob preview", err)
+		}
+	}
+}
+
+// purgeDocument permanently deletes document with its revisions and releases their blobs, ErrEditConflict means
+// document was changed since it was read.
+func (app *application) purgeDocument(document *data.Document) error {
+	versions, err := app.data_access.Versions.GetAll(document.Document_id)
+	if err != nil {
+		return err
+	}
+
+	//? row goes first, so a concurrent edit can't leave a document pointing at deleted object
+	err = app.data_access.Documents.Delete(document.Document_id, document.Version)
+	if err != nil {
+		return err
+	}
+
+	app.releaseBlob(document.Storage_key)
+	for _, version := range versions {
+		app.releaseBlob(version.Storage_key)
+	}
+
+	return nil
+}
+
+// acceptBlob fetches just stored blob and reads its metadata, the blob is deleted again when it can't be accepted.
+// Local copy of the blob is returned for background processing, it has to be released with removeTemp.
+func (app *application) acceptBlob(storage_key string, filetype string) (data.FileMetadata, *os.File, error) {
+	file, size, err := app.fetchTemp(storage_key)
+	if err != nil {
+		return data.FileMetadata{}, nil, err
+	}
+
+	metadata, err := inspectFile(file, size, filetype)
+	if err != nil {
+		removeTemp(file)
+		app.rejectBlob(storage_key)
+		return metadata, nil, err
+	}
+
+	return metadata, file, nil
+}
+
+// rejectBlob deletes just stored blob which can't be accepted.
+func (app *application) rejectBlob(storage_key string) {
+	err := app.storage.Delete(context.TODO(), storage_key)
+	if err != nil {
+		log.Error("failed deleting rejected upload", err)
+	}
+}
+
+// inspectUpload accepts blob assembled from resumable upload. Error response is written and false returned
+// when upload can't be accepted, local copy of accepted blob is returned like from acceptBlob.
+func (app *application) inspectUpload(w http.ResponseWriter, r *http.Request, storage_key string, filetype string) (data.FileMetadata, *os.File, bool) {
+	metadata, file, err := app.acceptBlob(storage_key, filetype)
+	if err != nil {
+		switch {
+		case errors.Is(err, pdf.ErrMalformed):
+			utils.FailedValidationResponse(w, r, map[string]string{"file": "malformed PDF, the file can't be read"}) //? http.StatusUnprocessableEntity - 422
+		default:
+			utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+		}
+		return metadata, nil, false
+	}
+
+	return metadata, file, true
+}
+
+// storeFile streams file into storage as a new blob of user, the blob is inspected and registered like every upload.
+// Malformed PDF is rejected with pdf.ErrMalformed and nothing is kept, filename is offered when blob is downloaded.
+// Local copy of the blob written while streaming is returned for background processing, it has to be released
+// with removeTemp.
+func (app *application) storeFile(user_id int, file io.Reader, filename string, filetype string) (*data.Blob, data.FileMetadata, *os.File, error) {
+	storage_key, err := storage.NewKey(user_id)
+	if err != nil {
+		return nil, data.FileMetadata{}, nil, err
+	}
+
+	local, err := os.CreateTemp("", "viadro-blob-*")
+	if err != nil {
+		return nil, data.FileMetadata{}, nil, err
+	}
+
+	//? checksum and local copy are written while streaming, identical content is then stored only once
+	//? and the blob isn't fetched back to be inspected
+	hash := sha256.New()
+
+	location, err := app.storage.Put(context.TODO(), storage_key, io.TeeReader(file, io.MultiWriter(hash, local)), storage.PutOptions{
+		Content_type:        filetype,
+		Content_disposition: contentDisposition(filename),
+	})
+	if err != nil {
+		removeTemp(local)
+		return nil, data.FileMetadata{}, nil, err
+	}
+
+	size, err := local.Seek(0, io.SeekCurrent)
+	if err != nil {
+		removeTemp(local)
+		app.rejectBlob(storage_key)
+		return nil, data.FileMetadata{}, nil, err
+	}
+
+	metadata, err := inspectFile(local, size, filetype)
+	if err != nil {
+		removeTemp(local)
+		app.rejectBlob(storage_key)
+		return nil, metadata, nil, err
+	}
+
+	blob, err := app.storeBlob(storage_key, location, hex.EncodeToString(hash.Sum(nil)))
+	if err != nil {
+		removeTemp(local)
+		return nil, metadata, nil, err
+	}
+
+	return blob, metadata, local, nil
+}
+
+func isFileTooLarge(err error) bool {
+	var max_bytes_error *http.MaxBytesError
+
+	return errors.Is(err, utils.ErrFileTooLarge) || errors.As(err, &max_bytes_error)
+}
+
 // List all visible (public) documents
 //
 //	@Summary      List all visible (public) documents
-//	@Description  List all visible (public) documents
+//	@Description  List all visible (public) documents, owner=me lists own documents, owner=-me excludes them and owner=shared lists documents shared with current user. q searches title and content of documents (quoted phrases, OR and -word are supported), results are then sorted by relevance and carry snippets with matches wrapped in <mark> tags. min_pages, max_pages, min_size and max_size (in bytes) narrow results down by file metadata, encrypted by encryption of PDFs, results can be sorted by size and page_count
 //	@Tags         document
 //	@Produce      json
 //	@Success      200  {object}   data.Document
+//	@Failure      422  {string}  "Invalid sort or metadata filter"
 //	@Failure      500  {string}  "Internal server error"
 //	@Router       /documents [get]
 func (app *application) documentGetAllHandler(w http.ResponseWriter, r *http.Request) {
@@ -53,10 +344,13 @@ func (app *application) documentGetAllHandler(w http.ResponseWriter, r *http.Req
 	}
 
 	input := struct {
-		Title string
-		Tags  []string
-		Owner *int
-		Flag  *int
+		Title    string
+		Search   string
+		Tags     []string
+		Owner    *int
+		Flag     *int
+		Shared   *int
+		Metadata data.MetadataFilters
 		data.Filters
 	}{}
 
@@ -67,16 +361,56 @@ func (app *application) documentGetAllHandler(w http.ResponseWriter, r *http.Req
 	} else if ownership == "-me" {
 		user := app.contextGetUser(r)
 		input.Flag = &user.User_id
+	} else if ownership == "shared" {
+		user := app.contextGetUser(r)
+		input.Shared = &user.User_id
 	}
 
 	input.Title = utils.ReadStringParam(qs, "title", "")
+	input.Search = utils.ReadStringParam(qs, "q", "")
 	input.Tags = utils.ReadCSVParam(qs, "tags", []string{})
 	input.Filters.Page = utils.ReadIntParam(qs, "page", 1)
 	input.Filters.PageSize = utils.ReadIntParam(qs, "page_size", 20)
 	input.Filters.Sort = utils.ReadStringParam(qs, "sort", "document_id")
-	input.Filters.SortSafelist = []string{"document_id", "-document_id"}
+	input.Filters.SortSafelist = []string{"document_id", "-document_id", "size", "-size", "page_count", "-page_count"}
+
+	invalid := map[string]string{}
+	params := map[string]**int64{
+		"min_pages": &input.Metadata.Min_pages,
+		"max_pages": &input.Metadata.Max_pages,
+		"min_size":  &input.Metadata.Min_size,
+		"max_size":  &input.Metadata.Max_size,
+	}
+	for key, target := range params {
+		value, ok := utils.ReadOptionalIntParam(qs, key)
+		if !ok {
+			invalid[key] = "must be a whole number"
+		}
+		*target = value
+	}
+	encrypted, ok := utils.ReadOptionalBoolParam(qs, "encrypted")
+	if !ok {
+		invalid["encrypted"] = "must be true or false"
+	}
+	input.Metadata.Is_encrypted = encrypted
+
+	if len(invalid) > 0 {
+		utils.FailedValidationResponse(w, r, invalid) //? http.StatusUnprocessableEntity - 422
+		return
+	}
+
+	//? search results are ordered by relevance unless asked otherwise
+	if input.Search != "" {
+		input.Filters.Sort = utils.ReadStringParam(qs, "sort", "-rank")
+		input.Filters.SortSafelist = append(input.Filters.SortSafelist, "rank", "-rank")
+	}
+
+	if !input.Filters.SortAllowed() {
+		utils.FailedValidationResponse(w, r, map[string]string{"sort": "invalid sort value"}) //? http.StatusUnprocessableEntity - 422
+		return
+	}
 
-	documents, metadata, err := app.data_access.Documents.GetAll(input.Title, input.Tags, input.Owner, input.Flag, input.Filters)
+	documents, metadata, err := app.data_access.Documents.GetAll(input.Title, input.Search, input.Tags, input.Owner, input.Flag, input.Shared, input.Metadata, input.Filters)
 	if err != nil {
 		utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
 		return
@@ -85,6 +419,12 @@ func (app *application) documentGetAllHandler(w http.ResponseWriter, r *http.Req
 	responses_slice := []interface{}{}
 
 	for _, document := range documents {
+		//? listing is cached for everyone, so previews of watermarked documents are left out even for their editors
+		preview_url := previewLink(&document)
+		if document.Watermark != nil {
+			preview_url = nil
+		}
+
 		doc := struct {
 			ID          int       `json:"document_id"`
 			User_id     int       `json:"user_id"`
@@ -92,13 +432,21 @@ func (app *application) documentGetAllHandler(w http.ResponseWriter, r *http.Req
 			Link        string    `json:"link"`
 			Tags        []string  `json:"tags"`
 			Uploaded_at time.Time `json:"created_at"`
+			Preview_url *string   `json:"preview_url"`
+			Rank        float32   `json:"rank,omitempty"`
+			Snippet     string    `json:"snippet,omitempty"`
+			data.FileMetadata
 		}{
-			ID:          document.Document_id,
-			User_id:     document.User_id,
-			Title:       document.Title,
-			Link:        document.Url_s3,
-			Tags:        document.Tags,
-			Uploaded_at: document.Uploaded_at,
+			ID:           document.Document_id,
+			User_id:      document.User_id,
+			Title:        document.Title,
+			Link:         downloadLink(document.Document_id),
+			Preview_url:  preview_url,
+			Tags:         document.Tags,
+			Uploaded_at:  document.Uploaded_at,
+			Rank:         document.Rank,
+			Snippet:      document.Snippet,
+			FileMetadata: document.FileMetadata,
 		}
 
 		responses_slice = append(responses_slice, doc)
@@ -109,72 +457,122 @@ func (app *application) documentGetAllHandler(w http.ResponseWriter, r *http.Req
 		utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
 	}
 
-	err = app.redis_client.Set(context.TODO(), "defaultValues", jsonData, time.Hour*24).Err()
-	if err != nil {
-		log.Error("failed caching response", err)
+	//? only the default public listing is cached, filtered and per-user listings differ between requests
+	if len(qs) == 0 {
+		err = app.redis_client.Set(context.TODO(), "defaultValues", jsonData, time.Hour*24).Err()
+		if err != nil {
+			log.Error("failed caching response", err)
+		}
 	}
 }
 
 // Add single document
 //
 //	@Summary      Add single document
-//	@Description  Add single document
+//	@Description  Add single document, size of the file is recorded and PDFs are inspected for page count, info dictionary and encryption. PDFs which can't be read are rejected
 //	@Tags         document
 //	@Accept       mpfd
 //	@Produce      json
 //	@Success      200  {object}   data.Document
 //	@Failure      400  {string}  "Bad json reqest"
 //	@Failure      401  {string}  "Unauthorized"
+//	@Failure      413  {string}  "File too large"
+//	@Failure      415  {string}  "Unsupported file type"
+//	@Failure      422  {string}  "Malformed PDF"
 //	@Failure      500  {string}  "Internal server error"
 //	@Router       /document [post]
 func (app *application) documentAddHandler(w http.ResponseWriter, r *http.Request) {
 	var input struct {
-		Tags      []string `json:"tags"`
-		Is_hidden bool     `json:"is_hidden"`
+		Tags        []string `json:"tags"`
+		Is_hidden   bool     `json:"is_hidden"`
+		Description string   `json:"description"`
+		Folder_id   *int     `json:"folder_id"`
+	}
+
+	user := app.contextGetUser(r)
+	max_size := app.uploadLimit(user)
+
+	if r.ContentLength > max_size+1048576 {
+		utils.FileTooLargeResponse(w, r, max_size) //? http.StatusRequestEntityTooLarge - 413
+		return
+	}
+
+	//? large uploads take longer than server-wide timeouts allow, extend deadlines for this request only
+	controller := http.NewResponseController(w)
+	err := controller.SetReadDeadline(time.Now().Add(app.settings.Upload_timeout))
+	if err != nil {
+		log.Error("failed extending upload read deadline", err)
+	}
+	err = controller.SetWriteDeadline(time.Now().Add(app.settings.Upload_timeout))
+	if err != nil {
+		log.Error("failed extending upload write deadline", err)
 	}
 
-	file, file_data, err := utils.ReadMultipartJSON(w, r, &input)
+	document_part, filename, err := utils.ReadMultipartStream(w, r, &input, max_size)
 	if err != nil {
-		utils.BadRequestResponse(w, r, err)
+		utils.BadRequestResponse(w, r, err) //? http.StatusBadRequest - 400
 		return
 	}
-	defer file.Close()
 
-	user := app.contextGetUser(r)
+	file := bufio.NewReaderSize(document_part, 512)
+	head, err := file.Peek(512)
+	if err != nil && !errors.Is(err, io.EOF) {
+		switch {
+		case isFileTooLarge(err):
+			utils.FileTooLargeResponse(w, r, max_size) //? http.StatusRequestEntityTooLarge - 413
+		default:
+			utils.BadRequestResponse(w, r, err) //? http.StatusBadRequest - 400
+		}
+		return
+	}
 
-	document := &data.Document{
-		User_id:   user.User_id,
-		Filetype:  ".pdf",
-		Title:     user.Username + "_" + file_data.Filename,
-		Tags:      input.Tags,
-		Is_hidden: input.Is_hidden,
-	}
-
-	disposition := "inline"
-	contentType := "application/pdf"
-
-	uploader := manager.NewUploader(app.s3_client)
-	res, err := uploader.Upload(context.TODO(), &s3.PutObjectInput{
-		Bucket:             aws.String(os.Getenv("AWS_S3_BUCKET_NAME")),
-		Key:                aws.String(document.Title),
-		Body:               file,
-		ACL:                "public-read",
-		ContentDisposition: &disposition,
-		ContentType:        &contentType,
-	})
+	filetype := utils.DetectFiletype(head, filename)
+	if !utils.IsFiletypeAllowed(filetype, app.settings.Allowed_filetypes) {
+		utils.UnsupportedFiletypeResponse(w, r, filetype) //? http.StatusUnsupportedMediaType - 415
+		return
+	}
+
+	if input.Folder_id != nil && !app.checkTargetFolder(w, r, user.User_id, *input.Folder_id) {
+		return
+	}
+
+	blob, metadata, local, err := app.storeFile(user.User_id, file, filename, filetype)
 	if err != nil {
-		utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+		switch {
+		case isFileTooLarge(err):
+			utils.FileTooLargeResponse(w, r, max_size) //? http.StatusRequestEntityTooLarge - 413
+		case errors.Is(err, pdf.ErrMalformed):
+			utils.FailedValidationResponse(w, r, map[string]string{"file": "malformed PDF, the file can't be read"}) //? http.StatusUnprocessableEntity - 422
+		default:
+			utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+		}
 		return
 	}
 
-	document.Url_s3 = res.Location
+	document := &data.Document{
+		User_id:      user.User_id,
+		Filetype:     filetype,
+		Title:        filename,
+		Storage_key:  blob.Storage_key,
+		Checksum:     blob.Checksum,
+		Url_s3:       blob.Location,
+		Tags:         input.Tags,
+		Is_hidden:    input.Is_hidden,
+		Description:  input.Description,
+		Folder_id:    input.Folder_id,
+		FileMetadata: metadata,
+	}
 
 	err = app.data_access.Documents.Insert(document)
 	if err != nil {
+		removeTemp(local)
+		app.releaseBlob(blob.Storage_key)
 		utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
 		return
 	}
 
+	app.processDocument(document, local)
+
 	headers := http.Header{}
 	headers.Set("Location", fmt.Sprintf("/v1/document/%d", document.Document_id))
 
@@ -192,99 +590,299 @@ func (app *application) documentAddHandler(w http.ResponseWriter, r *http.Reques
 // Delete document
 //
 //	@Summary      Delete document
-//	@Description  Delete document
+//	@Description  Move document to trash, it can be restored until it's purged permanently
 //	@Tags         document
 //	@Produce      json
 //	@Success      200  {string}  "Successfully deleted"
 //	@Failure      401  {string}  "Unauthorized"
+//	@Failure      403  {string}  "Forbidden"
 //	@Failure      404  {string}  "Not found"
+//	@Failure      409  {string}  "Edit conflict"
+//	@Failure      412  {string}  "If-Match precondition failed"
 //	@Failure      500  {string}  "Internal server error"
 //	@Router       /document/:id [delete]
 func (app *application) documentDeleteHandler(w http.ResponseWriter, r *http.Request) {
-	id, err := utils.ReadIDParam(r)
+	document, ok := app.readDocument(w, r, accessManage)
+	if !ok {
+		return
+	}
+
+	err := app.data_access.Documents.Trash(document)
 	if err != nil {
-		utils.NotFoundResponse(w, r) //? http.StatusNotFound - 404
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			utils.EditConflictResponse(w, r) //? http.StatusConflict - 409
+		default:
+			utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+		}
 		return
 	}
 
-	document, err := app.data_access.Documents.Get(id)
+	err = utils.WriteJSON(w, http.StatusOK, utils.Wrap{"message": "document moved to trash"}, nil)
 	if err != nil {
 		utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
-		return
 	}
 
-	user := app.contextGetUser(r)
+	err = app.redis_client.FlushAll(context.TODO()).Err()
+	if err != nil {
+		log.Error("Failed flushing cache", err)
+	}
+}
 
-	if document.User_id != user.User_id && !user.Is_admin {
-		utils.InvalidCredentialsResponse(w, r)
+// Get document details
+//
+//	@Summary      Get document details
+//	@Description  Get document details
+//	@Tags         document
+//	@Produce      json
+//	@Success      200  {string}  data.Document
+//	@Failure      401  {string}  "Unauthorized"
+//	@Failure      403  {string}  "Forbidden"
+//	@Failure      404  {string}  "Not found"
+//	@Failure      500  {string}  "Internal server error"
+//	@Router       /document/:id [get]
+func (app *application) documentGetHandler(w http.ResponseWriter, r *http.Request) {
+	document, ok := app.readDocument(w, r, accessView)
+	if !ok {
 		return
 	}
 
-	_, err = app.s3_client.DeleteObject(context.TODO(), &s3.DeleteObjectInput{
-		Bucket: aws.String(os.Getenv("AWS_S3_BUCKET_NAME")),
-		Key:    aws.String(document.Title),
-	})
+	preview_url, err := app.previewFor(app.contextGetUser(r), document)
 	if err != nil {
 		utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
 		return
 	}
 
-	err = app.data_access.Documents.Delete(id)
+	response := struct {
+		*data.Document
+		Preview_url *string `json:"preview_url"`
+	}{
+		Document:    document,
+		Preview_url: preview_url,
+	}
+
+	headers := http.Header{}
+	headers.Set("ETag", utils.VersionETag(document.Version))
+
+	err = utils.WriteJSON(w, http.StatusOK, utils.Wrap{"document": response}, headers)
+	if err != nil {
+		utils.ServerErrorResponse(w, r, err)
+	}
+}
+
+// Download document
+//
+//	@Summary      Download document
+//	@Description  Redirect to short-lived presigned link to document's content, watermarked documents are stamped and served directly to those who can't edit them, encrypted ones are decrypted and served directly
+//	@Tags         document
+//	@Success      200  {file}    file
+//	@Success      302  {string}  "Redirect to document content"
+//	@Failure      401  {string}  "Unauthorized"
+//	@Failure      403  {string}  "Forbidden"
+//	@Failure      404  {string}  "Not found"
+//	@Failure      409  {string}  "Watermark can't be applied"
+//	@Failure      500  {string}  "Internal server error"
+//	@Router       /document/:id/download [get]
+func (app *application) documentDownloadHandler(w http.ResponseWriter, r *http.Request) {
+	document, ok := app.readDocument(w, r, accessView)
+	if !ok {
+		return
+	}
+
+	watermark, err := app.watermarkFor(app.contextGetUser(r), document)
 	if err != nil {
 		utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
 		return
 	}
+	if watermark != nil {
+		//? stamped copy differs between downloads, presigned link can only point to the original
+		app.sendStamped(w, r, document.Storage_key, document.Filetype, document.Title, "inline", watermark)
+		return
+	}
+
+	app.sendBlob(w, r, document.Storage_key, document.Title, document.Filetype)
+}
+
+// Preview document
+//
+//	@Summary      Preview document
+//	@Description  Redirect to short-lived presigned link to PNG image of document's first page, previews are generated in background after upload and listed as preview_url once ready, encrypted previews are served directly. Previews aren't stamped, watermarked documents don't have one for those who can't edit them and aren't listed with one
+//	@Tags         document
+//	@Success      200  {file}    file
+//	@Success      302  {string}  "Redirect to preview image"
+//	@Failure      401  {string}  "Unauthorized"
+//	@Failure      403  {string}  "Forbidden"
+//	@Failure      404  {string}  "Not found or no preview (or watermarked)"
+//	@Failure      500  {string}  "Internal server error"
+//	@Router       /document/:id/preview [get]
+func (app *application) documentPreviewHandler(w http.ResponseWriter, r *http.Request) {
+	document, ok := app.readDocument(w, r, accessView)
+	if !ok {
+		return
+	}
 
-	err = utils.WriteJSON(w, http.StatusOK, utils.Wrap{"message": "document successfully deleted"}, nil)
+	preview_url, err := app.previewFor(app.contextGetUser(r), document)
 	if err != nil {
 		utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+		return
+	}
+	if preview_url == nil {
+		utils.NotFoundResponse(w, r) //? http.StatusNotFound - 404
+		return
 	}
 
-	err = app.redis_client.FlushAll(context.TODO()).Err()
+	filename := strings.TrimSuffix(document.Title, filepath.Ext(document.Title)) + ".png"
+	app.sendBlob(w, r, *document.Preview_key, filename, "image/png")
+}
+
+// Stream document content
+//
+//	@Summary      Stream document content
+//	@Description  Serve document's content through the API, supports Range, If-Range and conditional requests. Watermarked documents are stamped for those who can't edit them
+//	@Tags         document
+//	@Produce      octet-stream
+//	@Param        disposition  query     string  false  "inline (default) or attachment"
+//	@Success      200  {file}    file
+//	@Success      206  {file}    file
+//	@Success      304  {string}  "Not modified"
+//	@Failure      401  {string}  "Unauthorized"
+//	@Failure      403  {string}  "Forbidden"
+//	@Failure      404  {string}  "Not found"
+//	@Failure      409  {string}  "Watermark can't be applied"
+//	@Failure      416  {string}  "Range not satisfiable"
+//	@Failure      422  {string}  "Invalid disposition"
+//	@Failure      500  {string}  "Internal server error"
+//	@Router       /document/:id/content [get]
+func (app *application) documentContentHandler(w http.ResponseWriter, r *http.Request) {
+	document, ok := app.readDocument(w, r, accessView)
+	if !ok {
+		return
+	}
+
+	disposition := utils.ReadStringParam(r.URL.Query(), "disposition", "inline")
+	if disposition != "inline" && disposition != "attachment" {
+		utils.FailedValidationResponse(w, r, map[string]string{"disposition": "must be inline or attachment"}) //? http.StatusUnprocessableEntity - 422
+		return
+	}
+
+	watermark, err := app.watermarkFor(app.contextGetUser(r), document)
 	if err != nil {
-		log.Error("Failed flushing cache", err)
+		utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+		return
+	}
+	if watermark != nil {
+		app.sendStamped(w, r, document.Storage_key, document.Filetype, document.Title, disposition, watermark)
+		return
 	}
+
+	w.Header().Set("ETag", contentETag(document))
+	w.Header().Set("Cache-Control", "private, no-cache")
+
+	app.streamBlob(w, r, document.Storage_key, document.Title, document.Filetype, disposition, document.Revised_at)
 }
 
-// Get document details
+// Update document metadata
 //
-//	@Summary      Get document details
-//	@Description  Get document details
+//	@Summary      Update document metadata
+//	@Description  Partially update document's title, tags, visibility, description and folder, only provided fields are changed, folder_id 0 moves document out of folders
 //	@Tags         document
+//	@Accept       json
 //	@Produce      json
-//	@Success      200  {string}  data.Document
+//	@Success      200  {object}  data.Document
+//	@Failure      400  {string}  "Bad json request"
 //	@Failure      401  {string}  "Unauthorized"
+//	@Failure      403  {string}  "Forbidden"
 //	@Failure      404  {string}  "Not found"
+//	@Failure      409  {string}  "Edit conflict"
+//	@Failure      412  {string}  "If-Match precondition failed"
+//	@Failure      422  {string}  "Invalid title or description"
 //	@Failure      500  {string}  "Internal server error"
-//	@Router       /document/:id [get]
-func (app *application) documentGetHandler(w http.ResponseWriter, r *http.Request) {
-	id, err := utils.ReadIDParam(r)
+//	@Router       /document/:id/metadata [patch]
+func (app *application) documentUpdateHandler(w http.ResponseWriter, r *http.Request) {
+	document, ok := app.readDocument(w, r, accessEdit)
+	if !ok {
+		return
+	}
+
+	input := struct {
+		Title       *string  `validate:"omitempty,min=1,max=255,excludesall=/" json:"title"`
+		Tags        []string `json:"tags"`
+		Is_hidden   *bool    `json:"is_hidden"`
+		Description *string  `validate:"omitempty,max=2000" json:"description"`
+		Folder_id   *int     `validate:"omitempty,gte=0" json:"folder_id"`
+	}{}
+
+	err := utils.ReadJSON(w, r, &input)
 	if err != nil {
-		utils.NotFoundResponse(w, r) //? http.StatusNotFound - 404
+		utils.BadRequestResponse(w, r, err) //? http.StatusBadRequest - 400
 		return
 	}
 
-	document, err := app.data_access.Documents.Get(id)
+	validate := validator.New()
+	err = validate.Struct(input)
+	if err != nil {
+		utils.FailedValidationResponseValidator(w, r, err) //? http.StatusUnprocessableEntity - 422
+		return
+	}
+
+	//? visibility and folder are managed by owner, editors can change everything else
+	if (input.Is_hidden != nil && *input.Is_hidden != document.Is_hidden) || input.Folder_id != nil {
+		allowed, err := app.authorizeDocument(app.contextGetUser(r), document, accessManage)
+		if err != nil {
+			utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+			return
+		}
+		if !allowed {
+			utils.NotPermittedResponse(w, r) //? http.StatusForbidden - 403
+			return
+		}
+	}
+
+	if input.Title != nil {
+		document.Title = *input.Title
+	}
+	if input.Tags != nil {
+		document.Tags = input.Tags
+	}
+	if input.Is_hidden != nil {
+		document.Is_hidden = *input.Is_hidden
+	}
+	if input.Description != nil {
+		document.Description = *input.Description
+	}
+	if input.Folder_id != nil {
+		if *input.Folder_id == 0 {
+			document.Folder_id = nil
+		} else {
+			if !app.checkTargetFolder(w, r, document.User_id, *input.Folder_id) {
+				return
+			}
+			document.Folder_id = input.Folder_id
+		}
+	}
+
+	err = app.data_access.Documents.Update(document)
 	if err != nil {
 		switch {
-		case errors.Is(err, data.ErrRecordNotFound):
-			utils.NotFoundResponse(w, r) //? http.StatusNotFound - 404
+		case errors.Is(err, data.ErrEditConflict):
+			utils.EditConflictResponse(w, r) //? http.StatusConflict - 409
 		default:
 			utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
 		}
 		return
 	}
 
-	user := app.contextGetUser(r)
+	headers := http.Header{}
+	headers.Set("ETag", utils.VersionETag(document.Version))
 
-	if document.Is_hidden && document.User_id != user.User_id && !user.Is_admin {
-		utils.InvalidCredentialsResponse(w, r) //? http.StatusUnauthorized - 401
-		return
+	err = utils.WriteJSON(w, http.StatusOK, utils.Wrap{"document": document}, headers)
+	if err != nil {
+		utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
 	}
 
-	err = utils.WriteJSON(w, http.StatusOK, utils.Wrap{"document": document}, nil)
+	err = app.redis_client.FlushAll(context.TODO()).Err()
 	if err != nil {
-		utils.ServerErrorResponse(w, r, err)
+		log.Error("Failed flushing cache", err)
 	}
 }
 
@@ -296,40 +894,29 @@ func (app *application) documentGetHandler(w http.ResponseWriter, r *http.Reques
 //	@Produce      json
 //	@Success      200  {string}  "Successfully toggled visibility"
 //	@Failure      401  {string}  "Unauthorized"
+//	@Failure      403  {string}  "Forbidden"
 //	@Failure      404  {string}  "Not found"
+//	@Failure      409  {string}  "Edit conflict"
+//	@Failure      412  {string}  "If-Match precondition failed"
 //	@Failure      500  {string}  "Internal server error"
 //	@Router       /document/:id [patch]
 func (app *application) documentToggleVisibilityHandler(w http.ResponseWriter, r *http.Request) {
-	id, err := utils.ReadIDParam(r)
-	if err != nil {
-		utils.NotFoundResponse(w, r) //? http.StatusNotFound - 404
+	document, ok := app.readDocument(w, r, accessManage)
+	if !ok {
 		return
 	}
 
-	document, err := app.data_access.Documents.Get(id)
+	document, err := app.data_access.Documents.ToggleVisibility(document.Document_id, document.Version)
 	if err != nil {
 		switch {
-		case errors.Is(err, data.ErrRecordNotFound):
-			utils.NotFoundResponse(w, r) //? http.StatusNotFound - 404
+		case errors.Is(err, data.ErrEditConflict):
+			utils.EditConflictResponse(w, r) //? http.StatusConflict - 409
 		default:
 			utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
 		}
 		return
 	}
 
-	user := app.contextGetUser(r)
-
-	if document.User_id != user.User_id && !user.Is_admin {
-		utils.InvalidCredentialsResponse(w, r) //? http.StatusUnauthorized - 401
-		return
-	}
-
-	document, err = app.data_access.Documents.ToggleVisibility(id)
-	if err != nil {
-		utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
-		return
-	}
-
 	response := struct {
 		ID          int       `json:"document_id"`
 		Title       string    `json:"title"`
@@ -337,16 +924,21 @@ func (app *application) documentToggleVisibilityHandler(w http.ResponseWriter, r
 		Tags        []string  `json:"tags"`
 		Uploaded_at time.Time `json:"created_at"`
 		Is_hidden   bool      `json:"is_hidden"`
+		Version     int       `json:"version"`
 	}{
 		ID:          document.Document_id,
 		Title:       document.Title,
-		Link:        document.Url_s3,
+		Link:        downloadLink(document.Document_id),
 		Tags:        document.Tags,
 		Uploaded_at: document.Uploaded_at,
 		Is_hidden:   document.Is_hidden,
+		Version:     document.Version,
 	}
 
-	err = utils.WriteJSON(w, http.StatusOK, utils.Wrap{"document": response}, nil)
+	headers := http.Header{}
+	headers.Set("ETag", utils.VersionETag(document.Version))
+
+	err = utils.WriteJSON(w, http.StatusOK, utils.Wrap{"document": response}, headers)
 	if err != nil {
 		utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
 	}
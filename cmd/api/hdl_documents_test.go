@@ -0,0 +1,70 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"viadro_api/internal/data"
+	"viadro_api/internal/data/testdb"
+	"viadro_api/internal/storage"
+	"viadro_api/utils"
+)
+
+func TestStoreFileDeduplicates(t *testing.T) {
+	memory_store, err := storage.NewMemoryStore("http://localhost/v1/storage", strings.Repeat("s", storage.MinSecretSize))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := &application{
+		data_access: data.NewLayers(testdb.Open(t)),
+		storage:     memory_store,
+	}
+
+	user := &data.User{Username: "tester", Email: "tester@example.com", Activated: true}
+	err = user.Password.Set("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = app.data_access.Users.Insert(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	documents := []*data.Document{}
+	for _, title := range []string{"first.txt", "second.txt"} {
+		blob, metadata, local, err := app.storeFile(user.User_id, strings.NewReader("same content"), title, utils.FiletypeText)
+		if err != nil {
+			t.Fatal(err)
+		}
+		removeTemp(local)
+
+		document := &data.Document{
+			User_id:      user.User_id,
+			Filetype:     utils.FiletypeText,
+			Title:        title,
+			Storage_key:  blob.Storage_key,
+			Checksum:     blob.Checksum,
+			Url_s3:       blob.Location,
+			FileMetadata: metadata,
+		}
+
+		err = app.data_access.Documents.Insert(document)
+		if err != nil {
+			t.Fatalf("inserting %s: %v", title, err)
+		}
+		documents = append(documents, document)
+	}
+
+	if documents[0].Storage_key != documents[1].Storage_key {
+		t.Fatalf("documents stored under %s and %s, want one blob", documents[0].Storage_key, documents[1].Storage_key)
+	}
+
+	blob, err := app.data_access.Blobs.Get(documents[0].Storage_key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if blob.Ref_count != 2 {
+		t.Fatalf("ref_count = %d, want 2", blob.Ref_count)
+	}
+}
@@ -0,0 +1,427 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"viadro_api/internal/data"
+	"viadro_api/internal/mail"
+	"viadro_api/internal/storage"
+	"viadro_api/utils"
+
+	"github.com/charmbracelet/log"
+	"github.com/go-playground/validator/v10"
+	"github.com/julienschmidt/httprouter"
+)
+
+const exportFilename = "viadro-export.zip"
+
+type exportOwner struct {
+	User_id  int    `json:"user_id"`
+	Username string `json:"username,omitempty"`
+}
+
+type exportEntry struct {
+	Document_id int         `json:"document_id"`
+	Filename    string      `json:"filename"`
+	Title       string      `json:"title"`
+	Filetype    string      `json:"filetype"`
+	Checksum    *string     `json:"checksum"`
+	Description string      `json:"description"`
+	Tags        []string    `json:"tags"`
+	Uploaded_at time.Time   `json:"uploaded_at"`
+	Revised_at  time.Time   `json:"revised_at"`
+	Owner       exportOwner `json:"owner"`
+	//? stamped copy is archived, checksum of the original doesn't match it
+	Watermarked bool `json:"watermarked,omitempty"`
+}
+
+type exportManifest struct {
+	Exported_at time.Time     `json:"exported_at"`
+	Documents   []exportEntry `json:"documents"`
+	Skipped     []bulkResult  `json:"skipped"`
+}
+
+// documentExport holds everything needed to write an archive, owners and watermarks are resolved up front
+// so nothing can fail before the first byte of the archive is written, except storage itself.
+type documentExport struct {
+	documents  []*data.Document
+	owners     map[int]string
+	watermarks map[int]*data.Watermark
+	skipped    []bulkResult
+}
+
+// stampedBody is stamped copy of exported document, it's removed once archived.
+type stampedBody struct {
+	*os.File
+}
+
+func (b stampedBody) Close() error {
+	removeTemp(b.File)
+	return nil
+}
+
+// prepareExport resolves owners' usernames and watermarks of documents exported by user, results of documents which
+// can't be exported are kept for manifest.
+func (app *application) prepareExport(user *data.User, documents []*data.Document, results []bulkResult) (*documentExport, error) {
+	export := &documentExport{
+		documents:  documents,
+		owners:     map[int]string{},
+		watermarks: map[int]*data.Watermark{},
+		skipped:    []bulkResult{},
+	}
+
+	for _, result := range results {
+		if !result.Ok {
+			export.skipped = append(export.skipped, result)
+		}
+	}
+
+	for _, document := range documents {
+		watermark, err := app.watermarkFor(user, document)
+		if err != nil {
+			return nil, err
+		}
+		if watermark != nil {
+			export.watermarks[document.Document_id] = watermark
+		}
+
+		_, ok := export.owners[document.User_id]
+		if ok {
+			continue
+		}
+
+		owner, err := app.data_access.Users.GetById(document.User_id)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				//? owner was deleted meanwhile, document is exported without username
+				export.owners[document.User_id] = ""
+				continue
+			default:
+				return nil, err
+			}
+		}
+		export.owners[document.User_id] = owner.Username
+	}
+
+	return export, nil
+}
+
+// exportEntryName makes file name of document inside the archive, names are flat, unique and keep extension matching filetype.
+func exportEntryName(document *data.Document, used map[string]bool) string {
+	name := strings.NewReplacer("/", "_", "\\", "_").Replace(strings.TrimSpace(document.Title))
+	if name == "" || name == "." || name == ".." || name == "manifest.json" {
+		name = fmt.Sprintf("document-%d", document.Document_id)
+	}
+
+	ext := path.Ext(name)
+	if ext == "" {
+		ext = utils.FiletypeExtension(document.Filetype)
+		name += ext
+	}
+
+	base := strings.TrimSuffix(name, ext)
+	for i := 2; used[strings.ToLower(name)]; i++ {
+		name = fmt.Sprintf("%s (%d)%s", base, i, ext)
+	}
+	used[strings.ToLower(name)] = true
+
+	return name
+}
+
+// exportContent opens content of exported document, stamped copy of it when it's watermarked.
+func (app *application) exportContent(ctx context.Context, document *data.Document, watermark *data.Watermark) (io.ReadCloser, error) {
+	if watermark == nil {
+		body, _, err := app.storage.Get(ctx, document.Storage_key)
+		return body, err
+	}
+
+	file, err := app.stampBlob(document.Storage_key, document.Filetype, watermark)
+	if err != nil {
+		return nil, err
+	}
+
+	return stampedBody{file}, nil
+}
+
+// writeExport streams ZIP archive of documents into out, each document is copied straight from storage and manifest.json
+// describing the archive is written last. Documents whose content can't be fetched are skipped and listed in manifest,
+// returned count is the number of documents actually archived.
+func (app *application) writeExport(ctx context.Context, out io.Writer, export *documentExport) (int, error) {
+	archive := zip.NewWriter(out)
+
+	manifest := exportManifest{
+		Exported_at: time.Now().UTC(),
+		Documents:   []exportEntry{},
+		Skipped:     export.skipped,
+	}
+	used := map[string]bool{}
+
+	for _, document := range export.documents {
+		watermark := export.watermarks[document.Document_id]
+
+		body, err := app.exportContent(ctx, document, watermark)
+		if err != nil {
+			if errors.Is(err, errNotStampable) {
+				manifest.Skipped = append(manifest.Skipped, bulkResult{Document_id: document.Document_id, Error: "watermark can't be applied"})
+				continue
+			}
+			log.Error(fmt.Sprintf("failed fetching content of exported document %d", document.Document_id), err)
+			manifest.Skipped = append(manifest.Skipped, bulkResult{Document_id: document.Document_id, Error: "content unavailable"})
+			continue
+		}
+
+		name := exportEntryName(document, used)
+
+		entry, err := archive.CreateHeader(&zip.FileHeader{
+			Name:     name,
+			Method:   zip.Deflate,
+			Modified: document.Revised_at,
+		})
+		if err != nil {
+			body.Close()
+			return 0, err
+		}
+
+		_, err = io.Copy(entry, body)
+		body.Close()
+		if err != nil {
+			return 0, err
+		}
+
+		checksum := document.Checksum
+		if watermark != nil {
+			checksum = nil
+		}
+
+		manifest.Documents = append(manifest.Documents, exportEntry{
+			Document_id: document.Document_id,
+			Filename:    name,
+			Title:       document.Title,
+			Filetype:    document.Filetype,
+			Checksum:    checksum,
+			Description: document.Description,
+			Tags:        document.Tags,
+			Uploaded_at: document.Uploaded_at,
+			Revised_at:  document.Revised_at,
+			Owner:       exportOwner{User_id: document.User_id, Username: export.owners[document.User_id]},
+			Watermarked: watermark != nil,
+		})
+	}
+
+	entry, err := archive.CreateHeader(&zip.FileHeader{
+		Name:     "manifest.json",
+		Method:   zip.Deflate,
+		Modified: manifest.Exported_at,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	encoder := json.NewEncoder(entry)
+	encoder.SetIndent("", "\t")
+	err = encoder.Encode(manifest)
+	if err != nil {
+		return 0, err
+	}
+
+	err = archive.Close()
+	if err != nil {
+		return 0, err
+	}
+
+	return len(manifest.Documents), nil
+}
+
+func exportLink(token string) string {
+	return fmt.Sprintf("/v1/export/%s", token)
+}
+
+// storeExport writes archive into storage and emails user a link to it, archive is kept until the link expires.
+// The link points to the API, archives are encrypted at rest like documents and can't be presigned.
+func (app *application) storeExport(user *data.User, export *documentExport) error {
+	storage_key, err := storage.NewExportKey(user.User_id)
+	if err != nil {
+		return err
+	}
+
+	//? archive is piped into storage as it is written, so it's never held in memory as a whole
+	reader, writer := io.Pipe()
+	written := make(chan int, 1)
+
+	go func() {
+		count, err := app.writeExport(context.TODO(), writer, export)
+		writer.CloseWithError(err)
+		written <- count
+	}()
+
+	_, err = app.storage.Put(context.TODO(), storage_key, reader, storage.PutOptions{
+		Content_type:        "application/zip",
+		Content_disposition: contentDisposition(exportFilename),
+	})
+	//? unblocks the writer when storage gave up before reading the whole archive
+	reader.CloseWithError(err)
+	count := <-written
+	if err != nil {
+		return err
+	}
+
+	record := &data.Export{
+		User_id:         user.User_id,
+		Storage_key:     storage_key,
+		Documents_count: count,
+		Expiry:          time.Now().Add(app.settings.Export_link_ttl),
+	}
+
+	err = app.data_access.Exports.Insert(record)
+	if err != nil {
+		delete_err := app.storage.Delete(context.TODO(), storage_key)
+		if delete_err != nil {
+			log.Error("failed deleting unregistered export", delete_err)
+		}
+		return err
+	}
+
+	data := map[string]interface{}{
+		"download_link":   app.settings.Url + exportLink(record.Plaintext),
+		"documents_count": count,
+		"expiry":          record.Expiry.UTC().Format(time.RFC1123),
+	}
+
+	email, err := mail.PrepareEmail(user.Email, "document_export.html", data)
+	if err != nil {
+		return err
+	}
+
+	return app.mail_client.DialAndSend(email)
+}
+
+// Export documents
+//
+//	@Summary      Export documents
+//	@Description  Download selected documents as a ZIP archive streamed straight from storage, manifest.json inside describes every document and lists those which couldn't be exported. Watermarked documents are archived stamped for those who can't edit them. Documents are selected by ids or by title and tags filter over own documents, like in bulk operations. With background set, archive is written to storage instead and link to it is sent to user's email
+//	@Tags         document
+//	@Accept       json
+//	@Produce      application/zip
+//	@Success      200  {file}    file    "ZIP archive"
+//	@Success      202  {string}  string  "Export started in background"
+//	@Failure      400  {string}  "Bad json request"
+//	@Failure      401  {string}  "Unauthorized"
+//	@Failure      422  {string}  "Invalid selection or nothing to export"
+//	@Failure      500  {string}  "Internal server error"
+//	@Router       /documents/export [post]
+func (app *application) documentExportHandler(w http.ResponseWriter, r *http.Request) {
+	input := struct {
+		documentSelection
+		Background bool `json:"background"`
+	}{}
+
+	err := utils.ReadJSON(w, r, &input)
+	if err != nil {
+		utils.BadRequestResponse(w, r, err) //? http.StatusBadRequest - 400
+		return
+	}
+
+	validate := validator.New()
+	err = validate.Struct(input)
+	if err != nil {
+		utils.FailedValidationResponseValidator(w, r, err) //? http.StatusUnprocessableEntity - 422
+		return
+	}
+
+	ids, ok := app.resolveSelection(w, r, input.documentSelection)
+	if !ok {
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	documents, results, err := app.authorizeSelection(user, ids, accessView, nil)
+	if err != nil {
+		utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+		return
+	}
+
+	if len(documents) == 0 {
+		utils.FailedValidationResponse(w, r, map[string]string{"ids": "none of selected documents can be exported"}) //? http.StatusUnprocessableEntity - 422
+		return
+	}
+
+	export, err := app.prepareExport(user, documents, results)
+	if err != nil {
+		utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+		return
+	}
+
+	if input.Background {
+		app.background(func() {
+			err := app.storeExport(user, export)
+			if err != nil {
+				log.Error(fmt.Sprintf("failed exporting documents of user %d", user.User_id), err)
+			}
+		})
+
+		err = utils.WriteJSON(w, http.StatusAccepted, utils.Wrap{"message": "export started, an email with download link will be sent to you once it's ready", "documents": len(documents), "skipped": export.skipped}, nil)
+		if err != nil {
+			utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+		}
+		return
+	}
+
+	//? archive size isn't known up front and transfer of many documents takes longer than server-wide write timeout allows
+	controller := http.NewResponseController(w)
+	err = controller.SetWriteDeadline(time.Now().Add(app.settings.Upload_timeout))
+	if err != nil {
+		log.Error("failed extending export write deadline", err)
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": exportFilename}))
+	w.Header().Set("Cache-Control", "no-store")
+
+	_, err = app.writeExport(r.Context(), w, export)
+	if err != nil {
+		//? status was already sent, aborting the connection is the only way to tell client the archive is incomplete
+		log.Error("failed streaming export", err)
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// Download export
+//
+//	@Summary      Download export
+//	@Description  Download ZIP archive of background export through link sent by email, archive is streamed by the API with support for ranges, so interrupted downloads can be resumed until the link expires
+//	@Tags         document
+//	@Produce      application/zip
+//	@Success      200  {file}    file  "ZIP archive"
+//	@Failure      404  {string}  "Not found or expired"
+//	@Failure      500  {string}  "Internal server error"
+//	@Router       /export/:token [get]
+func (app *application) exportDownloadHandler(w http.ResponseWriter, r *http.Request) {
+	token := httprouter.ParamsFromContext(r.Context()).ByName("token")
+
+	export, err := app.data_access.Exports.GetForToken(token)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			utils.NotFoundResponse(w, r) //? http.StatusNotFound - 404
+		default:
+			utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+		}
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	app.streamBlob(w, r, export.Storage_key, exportFilename, "application/zip", "attachment", export.Created_at)
+}
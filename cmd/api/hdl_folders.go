@@ -0,0 +1,357 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"viadro_api/internal/data"
+	"viadro_api/utils"
+
+	"github.com/charmbracelet/log"
+	"github.com/go-playground/validator/v10"
+)
+
+// readOwnedFolder fetches folder from id parameter, writes error response and returns false
+// when it does not exist or current user is neither its owner nor admin.
+func (app *application) readOwnedFolder(w http.ResponseWriter, r *http.Request) (*data.Folder, bool) {
+	id, err := utils.ReadIDParam(r)
+	if err != nil {
+		utils.NotFoundResponse(w, r) //? http.StatusNotFound - 404
+		return nil, false
+	}
+
+	folder, err := app.data_access.Folders.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			utils.NotFoundResponse(w, r) //? http.StatusNotFound - 404
+		default:
+			utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+		}
+		return nil, false
+	}
+
+	user := app.contextGetUser(r)
+
+	if folder.User_id != user.User_id && !user.Is_admin {
+		utils.NotPermittedResponse(w, r) //? http.StatusForbidden - 403
+		return nil, false
+	}
+
+	return folder, true
+}
+
+// checkTargetFolder verifies that folder_id names a folder of given user, so documents and folders
+// can't be placed into someone else's tree. Writes validation error response and returns false otherwise.
+func (app *application) checkTargetFolder(w http.ResponseWriter, r *http.Request, user_id int, folder_id int) bool {
+	folder, err := app.data_access.Folders.Get(folder_id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			utils.FailedValidationResponse(w, r, map[string]string{"folder_id": "folder does not exist"}) //? http.StatusUnprocessableEntity - 422
+		default:
+			utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+		}
+		return false
+	}
+
+	if folder.User_id != user_id {
+		utils.FailedValidationResponse(w, r, map[string]string{"folder_id": "folder does not exist"}) //? http.StatusUnprocessableEntity - 422
+		return false
+	}
+
+	return true
+}
+
+// Create folder
+//
+//	@Summary      Create folder
+//	@Description  Create folder, optionally nested in another folder of current user
+//	@Tags         folder
+//	@Accept       json
+//	@Produce      json
+//	@Success      201  {object}  data.Folder
+//	@Failure      400  {string}  "Bad json request"
+//	@Failure      401  {string}  "Unauthorized"
+//	@Failure      422  {string}  "Invalid name, parent or duplicate name"
+//	@Failure      500  {string}  "Internal server error"
+//	@Router       /folder [post]
+func (app *application) folderCreateHandler(w http.ResponseWriter, r *http.Request) {
+	input := struct {
+		Name      string `validate:"required,min=1,max=255,excludesall=/" json:"name"`
+		Parent_id *int   `validate:"omitempty,gt=0" json:"parent_id"`
+	}{}
+
+	err := utils.ReadJSON(w, r, &input)
+	if err != nil {
+		utils.BadRequestResponse(w, r, err) //? http.StatusBadRequest - 400
+		return
+	}
+
+	validate := validator.New()
+	err = validate.Struct(input)
+	if err != nil {
+		utils.FailedValidationResponseValidator(w, r, err) //? http.StatusUnprocessableEntity - 422
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	if input.Parent_id != nil && !app.checkTargetFolder(w, r, user.User_id, *input.Parent_id) {
+		return
+	}
+
+	folder := &data.Folder{
+		User_id:   user.User_id,
+		Parent_id: input.Parent_id,
+		Name:      input.Name,
+	}
+
+	err = app.data_access.Folders.Insert(folder)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateFolder):
+			utils.FailedValidationResponse(w, r, map[string]string{"name": "folder with this name already exists here"}) //? http.StatusUnprocessableEntity - 422
+		default:
+			utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+		}
+		return
+	}
+
+	headers := http.Header{}
+	headers.Set("Location", fmt.Sprintf("/v1/folder/%d", folder.Folder_id))
+	headers.Set("ETag", utils.VersionETag(folder.Version))
+
+	err = utils.WriteJSON(w, http.StatusCreated, utils.Wrap{"folder": folder}, headers)
+	if err != nil {
+		utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+	}
+}
+
+// List folders
+//
+//	@Summary      List folders
+//	@Description  List all folders of current user, the tree can be built from their parent_id fields
+//	@Tags         folder
+//	@Produce      json
+//	@Success      200  {array}   data.Folder
+//	@Failure      401  {string}  "Unauthorized"
+//	@Failure      500  {string}  "Internal server error"
+//	@Router       /folders [get]
+func (app *application) folderGetAllHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	folders, err := app.data_access.Folders.GetAll(user.User_id, nil)
+	if err != nil {
+		utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+		return
+	}
+
+	err = utils.WriteJSON(w, http.StatusOK, utils.Wrap{"folders": folders}, nil)
+	if err != nil {
+		utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+	}
+}
+
+// Get folder contents
+//
+//	@Summary      Get folder contents
+//	@Description  Get folder with its direct subfolders and a page of its documents
+//	@Tags         folder
+//	@Produce      json
+//	@Success      200  {object}  data.Folder
+//	@Failure      401  {string}  "Unauthorized"
+//	@Failure      403  {string}  "Forbidden"
+//	@Failure      404  {string}  "Not found"
+//	@Failure      422  {string}  "Invalid filters"
+//	@Failure      500  {string}  "Internal server error"
+//	@Router       /folder/:id [get]
+func (app *application) folderGetHandler(w http.ResponseWriter, r *http.Request) {
+	folder, ok := app.readOwnedFolder(w, r)
+	if !ok {
+		return
+	}
+
+	qs := r.URL.Query()
+
+	filters := data.Filters{
+		Page:         utils.ReadIntParam(qs, "page", 1),
+		PageSize:     utils.ReadIntParam(qs, "page_size", 20),
+		Sort:         utils.ReadStringParam(qs, "sort", "document_id"),
+		SortSafelist: []string{"document_id", "-document_id", "title", "-title"},
+	}
+
+	folders, err := app.data_access.Folders.GetAll(folder.User_id, &folder.Folder_id)
+	if err != nil {
+		utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+		return
+	}
+
+	documents, metadata, err := app.data_access.Documents.GetAllInFolder(folder.Folder_id, filters)
+	if err != nil {
+		utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+		return
+	}
+
+	headers := http.Header{}
+	headers.Set("ETag", utils.VersionETag(folder.Version))
+
+	err = utils.WriteJSON(w, http.StatusOK, utils.Wrap{"folder": folder, "folders": folders, "metadata": metadata, "documents": documents}, headers)
+	if err != nil {
+		utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+	}
+}
+
+// Rename or move folder
+//
+//	@Summary      Rename or move folder
+//	@Description  Rename folder or move it under another folder, parent_id 0 moves folder to the top level
+//	@Tags         folder
+//	@Accept       json
+//	@Produce      json
+//	@Success      200  {object}  data.Folder
+//	@Failure      400  {string}  "Bad json request"
+//	@Failure      401  {string}  "Unauthorized"
+//	@Failure      403  {string}  "Forbidden"
+//	@Failure      404  {string}  "Not found"
+//	@Failure      409  {string}  "Edit conflict"
+//	@Failure      412  {string}  "If-Match precondition failed"
+//	@Failure      422  {string}  "Invalid name, parent or duplicate name"
+//	@Failure      500  {string}  "Internal server error"
+//	@Router       /folder/:id [patch]
+func (app *application) folderUpdateHandler(w http.ResponseWriter, r *http.Request) {
+	folder, ok := app.readOwnedFolder(w, r)
+	if !ok {
+		return
+	}
+
+	if !utils.IfMatch(r, utils.VersionETag(folder.Version)) {
+		utils.PreconditionFailedResponse(w, r) //? http.StatusPreconditionFailed - 412
+		return
+	}
+
+	input := struct {
+		Name      *string `validate:"omitempty,min=1,max=255,excludesall=/" json:"name"`
+		Parent_id *int    `validate:"omitempty,gte=0" json:"parent_id"`
+	}{}
+
+	err := utils.ReadJSON(w, r, &input)
+	if err != nil {
+		utils.BadRequestResponse(w, r, err) //? http.StatusBadRequest - 400
+		return
+	}
+
+	validate := validator.New()
+	err = validate.Struct(input)
+	if err != nil {
+		utils.FailedValidationResponseValidator(w, r, err) //? http.StatusUnprocessableEntity - 422
+		return
+	}
+
+	if input.Name != nil {
+		folder.Name = *input.Name
+	}
+	if input.Parent_id != nil {
+		if *input.Parent_id == 0 {
+			folder.Parent_id = nil
+		} else {
+			if !app.checkTargetFolder(w, r, folder.User_id, *input.Parent_id) {
+				return
+			}
+			folder.Parent_id = input.Parent_id
+		}
+	}
+
+	err = app.data_access.Folders.Update(folder)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			utils.EditConflictResponse(w, r) //? http.StatusConflict - 409
+		case errors.Is(err, data.ErrFolderCycle):
+			utils.FailedValidationResponse(w, r, map[string]string{"parent_id": "folder can't be moved into itself or its subfolder"}) //? http.StatusUnprocessableEntity - 422
+		case errors.Is(err, data.ErrDuplicateFolder):
+			utils.FailedValidationResponse(w, r, map[string]string{"name": "folder with this name already exists here"}) //? http.StatusUnprocessableEntity - 422
+		default:
+			utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+		}
+		return
+	}
+
+	headers := http.Header{}
+	headers.Set("ETag", utils.VersionETag(folder.Version))
+
+	err = utils.WriteJSON(w, http.StatusOK, utils.Wrap{"folder": folder}, headers)
+	if err != nil {
+		utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+	}
+}
+
+// Delete folder
+//
+//	@Summary      Delete folder
+//	@Description  Delete empty folder, folder with contents is deleted only with recursive=true, deleting all of its subfolders and moving its documents to trash
+//	@Tags         folder
+//	@Produce      json
+//	@Success      200  {string}  "Successfully deleted"
+//	@Failure      401  {string}  "Unauthorized"
+//	@Failure      403  {string}  "Forbidden"
+//	@Failure      404  {string}  "Not found"
+//	@Failure      409  {string}  "Folder not empty or edit conflict"
+//	@Failure      412  {string}  "If-Match precondition failed"
+//	@Failure      500  {string}  "Internal server error"
+//	@Router       /folder/:id [delete]
+func (app *application) folderDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	folder, ok := app.readOwnedFolder(w, r)
+	if !ok {
+		return
+	}
+
+	if !utils.IfMatch(r, utils.VersionETag(folder.Version)) {
+		utils.PreconditionFailedResponse(w, r) //? http.StatusPreconditionFailed - 412
+		return
+	}
+
+	recursive := utils.ReadStringParam(r.URL.Query(), "recursive", "false") == "true"
+
+	var err error
+	if recursive {
+		err = app.data_access.Folders.DeleteWithDocuments(folder.Folder_id, folder.Version)
+	} else {
+		var empty bool
+		empty, err = app.data_access.Folders.IsEmpty(folder.Folder_id)
+		if err != nil {
+			utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+			return
+		}
+		if !empty {
+			utils.FolderNotEmptyResponse(w, r) //? http.StatusConflict - 409
+			return
+		}
+
+		//? subfolders are deleted with their parent, documents moved in meanwhile and trashed ones end up at the top level
+		err = app.data_access.Folders.Delete(folder.Folder_id, folder.Version)
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			utils.EditConflictResponse(w, r) //? http.StatusConflict - 409
+		default:
+			utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+		}
+		return
+	}
+
+	err = utils.WriteJSON(w, http.StatusOK, utils.Wrap{"message": "folder successfully deleted"}, nil)
+	if err != nil {
+		utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+	}
+
+	if recursive {
+		err = app.redis_client.FlushAll(context.TODO()).Err()
+		if err != nil {
+			log.Error("Failed flushing cache", err)
+		}
+	}
+}
@@ -0,0 +1,569 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"viadro_api/internal/data"
+	"viadro_api/internal/pdf"
+	"viadro_api/utils"
+
+	"github.com/charmbracelet/log"
+	"github.com/go-playground/validator/v10"
+)
+
+// jobRetention is how long finished jobs can be looked up, documents they created are kept like any other.
+const jobRetention = 7 * 24 * time.Hour
+
+// jobFailure is an error whose reason is safe to show to the user in job status, other errors are only logged.
+type jobFailure struct {
+	reason string
+}
+
+func (f jobFailure) Error() string {
+	return f.reason
+}
+
+// authorizeSources checks that user can view every source document of PDF operation and that all of them are PDFs
+// user gets unstamped, sources are returned in the order of ids, which may repeat. Reasons of rejected documents are keyed by their ids.
+func (app *application) authorizeSources(user *data.User, ids []int) ([]*data.Document, map[string]string, error) {
+	documents, results, err := app.authorizeSelection(user, ids, accessView, func(document *data.Document) string {
+		if document.Filetype != utils.FiletypePDF {
+			return "not a PDF document"
+		}
+		//? results are stored without watermark, so only those who get the original may use watermarked sources
+		watermark, err := app.watermarkFor(user, document)
+		if err != nil {
+			log.Error(fmt.Sprintf("failed resolving watermark of document %d", document.Document_id), err)
+			return "can't be used right now"
+		}
+		if watermark != nil {
+			return "watermarked, only its editors can use it"
+		}
+		return ""
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rejected := map[string]string{}
+	for _, result := range results {
+		if !result.Ok {
+			rejected[fmt.Sprintf("document %d", result.Document_id)] = result.Error
+		}
+	}
+	if len(rejected) > 0 {
+		return nil, rejected, nil
+	}
+
+	found := map[int]*data.Document{}
+	for _, document := range documents {
+		found[document.Document_id] = document
+	}
+
+	sources := make([]*data.Document, 0, len(ids))
+	for _, id := range ids {
+		sources = append(sources, found[id])
+	}
+
+	return sources, nil, nil
+}
+
+// startJob registers PDF operation and runs it in background, client is pointed to its status.
+func (app *application) startJob(w http.ResponseWriter, r *http.Request, job *data.Job) {
+	err := app.data_access.Jobs.Insert(job)
+	if err != nil {
+		utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+		return
+	}
+
+	app.background(func() {
+		app.runJob(job)
+	})
+
+	headers := http.Header{}
+	headers.Set("Location", fmt.Sprintf("/v1/jobs/%d", job.Job_id))
+
+	err = utils.WriteJSON(w, http.StatusAccepted, utils.Wrap{"job": job}, headers)
+	if err != nil {
+		utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+	}
+}
+
+// runJob performs PDF operation and records its outcome, documents created before a failure are kept and reported.
+func (app *application) runJob(job *data.Job) {
+	err := app.data_access.Jobs.Start(job)
+	if err != nil {
+		log.Error(fmt.Sprintf("failed starting job %d", job.Job_id), err)
+		return
+	}
+
+	results, err := app.performJob(job)
+
+	message := ""
+	if err != nil {
+		var failure jobFailure
+		switch {
+		case errors.As(err, &failure):
+			message = failure.reason
+		default:
+			log.Error(fmt.Sprintf("job %d failed", job.Job_id), err)
+			message = "internal server error"
+		}
+	}
+
+	result_ids := []int{}
+	for _, document := range results {
+		result_ids = append(result_ids, document.Document_id)
+	}
+
+	err = app.data_access.Jobs.Finish(job, result_ids, message)
+	if err != nil {
+		log.Error(fmt.Sprintf("failed finishing job %d", job.Job_id), err)
+	}
+
+	if len(results) > 0 {
+		err = app.redis_client.FlushAll(context.TODO()).Err()
+		if err != nil {
+			log.Error("Failed flushing cache", err)
+		}
+	}
+}
+
+func (app *application) performJob(job *data.Job) ([]*data.Document, error) {
+	user, err := app.data_access.Users.GetById(job.User_id)
+	if err != nil {
+		return nil, err
+	}
+
+	//? access is checked again, sources could have been deleted or unshared since the job was requested
+	sources, rejected, err := app.authorizeSources(user, job.Document_ids)
+	if err != nil {
+		return nil, err
+	}
+	if len(rejected) > 0 {
+		reasons := []string{}
+		for key, reason := range rejected {
+			reasons = append(reasons, fmt.Sprintf("%s: %s", key, reason))
+		}
+		sort.Strings(reasons)
+		return nil, jobFailure{reason: strings.Join(reasons, ", ")}
+	}
+
+	files := []*os.File{}
+	defer func() {
+		for _, file := range files {
+			removeTemp(file)
+		}
+	}()
+
+	for _, source := range sources {
+		file, _, err := app.fetchTemp(source.Storage_key)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+
+	results := []*data.Document{}
+
+	switch job.Operation {
+	case data.JobMerge:
+		readers := []io.ReadSeeker{}
+		for _, file := range files {
+			readers = append(readers, file)
+		}
+
+		document, err := app.storeJobResult(user, sources, job.Title, func(out io.Writer) error {
+			return pdf.Merge(readers, out)
+		})
+		if err != nil {
+			return results, err
+		}
+		results = append(results, document)
+
+	case data.JobSplit, data.JobExtract:
+		for _, selection := range job.Pages {
+			ranges, err := pdf.ParsePages(selection)
+			if err != nil {
+				return results, err
+			}
+
+			title := job.Title
+			if title == "" || job.Operation == data.JobSplit {
+				title = fmt.Sprintf("%s (pages %s).pdf", strings.TrimSuffix(sources[0].Title, ".pdf"), selection)
+			}
+
+			_, err = files[0].Seek(0, io.SeekStart)
+			if err != nil {
+				return results, err
+			}
+
+			document, err := app.storeJobResult(user, sources, title, func(out io.Writer) error {
+				return pdf.SelectPages(files[0], out, ranges)
+			})
+			if err != nil {
+				return results, err
+			}
+			results = append(results, document)
+		}
+
+	default:
+		return nil, fmt.Errorf("unknown job operation %q", job.Operation)
+	}
+
+	return results, nil
+}
+
+// storeJobResult stores PDF written by write as a new document of user, through the same path as uploads. Document
+// inherits tags of its sources, it's hidden when any of them is and lands in folder of the first one when user owns it.
+func (app *application) storeJobResult(user *data.User, sources []*data.Document, title string, write func(out io.Writer) error) (*data.Document, error) {
+	out, err := os.CreateTemp("", "viadro-job-*")
+	if err != nil {
+		return nil, err
+	}
+	defer removeTemp(out)
+
+	err = write(out)
+	if err != nil {
+		switch {
+		case errors.Is(err, pdf.ErrEncrypted), errors.Is(err, pdf.ErrPageRange), errors.Is(err, pdf.ErrMalformed):
+			return nil, jobFailure{reason: err.Error()}
+		default:
+			return nil, err
+		}
+	}
+
+	size, err := out.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	if size > app.uploadLimit(user) {
+		return nil, jobFailure{reason: fmt.Sprintf("result of %d bytes exceeds your upload limit", size)}
+	}
+
+	_, err = out.Seek(0, io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+
+	blob, metadata, local, err := app.storeFile(user.User_id, out, title, utils.FiletypePDF)
+	if err != nil {
+		if errors.Is(err, pdf.ErrMalformed) {
+			return nil, jobFailure{reason: err.Error()}
+		}
+		return nil, err
+	}
+
+	document := &data.Document{
+		User_id:      user.User_id,
+		Filetype:     utils.FiletypePDF,
+		Title:        title,
+		Storage_key:  blob.Storage_key,
+		Checksum:     blob.Checksum,
+		Url_s3:       blob.Location,
+		Tags:         []string{},
+		FileMetadata: metadata,
+	}
+
+	ids := []string{}
+	seen_ids := map[int]bool{}
+	seen_tags := map[string]bool{}
+	for _, source := range sources {
+		document.Is_hidden = document.Is_hidden || source.Is_hidden
+
+		if !seen_ids[source.Document_id] {
+			seen_ids[source.Document_id] = true
+			ids = append(ids, strconv.Itoa(source.Document_id))
+		}
+
+		for _, tag := range source.Tags {
+			if !seen_tags[tag] {
+				seen_tags[tag] = true
+				document.Tags = append(document.Tags, tag)
+			}
+		}
+	}
+	document.Description = fmt.Sprintf("Created from document %s", strings.Join(ids, ", "))
+
+	if sources[0].User_id == user.User_id {
+		document.Folder_id = sources[0].Folder_id
+	}
+
+	err = app.data_access.Documents.Insert(document)
+	if err != nil {
+		removeTemp(local)
+		app.releaseBlob(blob.Storage_key)
+		return nil, err
+	}
+
+	app.processDocument(document, local)
+
+	return document, nil
+}
+
+// failInterruptedJobs fails jobs which were left unfinished when the server stopped without waiting for them.
+func (app *application) failInterruptedJobs() {
+	failed, err := app.data_access.Jobs.FailUnfinished()
+	if err != nil {
+		log.Error("failed updating interrupted jobs", err)
+		return
+	}
+
+	if failed > 0 {
+		log.Info(fmt.Sprintf("failed %d interrupted jobs", failed))
+	}
+}
+
+// removeFinishedJobs deletes jobs which finished longer than retention ago.
+func (app *application) removeFinishedJobs() {
+	removed, err := app.data_access.Jobs.DeleteFinished(time.Now().Add(-jobRetention))
+	if err != nil {
+		log.Error("failed deleting finished jobs", err)
+		return
+	}
+
+	if removed > 0 {
+		log.Info(fmt.Sprintf("removed %d finished jobs", removed))
+	}
+}
+
+// Merge documents
+//
+//	@Summary      Merge documents
+//	@Description  Merge PDF documents, in the given order (ids may repeat), into a new document of current user. Merging runs in background, the response points to job whose status tells when it's done and which document was created. New document inherits tags of merged ones
+//	@Tags         job
+//	@Accept       json
+//	@Produce      json
+//	@Success      202  {object}  data.Job
+//	@Failure      400  {string}  "Bad json request"
+//	@Failure      401  {string}  "Unauthorized"
+//	@Failure      422  {string}  "Invalid input, documents which can't be merged are listed"
+//	@Failure      500  {string}  "Internal server error"
+//	@Router       /documents/merge [post]
+func (app *application) documentMergeHandler(w http.ResponseWriter, r *http.Request) {
+	input := struct {
+		Ids   []int  `validate:"required,min=2,max=50,dive,gt=0" json:"ids"`
+		Title string `validate:"omitempty,max=255,excludesall=/" json:"title"`
+	}{}
+
+	err := utils.ReadJSON(w, r, &input)
+	if err != nil {
+		utils.BadRequestResponse(w, r, err) //? http.StatusBadRequest - 400
+		return
+	}
+
+	validate := validator.New()
+	err = validate.Struct(input)
+	if err != nil {
+		utils.FailedValidationResponseValidator(w, r, err) //? http.StatusUnprocessableEntity - 422
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	_, rejected, err := app.authorizeSources(user, input.Ids)
+	if err != nil {
+		utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+		return
+	}
+	if len(rejected) > 0 {
+		utils.FailedValidationResponse(w, r, rejected) //? http.StatusUnprocessableEntity - 422
+		return
+	}
+
+	if input.Title == "" {
+		input.Title = "merged.pdf"
+	}
+
+	app.startJob(w, r, &data.Job{
+		User_id:      user.User_id,
+		Operation:    data.JobMerge,
+		Document_ids: input.Ids,
+		Pages:        []string{},
+		Title:        input.Title,
+	})
+}
+
+// readPDFSource reads document from URL and page selections for operation on it, selections are returned normalized.
+// Error response is written and false returned when operation can't be requested.
+func (app *application) readPDFSource(w http.ResponseWriter, r *http.Request, selections []string) (*data.Document, []string, bool) {
+	document, ok := app.readDocument(w, r, accessView)
+	if !ok {
+		return nil, nil, false
+	}
+
+	if document.Filetype != utils.FiletypePDF {
+		utils.FailedValidationResponse(w, r, map[string]string{"document": "not a PDF document"}) //? http.StatusUnprocessableEntity - 422
+		return nil, nil, false
+	}
+
+	//? page count is known only for inspected documents, others are checked once the job reads them
+	normalized := []string{}
+	for _, selection := range selections {
+		ranges, err := pdf.ParsePages(selection)
+		if err == nil && document.Page_count != nil {
+			for _, page_range := range ranges {
+				if page_range.From > *document.Page_count || page_range.To > *document.Page_count {
+					err = fmt.Errorf("%w: %s, document has %d pages", pdf.ErrPageRange, page_range, *document.Page_count)
+					break
+				}
+			}
+		}
+		if err != nil {
+			utils.FailedValidationResponse(w, r, map[string]string{"pages": err.Error()}) //? http.StatusUnprocessableEntity - 422
+			return nil, nil, false
+		}
+		normalized = append(normalized, pdf.FormatPages(ranges))
+	}
+
+	return document, normalized, true
+}
+
+// Split document
+//
+//	@Summary      Split document
+//	@Description  Split PDF document into new documents of current user, one per page selection in ranges (like "1-3", "4-" or "1,5-6"). Splitting runs in background, the response points to job whose status lists created documents. New documents inherit tags of the split one
+//	@Tags         job
+//	@Accept       json
+//	@Produce      json
+//	@Success      202  {object}  data.Job
+//	@Failure      400  {string}  "Bad json request"
+//	@Failure      401  {string}  "Unauthorized"
+//	@Failure      403  {string}  "Forbidden"
+//	@Failure      404  {string}  "Not found"
+//	@Failure      422  {string}  "Invalid page ranges or not a PDF"
+//	@Failure      500  {string}  "Internal server error"
+//	@Router       /document/:id/split [post]
+func (app *application) documentSplitHandler(w http.ResponseWriter, r *http.Request) {
+	input := struct {
+		Ranges []string `validate:"required,min=1,max=100,dive,required" json:"ranges"`
+	}{}
+
+	err := utils.ReadJSON(w, r, &input)
+	if err != nil {
+		utils.BadRequestResponse(w, r, err) //? http.StatusBadRequest - 400
+		return
+	}
+
+	validate := validator.New()
+	err = validate.Struct(input)
+	if err != nil {
+		utils.FailedValidationResponseValidator(w, r, err) //? http.StatusUnprocessableEntity - 422
+		return
+	}
+
+	document, ranges, ok := app.readPDFSource(w, r, input.Ranges)
+	if !ok {
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	app.startJob(w, r, &data.Job{
+		User_id:      user.User_id,
+		Operation:    data.JobSplit,
+		Document_ids: []int{document.Document_id},
+		Pages:        ranges,
+	})
+}
+
+// Extract pages
+//
+//	@Summary      Extract pages
+//	@Description  Extract selected pages of PDF document (like "1-3,5,8-", in the given order) into a new document of current user. Extraction runs in background, the response points to job whose status tells which document was created. New document inherits tags of the source one
+//	@Tags         job
+//	@Accept       json
+//	@Produce      json
+//	@Success      202  {object}  data.Job
+//	@Failure      400  {string}  "Bad json request"
+//	@Failure      401  {string}  "Unauthorized"
+//	@Failure      403  {string}  "Forbidden"
+//	@Failure      404  {string}  "Not found"
+//	@Failure      422  {string}  "Invalid pages or not a PDF"
+//	@Failure      500  {string}  "Internal server error"
+//	@Router       /document/:id/extract [post]
+func (app *application) documentExtractHandler(w http.ResponseWriter, r *http.Request) {
+	input := struct {
+		Pages string `validate:"required" json:"pages"`
+		Title string `validate:"omitempty,max=255,excludesall=/" json:"title"`
+	}{}
+
+	err := utils.ReadJSON(w, r, &input)
+	if err != nil {
+		utils.BadRequestResponse(w, r, err) //? http.StatusBadRequest - 400
+		return
+	}
+
+	validate := validator.New()
+	err = validate.Struct(input)
+	if err != nil {
+		utils.FailedValidationResponseValidator(w, r, err) //? http.StatusUnprocessableEntity - 422
+		return
+	}
+
+	document, pages, ok := app.readPDFSource(w, r, []string{input.Pages})
+	if !ok {
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	app.startJob(w, r, &data.Job{
+		User_id:      user.User_id,
+		Operation:    data.JobExtract,
+		Document_ids: []int{document.Document_id},
+		Pages:        pages,
+		Title:        input.Title,
+	})
+}
+
+// Get job status
+//
+//	@Summary      Get job status
+//	@Description  Get status of merge, split or extract job of current user, result_ids list documents the job created
+//	@Tags         job
+//	@Produce      json
+//	@Success      200  {object}  data.Job
+//	@Failure      401  {string}  "Unauthorized"
+//	@Failure      404  {string}  "Not found"
+//	@Failure      500  {string}  "Internal server error"
+//	@Router       /jobs/:id [get]
+func (app *application) jobGetHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := utils.ReadIDParam(r)
+	if err != nil {
+		utils.NotFoundResponse(w, r) //? http.StatusNotFound - 404
+		return
+	}
+
+	job, err := app.data_access.Jobs.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			utils.NotFoundResponse(w, r) //? http.StatusNotFound - 404
+		default:
+			utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+		}
+		return
+	}
+
+	//? jobs of other users are not revealed to exist
+	user := app.contextGetUser(r)
+	if job.User_id != user.User_id {
+		utils.NotFoundResponse(w, r) //? http.StatusNotFound - 404
+		return
+	}
+
+	err = utils.WriteJSON(w, http.StatusOK, utils.Wrap{"job": job}, nil)
+	if err != nil {
+		utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+	}
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"viadro_api/internal/data"
+	"viadro_api/utils"
+
+	"github.com/go-playground/validator/v10"
+)
+
+type documentAccess int
+
+const (
+	accessView   documentAccess = iota // read document and its revisions
+	accessEdit                         // change metadata and upload or restore revisions
+	accessManage                       // delete, change visibility, shares and permissions
+)
+
+// authorizeDocument is the single place deciding what user may do with document. Owner and admins may do
+// anything, public documents can be viewed by everyone and granted permissions allow viewing or editing.
+func (app *application) authorizeDocument(user *data.User, document *data.Document, access documentAccess) (bool, error) {
+	if user.IsAnonymous() {
+		return access == accessView && !document.Is_hidden, nil
+	}
+
+	if document.User_id == user.User_id || user.Is_admin {
+		return true, nil
+	}
+
+	if access == accessManage {
+		return false, nil
+	}
+
+	if access == accessView && !document.Is_hidden {
+		return true, nil
+	}
+
+	role, err := app.data_access.Permissions.GetRole(document.Document_id, user.User_id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			return false, nil
+		default:
+			return false, err
+		}
+	}
+
+	return access == accessView || role == data.RoleEdit, nil
+}
+
+// readDocument fetches document from id parameter and authorizes current user for access, writes error response
+// and returns false when it can't be used. Changes additionally check If-Match header against document's version.
+func (app *application) readDocument(w http.ResponseWriter, r *http.Request, access documentAccess) (*data.Document, bool) {
+	id, err := utils.ReadIDParam(r)
+	if err != nil {
+		utils.NotFoundResponse(w, r) //? http.StatusNotFound - 404
+		return nil, false
+	}
+
+	document, err := app.data_access.Documents.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			utils.NotFoundResponse(w, r) //? http.StatusNotFound - 404
+		default:
+			utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+		}
+		return nil, false
+	}
+
+	if !app.checkDocumentAccess(w, r, document, access) {
+		return nil, false
+	}
+
+	return document, true
+}
+
+// readDeletedDocument is like readDocument for documents in trash, only those who can manage document may touch it there.
+func (app *application) readDeletedDocument(w http.ResponseWriter, r *http.Request) (*data.Document, bool) {
+	id, err := utils.ReadIDParam(r)
+	if err != nil {
+		utils.NotFoundResponse(w, r) //? http.StatusNotFound - 404
+		return nil, false
+	}
+
+	document, err := app.data_access.Documents.GetDeleted(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			utils.NotFoundResponse(w, r) //? http.StatusNotFound - 404
+		default:
+			utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+		}
+		return nil, false
+	}
+
+	if !app.checkDocumentAccess(w, r, document, accessManage) {
+		return nil, false
+	}
+
+	return document, true
+}
+
+// checkDocumentAccess authorizes current user for access to document, writes error response and returns false when denied.
+func (app *application) checkDocumentAccess(w http.ResponseWriter, r *http.Request, document *data.Document, access documentAccess) bool {
+	user := app.contextGetUser(r)
+
+	allowed, err := app.authorizeDocument(user, document, access)
+	if err != nil {
+		utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+		return false
+	}
+	if !allowed {
+		if user.IsAnonymous() {
+			utils.AuthenticationRequiredResponse(w, r) //? http.StatusUnauthorized - 401
+		} else {
+			utils.NotPermittedResponse(w, r) //? http.StatusForbidden - 403
+		}
+		return false
+	}
+
+	if access != accessView && !utils.IfMatch(r, utils.VersionETag(document.Version)) {
+		utils.PreconditionFailedResponse(w, r) //? http.StatusPreconditionFailed - 412
+		return false
+	}
+
+	return true
+}
+
+// Grant document permission
+//
+//	@Summary      Grant document permission
+//	@Description  Grant user read or edit rights on document, role of user who already has access is replaced
+//	@Tags         permission
+//	@Accept       json
+//	@Produce      json
+//	@Success      200  {object}  data.Permission
+//	@Failure      400  {string}  "Bad json request"
+//	@Failure      401  {string}  "Unauthorized"
+//	@Failure      403  {string}  "Forbidden"
+//	@Failure      404  {string}  "Not found"
+//	@Failure      412  {string}  "If-Match precondition failed"
+//	@Failure      422  {string}  "Invalid user or role"
+//	@Failure      500  {string}  "Internal server error"
+//	@Router       /document/:id/permissions [post]
+func (app *application) permissionGrantHandler(w http.ResponseWriter, r *http.Request) {
+	document, ok := app.readDocument(w, r, accessManage)
+	if !ok {
+		return
+	}
+
+	input := struct {
+		User_id int    `validate:"required,gt=0" json:"user_id"`
+		Role    string `validate:"required,oneof=read edit" json:"role"`
+	}{}
+
+	err := utils.ReadJSON(w, r, &input)
+	if err != nil {
+		utils.BadRequestResponse(w, r, err) //? http.StatusBadRequest - 400
+		return
+	}
+
+	validate := validator.New()
+	err = validate.Struct(input)
+	if err != nil {
+		utils.FailedValidationResponseValidator(w, r, err) //? http.StatusUnprocessableEntity - 422
+		return
+	}
+
+	if input.User_id == document.User_id {
+		utils.FailedValidationResponse(w, r, map[string]string{"user_id": "owner already has full access"}) //? http.StatusUnprocessableEntity - 422
+		return
+	}
+
+	_, err = app.data_access.Users.GetById(input.User_id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			utils.FailedValidationResponse(w, r, map[string]string{"user_id": "user does not exist"}) //? http.StatusUnprocessableEntity - 422
+		default:
+			utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+		}
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	permission := &data.Permission{
+		Document_id: document.Document_id,
+		User_id:     input.User_id,
+		Role:        input.Role,
+		Granted_by:  &user.User_id,
+	}
+
+	err = app.data_access.Permissions.Grant(permission)
+	if err != nil {
+		utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+		return
+	}
+
+	err = utils.WriteJSON(w, http.StatusOK, utils.Wrap{"permission": permission}, nil)
+	if err != nil {
+		utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+	}
+}
+
+// List document permissions
+//
+//	@Summary      List document permissions
+//	@Description  List users granted access to document and their roles
+//	@Tags         permission
+//	@Produce      json
+//	@Success      200  {array}   data.Permission
+//	@Failure      401  {string}  "Unauthorized"
+//	@Failure      403  {string}  "Forbidden"
+//	@Failure      404  {string}  "Not found"
+//	@Failure      500  {string}  "Internal server error"
+//	@Router       /document/:id/permissions [get]
+func (app *application) permissionGetAllHandler(w http.ResponseWriter, r *http.Request) {
+	document, ok := app.readDocument(w, r, accessManage)
+	if !ok {
+		return
+	}
+
+	permissions, err := app.data_access.Permissions.GetAllForDocument(document.Document_id)
+	if err != nil {
+		utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+		return
+	}
+
+	err = utils.WriteJSON(w, http.StatusOK, utils.Wrap{"permissions": permissions}, nil)
+	if err != nil {
+		utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+	}
+}
+
+// Revoke document permission
+//
+//	@Summary      Revoke document permission
+//	@Description  Revoke access to document granted to user
+//	@Tags         permission
+//	@Produce      json
+//	@Success      200  {string}  "Successfully revoked"
+//	@Failure      401  {string}  "Unauthorized"
+//	@Failure      403  {string}  "Forbidden"
+//	@Failure      404  {string}  "Not found"
+//	@Failure      412  {string}  "If-Match precondition failed"
+//	@Failure      500  {string}  "Internal server error"
+//	@Router       /document/:id/permissions/:user [delete]
+func (app *application) permissionRevokeHandler(w http.ResponseWriter, r *http.Request) {
+	user_id, err := utils.ReadNamedIDParam(r, "user")
+	if err != nil {
+		utils.NotFoundResponse(w, r) //? http.StatusNotFound - 404
+		return
+	}
+
+	document, ok := app.readDocument(w, r, accessManage)
+	if !ok {
+		return
+	}
+
+	err = app.data_access.Permissions.Revoke(document.Document_id, user_id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			utils.NotFoundResponse(w, r) //? http.StatusNotFound - 404
+		default:
+			utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+		}
+		return
+	}
+
+	err = utils.WriteJSON(w, http.StatusOK, utils.Wrap{"message": "permission successfully revoked"}, nil)
+	if err != nil {
+		utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+	}
+}
@@ -0,0 +1,352 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"viadro_api/internal/data"
+	"viadro_api/internal/storage"
+	"viadro_api/utils"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	// shareMaxFailedAttempts wrong passwords in a row lock protected share link for shareLockout.
+	shareMaxFailedAttempts = 5
+	shareLockout           = 15 * time.Minute
+)
+
+func shareLink(token string) string {
+	return fmt.Sprintf("/v1/share/%s", token)
+}
+
+// Create share link
+//
+//	@Summary      Create share link
+//	@Description  Create link giving access to document without an account, optionally expiring, limited to number of downloads and protected with password. Watermark (see document watermark) is stamped on downloads through the link in place of document's own one
+//	@Tags         share
+//	@Accept       json
+//	@Produce      json
+//	@Success      201  {object}  data.Share
+//	@Failure      400  {string}  "Bad json request"
+//	@Failure      401  {string}  "Unauthorized"
+//	@Failure      403  {string}  "Forbidden"
+//	@Failure      404  {string}  "Not found"
+//	@Failure      422  {string}  "Invalid share parameters"
+//	@Failure      500  {string}  "Internal server error"
+//	@Router       /document/:id/shares [post]
+func (app *application) shareCreateHandler(w http.ResponseWriter, r *http.Request) {
+	document, ok := app.readDocument(w, r, accessManage)
+	if !ok {
+		return
+	}
+
+	input := struct {
+		Expiry        *time.Time      `json:"expiry"`
+		Max_downloads *int            `validate:"omitempty,gt=0" json:"max_downloads"`
+		Password      *string         `validate:"omitempty,min=8,max=72" json:"password"`
+		Watermark     *watermarkInput `json:"watermark"`
+	}{}
+
+	err := utils.ReadJSON(w, r, &input)
+	if err != nil {
+		utils.BadRequestResponse(w, r, err) //? http.StatusBadRequest - 400
+		return
+	}
+
+	validate := validator.New()
+	err = validate.Struct(input)
+	if err != nil {
+		utils.FailedValidationResponseValidator(w, r, err) //? http.StatusUnprocessableEntity - 422
+		return
+	}
+
+	if input.Expiry != nil && input.Expiry.Before(time.Now()) {
+		utils.FailedValidationResponse(w, r, map[string]string{"expiry": "must be in the future"}) //? http.StatusUnprocessableEntity - 422
+		return
+	}
+
+	if input.Watermark != nil && (document.Filetype != utils.FiletypePDF || document.Is_encrypted) {
+		utils.FailedValidationResponse(w, r, map[string]string{"watermark": "only PDFs without password can be watermarked"}) //? http.StatusUnprocessableEntity - 422
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	share := &data.Share{
+		Document_id:   document.Document_id,
+		User_id:       user.User_id,
+		Expiry:        input.Expiry,
+		Max_downloads: input.Max_downloads,
+		Watermark:     input.Watermark.watermark(),
+	}
+
+	if input.Password != nil {
+		err = share.Password.Set(*input.Password)
+		if err != nil {
+			utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+			return
+		}
+	}
+
+	err = app.data_access.Shares.New(share)
+	if err != nil {
+		utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+		return
+	}
+
+	headers := http.Header{}
+	headers.Set("Location", shareLink(share.Plaintext))
+
+	err = utils.WriteJSON(w, http.StatusCreated, utils.Wrap{"share": share, "link": shareLink(share.Plaintext)}, headers)
+	if err != nil {
+		utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+	}
+}
+
+// List share links
+//
+//	@Summary      List share links
+//	@Description  List share links of document, tokens themselves are not stored so they can't be listed
+//	@Tags         share
+//	@Produce      json
+//	@Success      200  {array}   data.Share
+//	@Failure      401  {string}  "Unauthorized"
+//	@Failure      403  {string}  "Forbidden"
+//	@Failure      404  {string}  "Not found"
+//	@Failure      500  {string}  "Internal server error"
+//	@Router       /document/:id/shares [get]
+func (app *application) shareGetAllHandler(w http.ResponseWriter, r *http.Request) {
+	document, ok := app.readDocument(w, r, accessManage)
+	if !ok {
+		return
+	}
+
+	shares, err := app.data_access.Shares.GetAllForDocument(document.Document_id)
+	if err != nil {
+		utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+		return
+	}
+
+	err = utils.WriteJSON(w, http.StatusOK, utils.Wrap{"shares": shares}, nil)
+	if err != nil {
+		utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+	}
+}
+
+// Revoke share link
+//
+//	@Summary      Revoke share link
+//	@Description  Revoke share link, it stops working immediately
+//	@Tags         share
+//	@Produce      json
+//	@Success      200  {string}  "Successfully revoked"
+//	@Failure      401  {string}  "Unauthorized"
+//	@Failure      403  {string}  "Forbidden"
+//	@Failure      404  {string}  "Not found"
+//	@Failure      500  {string}  "Internal server error"
+//	@Router       /document/:id/shares/:share [delete]
+func (app *application) shareDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	share_id, err := utils.ReadNamedIDParam(r, "share")
+	if err != nil {
+		utils.NotFoundResponse(w, r) //? http.StatusNotFound - 404
+		return
+	}
+
+	document, ok := app.readDocument(w, r, accessManage)
+	if !ok {
+		return
+	}
+
+	err = app.data_access.Shares.Delete(share_id, document.Document_id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			utils.NotFoundResponse(w, r) //? http.StatusNotFound - 404
+		default:
+			utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+		}
+		return
+	}
+
+	err = utils.WriteJSON(w, http.StatusOK, utils.Wrap{"message": "share link successfully revoked"}, nil)
+	if err != nil {
+		utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+	}
+}
+
+// Open share link
+//
+//	@Summary      Open share link
+//	@Description  Redirect to short-lived link to shared document's content, password of protected link is sent in X-Share-Password header, or in password field of form posted to the link by browsers. After 5 wrong passwords in a row the link is locked for 15 minutes. Watermarked links and documents are stamped and served directly, {user} in text of document's watermark names the link. Encrypted documents are decrypted and served directly, ranges of up to 1MB past the first byte fetched by viewers don't count as downloads
+//	@Tags         share
+//	@Accept       x-www-form-urlencoded
+//	@Param        X-Share-Password  header    string  false  "Password of protected link"
+//	@Param        password          formData  string  false  "Password of protected link, POST only"
+//	@Success      200  {file}    file
+//	@Success      302  {string}  "Redirect to document content"
+//	@Failure      401  {string}  "Wrong password"
+//	@Failure      404  {string}  "Not found, expired or download limit reached"
+//	@Failure      409  {string}  "Watermark can't be applied"
+//	@Failure      429  {string}  "Locked after too many wrong passwords"
+//	@Failure      500  {string}  "Internal server error"
+//	@Router       /share/:token [get]
+//	@Router       /share/:token [post]
+func (app *application) shareResolveHandler(w http.ResponseWriter, r *http.Request) {
+	token := httprouter.ParamsFromContext(r.Context()).ByName("token")
+
+	share, err := app.data_access.Shares.GetForToken(token)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			utils.NotFoundResponse(w, r) //? http.StatusNotFound - 404
+		default:
+			utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+		}
+		return
+	}
+
+	if !share.Usable() {
+		utils.NotFoundResponse(w, r) //? http.StatusNotFound - 404
+		return
+	}
+
+	if share.Locked() {
+		w.Header().Set("Retry-After", strconv.Itoa(int(time.Until(*share.Locked_until).Seconds())+1))
+		utils.RateLimitExceededResponse(w, r) //? http.StatusTooManyRequests - 429
+		return
+	}
+
+	//? password is never read from query string which ends up in logs and history, browsers post it in a form instead
+	password := r.Header.Get("X-Share-Password")
+	if password == "" && r.Method == http.MethodPost {
+		r.Body = http.MaxBytesReader(w, r.Body, 4096)
+		password = r.PostFormValue("password")
+	}
+
+	matches, err := share.Matches(password)
+	if err != nil && !errors.Is(err, data.ErrBadPassword) {
+		utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+		return
+	}
+	if !matches {
+		//? opening protected link without password isn't a guess
+		if password != "" {
+			err = app.data_access.Shares.RecordFailedAttempt(share, shareMaxFailedAttempts, shareLockout)
+			if err != nil {
+				utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+				return
+			}
+		}
+		utils.InvalidCredentialsResponse(w, r) //? http.StatusUnauthorized - 401
+		return
+	}
+
+	if share.Failed_attempts > 0 {
+		err = app.data_access.Shares.ResetFailedAttempts(share)
+		if err != nil {
+			utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+			return
+		}
+	}
+
+	document, err := app.data_access.Documents.Get(share.Document_id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			utils.NotFoundResponse(w, r) //? http.StatusNotFound - 404
+		default:
+			utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+		}
+		return
+	}
+
+	//? stamping goes first, so download which can't be served isn't counted
+	var stamped *os.File
+	watermark := share.Watermark
+	if watermark == nil {
+		watermark = document.Watermark
+	}
+	if watermark != nil {
+		stamped, err = app.stampBlob(document.Storage_key, document.Filetype, fillWatermark(watermark, fmt.Sprintf("share link %d", share.Share_id)))
+		if err != nil {
+			stampErrorResponse(w, r, err)
+			return
+		}
+		defer removeTemp(stamped)
+	}
+
+	//? presigned link gives away the whole file whatever range was asked for
+	link := ""
+	if stamped == nil {
+		link, err = app.presignBlob(r.Context(), document.Storage_key, document.Title, document.Filetype)
+		if err != nil && !errors.Is(err, storage.ErrNotPresignable) {
+			utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+			return
+		}
+	}
+
+	if link != "" || !isViewerRange(r) {
+		err = app.data_access.Shares.RecordDownload(share)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				utils.NotFoundResponse(w, r) //? http.StatusNotFound - 404
+			default:
+				utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+			}
+			return
+		}
+	}
+
+	switch {
+	case stamped != nil:
+		serveStamped(w, r, stamped, document.Title, "inline")
+	case link != "":
+		redirectBlob(w, r, link)
+	default:
+		w.Header().Set("Cache-Control", "no-store")
+		app.streamBlob(w, r, document.Storage_key, document.Title, document.Filetype, "inline", time.Time{})
+	}
+}
+
+// shareRangeWindow is the largest range of streamed content which isn't counted as a download, viewers fetch
+// content in ranges much smaller than that once the first request was counted.
+const shareRangeWindow = 1 << 20
+
+// isViewerRange reports whether request asks for a single range of streamed content which starts past its first
+// byte and fits into shareRangeWindow. If-Range could turn it into request for the whole content, so it's not one.
+func isViewerRange(r *http.Request) bool {
+	if r.Header.Get("If-Range") != "" {
+		return false
+	}
+
+	spec, ok := strings.CutPrefix(r.Header.Get("Range"), "bytes=")
+	if !ok || strings.Contains(spec, ",") {
+		return false
+	}
+
+	start_text, end_text, ok := strings.Cut(spec, "-")
+	if !ok {
+		return false
+	}
+
+	start, err := strconv.ParseInt(strings.TrimSpace(start_text), 10, 64)
+	if err != nil || start <= 0 {
+		return false
+	}
+
+	end, err := strconv.ParseInt(strings.TrimSpace(end_text), 10, 64)
+	if err != nil || end < start {
+		return false
+	}
+
+	return end-start+1 <= shareRangeWindow
+}
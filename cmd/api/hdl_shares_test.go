@@ -0,0 +1,45 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIsViewerRange(t *testing.T) {
+	tests := []struct {
+		name         string
+		range_header string
+		if_range     string
+		want         bool
+	}{
+		{name: "no range"},
+		{name: "from the start", range_header: "bytes=0-"},
+		{name: "first bytes", range_header: "bytes=0-1"},
+		{name: "open ended", range_header: "bytes=100-"},
+		{name: "suffix", range_header: "bytes=-100"},
+		{name: "whole file past first byte", range_header: "bytes=1-999999999999"},
+		{name: "multiple ranges", range_header: "bytes=1-10,20-30"},
+		{name: "reversed", range_header: "bytes=10-1"},
+		{name: "other unit", range_header: "items=1-10"},
+		{name: "with If-Range", range_header: "bytes=1-10", if_range: `"etag"`},
+		{name: "viewer chunk", range_header: "bytes=65536-131071", want: true},
+		{name: "largest window", range_header: "bytes=1-1048576", want: true},
+		{name: "past window", range_header: "bytes=1-1048577"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/v1/share/token", nil)
+			if tt.range_header != "" {
+				r.Header.Set("Range", tt.range_header)
+			}
+			if tt.if_range != "" {
+				r.Header.Set("If-Range", tt.if_range)
+			}
+
+			if got := isViewerRange(r); got != tt.want {
+				t.Fatalf("isViewerRange(%q) = %v, want %v", tt.range_header, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"viadro_api/internal/data"
+	"viadro_api/utils"
+
+	"github.com/charmbracelet/log"
+)
+
+// List trash
+//
+//	@Summary      List trash
+//	@Description  List documents of current user which are in trash, most recently deleted first
+//	@Tags         trash
+//	@Produce      json
+//	@Success      200  {array}   data.Document
+//	@Failure      401  {string}  "Unauthorized"
+//	@Failure      500  {string}  "Internal server error"
+//	@Router       /trash [get]
+func (app *application) trashGetAllHandler(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+
+	filters := data.Filters{
+		Page:     utils.ReadIntParam(qs, "page", 1),
+		PageSize: utils.ReadIntParam(qs, "page_size", 20),
+	}
+
+	user := app.contextGetUser(r)
+
+	documents, metadata, err := app.data_access.Documents.GetAllDeleted(user.User_id, filters)
+	if err != nil {
+		utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+		return
+	}
+
+	err = utils.WriteJSON(w, http.StatusOK, utils.Wrap{"metadata": metadata, "documents": documents, "retention": app.settings.Trash_retention.String()}, nil)
+	if err != nil {
+		utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+	}
+}
+
+// Restore document from trash
+//
+//	@Summary      Restore document from trash
+//	@Description  Restore document from trash, documents whose folder was deleted meanwhile are restored to the top level
+//	@Tags         trash
+//	@Produce      json
+//	@Success      200  {object}  data.Document
+//	@Failure      401  {string}  "Unauthorized"
+//	@Failure      403  {string}  "Forbidden"
+//	@Failure      404  {string}  "Not found"
+//	@Failure      409  {string}  "Edit conflict"
+//	@Failure      412  {string}  "If-Match precondition failed"
+//	@Failure      500  {string}  "Internal server error"
+//	@Router       /document/:id/restore [post]
+func (app *application) documentRestoreHandler(w http.ResponseWriter, r *http.Request) {
+	document, ok := app.readDeletedDocument(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.data_access.Documents.Restore(document)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			utils.EditConflictResponse(w, r) //? http.StatusConflict - 409
+		default:
+			utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+		}
+		return
+	}
+
+	headers := http.Header{}
+	headers.Set("ETag", utils.VersionETag(document.Version))
+
+	err = utils.WriteJSON(w, http.StatusOK, utils.Wrap{"document": document}, headers)
+	if err != nil {
+		utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+	}
+
+	err = app.redis_client.FlushAll(context.TODO()).Err()
+	if err != nil {
+		log.Error("Failed flushing cache", err)
+	}
+}
+
+// Purge document
+//
+//	@Summary      Purge document
+//	@Description  Permanently delete document in trash together with its revisions, it can't be restored afterwards
+//	@Tags         trash
+//	@Produce      json
+//	@Success      200  {string}  "Successfully purged"
+//	@Failure      401  {string}  "Unauthorized"
+//	@Failure      403  {string}  "Forbidden"
+//	@Failure      404  {string}  "Not found"
+//	@Failure      409  {string}  "Edit conflict"
+//	@Failure      412  {string}  "If-Match precondition failed"
+//	@Failure      500  {string}  "Internal server error"
+//	@Router       /trash/:id [delete]
+func (app *application) trashPurgeHandler(w http.ResponseWriter, r *http.Request) {
+	document, ok := app.readDeletedDocument(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.purgeDocument(document)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			utils.EditConflictResponse(w, r) //? http.StatusConflict - 409
+		default:
+			utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+		}
+		return
+	}
+
+	err = utils.WriteJSON(w, http.StatusOK, utils.Wrap{"message": "document permanently deleted"}, nil)
+	if err != nil {
+		utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+	}
+}
@@ -0,0 +1,538 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"viadro_api/internal/data"
+	"viadro_api/internal/storage"
+	"viadro_api/utils"
+
+	"github.com/charmbracelet/log"
+	"github.com/go-playground/validator/v10"
+)
+
+const (
+	//? S3 rejects multipart uploads with non-final parts smaller than 5MB
+	minChunkSize = 5 << 20
+	maxChunkSize = 32 << 20
+)
+
+func (app *application) multipartStore() (storage.MultipartStore, error) {
+	multipart_store, ok := app.storage.(storage.MultipartStore)
+	if !ok {
+		return nil, errors.New("storage driver does not support resumable uploads")
+	}
+
+	return multipart_store, nil
+}
+
+// uploadHash restores checksum of chunks received so far, sha256 state is saved with every chunk
+// so the checksum does not have to be computed from assembled object.
+func uploadHash(upload *data.Upload) (hash.Hash, error) {
+	upload_hash := sha256.New()
+	if upload.Hash_state != nil {
+		err := upload_hash.(encoding.BinaryUnmarshaler).UnmarshalBinary(upload.Hash_state)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return upload_hash, nil
+}
+
+// readOwnedUpload fetches upload session from id parameter, writes error response and returns false
+// when it does not exist or belongs to other user.
+func (app *application) readOwnedUpload(w http.ResponseWriter, r *http.Request) (*data.Upload, bool) {
+	id, err := utils.ReadIDParam(r)
+	if err != nil {
+		utils.NotFoundResponse(w, r) //? http.StatusNotFound - 404
+		return nil, false
+	}
+
+	upload, err := app.data_access.Uploads.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			utils.NotFoundResponse(w, r) //? http.StatusNotFound - 404
+		default:
+			utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+		}
+		return nil, false
+	}
+
+	user := app.contextGetUser(r)
+
+	if upload.User_id != user.User_id {
+		utils.InvalidCredentialsResponse(w, r) //? http.StatusUnauthorized - 401
+		return nil, false
+	}
+
+	return upload, true
+}
+
+// Create resumable upload session
+//
+//	@Summary      Create resumable upload session
+//	@Description  Create resumable upload session, file is then sent in chunks with PATCH requests
+//	@Tags         upload
+//	@Accept       json
+//	@Produce      json
+//	@Success      201  {object}  data.Upload
+//	@Failure      400  {string}  "Bad json request"
+//	@Failure      401  {string}  "Unauthorized"
+//	@Failure      413  {string}  "File too large"
+//	@Failure      422  {string}  "Invalid upload parameters"
+//	@Failure      500  {string}  "Internal server error"
+//	@Router       /uploads [post]
+func (app *application) uploadCreateHandler(w http.ResponseWriter, r *http.Request) {
+	input := struct {
+		Filename  string   `validate:"required" json:"filename"`
+		Size      int64    `validate:"required,gt=0" json:"size"`
+		Tags      []string `json:"tags"`
+		Is_hidden bool     `json:"is_hidden"`
+	}{}
+
+	err := utils.ReadJSON(w, r, &input)
+	if err != nil {
+		utils.BadRequestResponse(w, r, err) //? http.StatusBadRequest - 400
+		return
+	}
+
+	validate := validator.New()
+	err = validate.Struct(input)
+	if err != nil {
+		utils.FailedValidationResponseValidator(w, r, err) //? http.StatusUnprocessableEntity - 422
+		return
+	}
+
+	_, err = app.multipartStore()
+	if err != nil {
+		utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	max_size := app.uploadLimit(user)
+	if input.Size > max_size {
+		utils.FileTooLargeResponse(w, r, max_size) //? http.StatusRequestEntityTooLarge - 413
+		return
+	}
+
+	storage_key, err := storage.NewKey(user.User_id)
+	if err != nil {
+		utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+		return
+	}
+
+	upload := &data.Upload{
+		User_id:     user.User_id,
+		Filename:    input.Filename,
+		Tags:        input.Tags,
+		Is_hidden:   input.Is_hidden,
+		Size:        input.Size,
+		Storage_key: storage_key,
+	}
+
+	err = app.data_access.Uploads.Insert(upload)
+	if err != nil {
+		utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+		return
+	}
+
+	headers := http.Header{}
+	headers.Set("Location", fmt.Sprintf("/v1/uploads/%d", upload.Upload_id))
+
+	err = utils.WriteJSON(w, http.StatusCreated, utils.Wrap{"upload": upload, "min_chunk_size": minChunkSize, "max_chunk_size": maxChunkSize}, headers)
+	if err != nil {
+		utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+	}
+}
+
+// Get resumable upload progress
+//
+//	@Summary      Get resumable upload progress
+//	@Description  Get resumable upload progress, offset of next chunk is returned in Upload-Offset header
+//	@Tags         upload
+//	@Success      200  {string}  "Upload-Offset and Upload-Length headers"
+//	@Failure      401  {string}  "Unauthorized"
+//	@Failure      404  {string}  "Not found"
+//	@Failure      500  {string}  "Internal server error"
+//	@Router       /uploads/:id [head]
+func (app *application) uploadStatusHandler(w http.ResponseWriter, r *http.Request) {
+	upload, ok := app.readOwnedUpload(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Uploaded_size, 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(upload.Size, 10))
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+}
+
+// Append chunk to resumable upload
+//
+//	@Summary      Append chunk to resumable upload
+//	@Description  Append chunk to resumable upload, Upload-Offset header must match current upload progress
+//	@Tags         upload
+//	@Accept       application/offset+octet-stream
+//	@Success      204  {string}  "Chunk saved, new offset in Upload-Offset header"
+//	@Failure      400  {string}  "Bad request"
+//	@Failure      401  {string}  "Unauthorized"
+//	@Failure      404  {string}  "Not found"
+//	@Failure      409  {string}  "Offset mismatch"
+//	@Failure      413  {string}  "Chunk too large"
+//	@Failure      415  {string}  "Unsupported file type"
+//	@Failure      422  {string}  "Chunk too small"
+//	@Failure      500  {string}  "Internal server error"
+//	@Router       /uploads/:id [patch]
+func (app *application) uploadChunkHandler(w http.ResponseWriter, r *http.Request) {
+	upload, ok := app.readOwnedUpload(w, r)
+	if !ok {
+		return
+	}
+
+	multipart_store, err := app.multipartStore()
+	if err != nil {
+		utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+		return
+	}
+
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset != upload.Uploaded_size {
+		utils.UploadOffsetConflictResponse(w, r, upload.Uploaded_size) //? http.StatusConflict - 409
+		return
+	}
+
+	controller := http.NewResponseController(w)
+	err = controller.SetReadDeadline(time.Now().Add(app.settings.Upload_timeout))
+	if err != nil {
+		log.Error("failed extending upload read deadline", err)
+	}
+
+	chunk, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxChunkSize))
+	if err != nil {
+		switch {
+		case isFileTooLarge(err):
+			utils.FileTooLargeResponse(w, r, maxChunkSize) //? http.StatusRequestEntityTooLarge - 413
+		default:
+			utils.BadRequestResponse(w, r, err) //? http.StatusBadRequest - 400
+		}
+		return
+	}
+
+	new_size := offset + int64(len(chunk))
+
+	switch {
+	case len(chunk) == 0:
+		utils.BadRequestResponse(w, r, errors.New("empty chunk")) //? http.StatusBadRequest - 400
+		return
+	case new_size > upload.Size:
+		utils.BadRequestResponse(w, r, errors.New("chunk exceeds declared upload size")) //? http.StatusBadRequest - 400
+		return
+	case new_size < upload.Size && len(chunk) < minChunkSize:
+		utils.FailedValidationResponse(w, r, map[string]string{"chunk": fmt.Sprintf("must be at least %d bytes unless it is the last one", minChunkSize)}) //? http.StatusUnprocessableEntity - 422
+		return
+	}
+
+	//? part is stored only once the offset is reserved, concurrent chunks at the same offset would overwrite it
+	err = app.data_access.Uploads.Lease(upload, offset, time.Now().Add(app.settings.Upload_timeout))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			utils.UploadOffsetConflictResponse(w, r, upload.Uploaded_size) //? http.StatusConflict - 409
+		default:
+			utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+		}
+		return
+	}
+
+	//? storing has to finish before the lease expires and another request may take over the chunk
+	ctx, cancel := context.WithDeadline(context.Background(), upload.Leased_until)
+	defer cancel()
+
+	ok = app.storeChunk(ctx, w, r, multipart_store, upload, chunk)
+	if !ok {
+		err = app.data_access.Uploads.ReleaseLease(upload)
+		if err != nil {
+			log.Error(fmt.Sprintf("failed releasing lease of upload %d", upload.Upload_id), err)
+		}
+		return
+	}
+
+	err = app.data_access.Uploads.Update(upload, offset)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			utils.UploadOffsetConflictResponse(w, r, offset) //? http.StatusConflict - 409
+		default:
+			utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+		}
+		return
+	}
+
+	w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Uploaded_size, 10))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// storeChunk stores chunk as the next part of upload reserved with Lease and records it in upload, the first chunk
+// decides file type and starts multipart upload in storage. Error response is written and false returned when
+// chunk can't be stored.
+func (app *application) storeChunk(ctx context.Context, w http.ResponseWriter, r *http.Request, multipart_store storage.MultipartStore, upload *data.Upload, chunk []byte) bool {
+	var err error
+
+	created := false
+	if upload.Storage_upload_id == "" {
+		head := chunk
+		if len(head) > 512 {
+			head = head[:512]
+		}
+
+		upload.Filetype = utils.DetectFiletype(head, upload.Filename)
+		if !utils.IsFiletypeAllowed(upload.Filetype, app.settings.Allowed_filetypes) {
+			utils.UnsupportedFiletypeResponse(w, r, upload.Filetype) //? http.StatusUnsupportedMediaType - 415
+			return false
+		}
+
+		upload.Storage_upload_id, err = multipart_store.CreateMultipart(ctx, upload.Storage_key, storage.PutOptions{
+			Content_type:        upload.Filetype,
+			Content_disposition: contentDisposition(upload.Filename),
+		})
+		if err != nil {
+			utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+			return false
+		}
+		created = true
+	}
+
+	part_number := int32(len(upload.Part_etags) + 1)
+
+	etag, err := multipart_store.UploadPart(ctx, upload.Storage_key, upload.Storage_upload_id, part_number, bytes.NewReader(chunk), int64(len(chunk)))
+	if err != nil {
+		if created {
+			_ = multipart_store.AbortMultipart(context.TODO(), upload.Storage_key, upload.Storage_upload_id)
+		}
+		utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+		return false
+	}
+
+	upload_hash, err := uploadHash(upload)
+	if err != nil {
+		utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+		return false
+	}
+	upload_hash.Write(chunk)
+
+	upload.Hash_state, err = upload_hash.(encoding.BinaryMarshaler).MarshalBinary()
+	if err != nil {
+		utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+		return false
+	}
+
+	upload.Part_etags = append(upload.Part_etags, etag)
+	upload.Uploaded_size += int64(len(chunk))
+
+	return true
+}
+
+// Complete resumable upload
+//
+//	@Summary      Complete resumable upload
+//	@Description  Assemble uploaded chunks into a document
+//	@Tags         upload
+//	@Produce      json
+//	@Success      201  {object}  data.Document
+//	@Failure      401  {string}  "Unauthorized"
+//	@Failure      404  {string}  "Not found"
+//	@Failure      409  {string}  "Upload is being completed, aborted or appended to"
+//	@Failure      422  {string}  "Upload incomplete or malformed PDF"
+//	@Failure      500  {string}  "Internal server error"
+//	@Router       /uploads/:id/complete [post]
+func (app *application) uploadCompleteHandler(w http.ResponseWriter, r *http.Request) {
+	upload, ok := app.readOwnedUpload(w, r)
+	if !ok {
+		return
+	}
+
+	multipart_store, err := app.multipartStore()
+	if err != nil {
+		utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+		return
+	}
+
+	if upload.Uploaded_size != upload.Size {
+		utils.FailedValidationResponse(w, r, map[string]string{"upload": fmt.Sprintf("incomplete, received %d of %d bytes", upload.Uploaded_size, upload.Size)}) //? http.StatusUnprocessableEntity - 422
+		return
+	}
+
+	//? session is claimed like a chunk, concurrent completion or abort gets conflict instead of a second document
+	err = app.data_access.Uploads.Lease(upload, upload.Size, time.Now().Add(app.settings.Upload_timeout))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			utils.EditConflictResponse(w, r) //? http.StatusConflict - 409
+		default:
+			utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+		}
+		return
+	}
+
+	ctx, cancel := context.WithDeadline(context.Background(), upload.Leased_until)
+	defer cancel()
+
+	parts := make([]storage.CompletedPart, 0, len(upload.Part_etags))
+	for i, etag := range upload.Part_etags {
+		parts = append(parts, storage.CompletedPart{Part_number: int32(i + 1), ETag: etag})
+	}
+
+	upload_hash, err := uploadHash(upload)
+	if err != nil {
+		app.releaseUpload(upload)
+		utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+		return
+	}
+
+	location, err := multipart_store.CompleteMultipart(ctx, upload.Storage_key, upload.Storage_upload_id, parts)
+	if err != nil {
+		app.releaseUpload(upload)
+		utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+		return
+	}
+
+	//? from now on the session can't be completed again, every failure discards assembled object along with it
+	metadata, local, ok := app.inspectUpload(w, r, upload.Storage_key, upload.Filetype)
+	if !ok {
+		app.discardUpload(upload)
+		return
+	}
+
+	blob, err := app.storeBlob(upload.Storage_key, location, hex.EncodeToString(upload_hash.Sum(nil)))
+	if err != nil {
+		removeTemp(local)
+		app.discardUpload(upload)
+		utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+		return
+	}
+
+	document := &data.Document{
+		User_id:      upload.User_id,
+		Url_s3:       blob.Location,
+		Storage_key:  blob.Storage_key,
+		Checksum:     blob.Checksum,
+		Filetype:     upload.Filetype,
+		Title:        upload.Filename,
+		Tags:         upload.Tags,
+		Is_hidden:    upload.Is_hidden,
+		FileMetadata: metadata,
+	}
+
+	err = app.data_access.Documents.Insert(document)
+	if err != nil {
+		removeTemp(local)
+		app.releaseBlob(blob.Storage_key)
+		app.discardUpload(upload)
+		utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+		return
+	}
+
+	app.processDocument(document, local)
+	app.discardUpload(upload)
+
+	headers := http.Header{}
+	headers.Set("Location", fmt.Sprintf("/v1/document/%d", document.Document_id))
+
+	err = utils.WriteJSON(w, http.StatusCreated, utils.Wrap{"document": document}, headers)
+	if err != nil {
+		utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+	}
+
+	err = app.redis_client.FlushAll(context.TODO()).Err()
+	if err != nil {
+		log.Error("Failed flushing cache", err)
+	}
+}
+
+// releaseUpload gives up session claimed with Lease which wasn't completed or aborted, so it can be retried.
+func (app *application) releaseUpload(upload *data.Upload) {
+	err := app.data_access.Uploads.ReleaseLease(upload)
+	if err != nil {
+		log.Error(fmt.Sprintf("failed releasing lease of upload %d", upload.Upload_id), err)
+	}
+}
+
+// discardUpload deletes session of upload which was completed in storage, whether it became a document or not.
+func (app *application) discardUpload(upload *data.Upload) {
+	err := app.data_access.Uploads.Delete(upload.Upload_id)
+	if err != nil {
+		log.Error(fmt.Sprintf("failed deleting completed upload %d", upload.Upload_id), err)
+	}
+}
+
+// Abort resumable upload
+//
+//	@Summary      Abort resumable upload
+//	@Description  Abort resumable upload and discard uploaded chunks
+//	@Tags         upload
+//	@Produce      json
+//	@Success      200  {string}  "Upload aborted"
+//	@Failure      401  {string}  "Unauthorized"
+//	@Failure      404  {string}  "Not found"
+//	@Failure      409  {string}  "Upload is being completed or appended to"
+//	@Failure      500  {string}  "Internal server error"
+//	@Router       /uploads/:id [delete]
+func (app *application) uploadAbortHandler(w http.ResponseWriter, r *http.Request) {
+	upload, ok := app.readOwnedUpload(w, r)
+	if !ok {
+		return
+	}
+
+	multipart_store, err := app.multipartStore()
+	if err != nil {
+		utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+		return
+	}
+
+	//? chunk being stored or completion in progress would race the abort
+	err = app.data_access.Uploads.Lease(upload, upload.Uploaded_size, time.Now().Add(app.settings.Upload_timeout))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			utils.EditConflictResponse(w, r) //? http.StatusConflict - 409
+		default:
+			utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+		}
+		return
+	}
+
+	if upload.Storage_upload_id != "" {
+		err = multipart_store.AbortMultipart(context.TODO(), upload.Storage_key, upload.Storage_upload_id)
+		if err != nil && !errors.Is(err, storage.ErrUploadNotFound) {
+			app.releaseUpload(upload)
+			utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+			return
+		}
+	}
+
+	err = app.data_access.Uploads.Delete(upload.Upload_id)
+	if err != nil {
+		utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+		return
+	}
+
+	err = utils.WriteJSON(w, http.StatusOK, utils.Wrap{"message": "upload successfully aborted"}, nil)
+	if err != nil {
+		utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+	}
+}
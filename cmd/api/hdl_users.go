@@ -1,13 +1,16 @@
 package main
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"net/http"
 	"time"
 	"viadro_api/internal/data"
 	"viadro_api/internal/mail"
 	"viadro_api/utils"
 
+	"github.com/charmbracelet/log"
 	"github.com/go-playground/validator/v10"
 )
 
@@ -109,6 +112,7 @@ func (app *application) userRegisterHandler(w http.ResponseWriter, r *http.Reque
 //	@Success      200  {string}  "User activated"
 //	@Failure      400  {string}  "Bad json request"
 //	@Failure      422  {string}  "Invalid or expired token"
+//	@Failure      409  {string}  "Edit conflict"
 //	@Failure      500  {string}  "Internal server error"
 //	@Router       /user/activate [put]
 func (app *application) userActivateHandler(w http.ResponseWriter, r *http.Request) {
@@ -144,7 +148,12 @@ func (app *application) userActivateHandler(w http.ResponseWriter, r *http.Reque
 
 	err = app.data_access.Users.Update(user)
 	if err != nil {
-		utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			utils.EditConflictResponse(w, r) //? http.StatusConflict - 409
+		default:
+			utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+		}
 		return
 	}
 
@@ -225,18 +234,174 @@ func (app *application) userAuthenticateHandler(w http.ResponseWriter, r *http.R
 	}
 }
 
-// Delete (deactivate) user
+// Request password reset
 //
-//	@Summary      Delete (deactivate) user
-//	@Description  Delete (deactivate) user
+//	@Summary      Request password reset
+//	@Description  Send a one-time password reset token to user's email, the response is the same when there is no activated account with the email
 //	@Tags         user
+//	@Accept      json
 //	@Produce      json
-//	@Success      201  {string}  "User authenticated"
+//	@Success      202  {string}  "Password reset token sent if account exists"
 //	@Failure      400  {string}  "Bad json request"
+//	@Failure      422  {string}  "Invalid email"
+//	@Failure      500  {string}  "Internal server error"
+//	@Router       /user/password-reset [post]
+func (app *application) userPasswordResetHandler(w http.ResponseWriter, r *http.Request) {
+	input := struct {
+		Email string `validate:"required,email" json:"email"`
+	}{}
+
+	err := utils.ReadJSON(w, r, &input)
+	if err != nil {
+		utils.BadRequestResponse(w, r, err) //? http.StatusBadRequest - 400
+		return
+	}
+
+	validate := validator.New()
+	err = validate.Struct(input)
+	if err != nil {
+		utils.FailedValidationResponseValidator(w, r, err)
+		return
+	}
+
+	user, err := app.data_access.Users.GetByEmail(input.Email)
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+		return
+	}
+
+	//? response is the same whether the account exists or not, so it can't be used to find out who has one
+	if err == nil && user.Activated {
+		app.background(func() {
+			err := app.sendPasswordReset(user)
+			if err != nil {
+				log.Error("failed sending password reset email", err)
+			}
+		})
+	}
+
+	err = utils.WriteJSON(w, http.StatusAccepted, utils.Wrap{"message": "if the address belongs to an activated account, an email will be sent to it containing password reset instructions"}, nil)
+	if err != nil {
+		utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+	}
+}
+
+// sendPasswordReset replaces user's password reset tokens with a new one and emails it, it runs in background
+// so response time doesn't tell whether the account exists either.
+func (app *application) sendPasswordReset(user *data.User) error {
+	err := app.data_access.Tokens.DeleteAllForUser(data.ScopePasswordReset, user.User_id)
+	if err != nil {
+		return err
+	}
+
+	token, err := app.data_access.Tokens.New(user.User_id, 45*time.Minute, data.ScopePasswordReset)
+	if err != nil {
+		return err
+	}
+
+	data := map[string]interface{}{
+		"password_reset_token": token.Plaintext,
+	}
+
+	email, err := mail.PrepareEmail(user.Email, "user_password_reset.html", data)
+	if err != nil {
+		return err
+	}
+
+	return app.mail_client.DialAndSend(email)
+}
+
+// Set new password using password reset token
+//
+//	@Summary      Set new password using password reset token
+//	@Description  Set new password using password reset token, signs out all active sessions
+//	@Tags         user
+//	@Accept      json
+//	@Produce      json
+//	@Success      200  {string}  "Password updated"
+//	@Failure      400  {string}  "Bad json request"
+//	@Failure      422  {string}  "Invalid or expired token"
+//	@Failure      409  {string}  "Edit conflict"
+//	@Failure      500  {string}  "Internal server error"
+//	@Router       /user/password [put]
+func (app *application) userPasswordUpdateHandler(w http.ResponseWriter, r *http.Request) {
+	input := struct {
+		Password       string `validate:"required,alphanumunicode" json:"password"`
+		TokenPlaintext string `validate:"required,alphanumunicode" json:"token"`
+	}{}
+
+	err := utils.ReadJSON(w, r, &input)
+	if err != nil {
+		utils.BadRequestResponse(w, r, err) //? http.StatusBadRequest - 400
+		return
+	}
+
+	validate := validator.New()
+	err = validate.Struct(input)
+	if err != nil {
+		utils.FailedValidationResponseValidator(w, r, err)
+		return
+	}
+
+	user, err := app.data_access.Users.GetForToken(data.ScopePasswordReset, input.TokenPlaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			utils.FailedValidationResponse(w, r, map[string]string{"invalid or expired token": "true"}) //? http.StatusUnprocessableEntity - 422
+		default:
+			utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+		}
+		return
+	}
+
+	err = user.Password.Set(input.Password)
+	if err != nil {
+		utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+		return
+	}
+
+	err = app.data_access.Users.Update(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			utils.EditConflictResponse(w, r) //? http.StatusConflict - 409
+		default:
+			utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+		}
+		return
+	}
+
+	err = app.data_access.Tokens.DeleteAllForUser(data.ScopePasswordReset, user.User_id)
+	if err != nil {
+		utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+		return
+	}
+
+	err = app.data_access.Tokens.DeleteAllForUser(data.ScopeAuthentication, user.User_id)
+	if err != nil {
+		utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+		return
+	}
+
+	err = utils.WriteJSON(w, http.StatusOK, utils.Wrap{"message": "your password was successfully reset"}, nil)
+	if err != nil {
+		utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+	}
+}
+
+// Delete user
+//
+//	@Summary      Delete user
+//	@Description  Delete user account, user's documents and their files are removed in background. Admins can instead transfer documents to another user with transfer_to query parameter
+//	@Tags         user
+//	@Produce      json
+//	@Success      200  {string}  "User deleted"
 //	@Failure      401  {string}  "Bad credentials"
+//	@Failure      403  {string}  "Only admins can transfer documents"
 //	@Failure      404  {string}  "User not found"
+//	@Failure      422  {string}  "Invalid transfer target"
 //	@Failure      500  {string}  "Internal server error"
-//	@Router       /user [delete]
+//	@Router       /user/:id [delete]
 func (app *application) userDeleteHandler(w http.ResponseWriter, r *http.Request) {
 	id, err := utils.ReadIDParam(r)
 	if err != nil {
@@ -261,7 +426,41 @@ func (app *application) userDeleteHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	err = app.data_access.Users.Delete(id)
+	var transfer_to *int
+	if r.URL.Query().Has("transfer_to") {
+		if !user_ctx.Is_admin {
+			utils.NotAdminResponse(w, r) //? http.StatusForbidden - 403
+			return
+		}
+
+		target_id := utils.ReadIntParam(r.URL.Query(), "transfer_to", 0)
+		if target_id == 0 || target_id == id {
+			utils.FailedValidationResponse(w, r, map[string]string{"transfer_to": "must be id of another user"}) //? http.StatusUnprocessableEntity - 422
+			return
+		}
+
+		_, err = app.data_access.Users.GetById(target_id)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				utils.FailedValidationResponse(w, r, map[string]string{"transfer_to": "user does not exist"}) //? http.StatusUnprocessableEntity - 422
+			default:
+				utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+			}
+			return
+		}
+
+		transfer_to = &target_id
+	}
+
+	//? upload sessions are deleted together with the user, their parts have to be discarded from storage
+	uploads, err := app.data_access.Uploads.GetAllForUser(id)
+	if err != nil {
+		utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+		return
+	}
+
+	err = app.data_access.Users.Delete(id, transfer_to)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -272,7 +471,25 @@ func (app *application) userDeleteHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	err = utils.WriteJSON(w, http.StatusOK, nil, nil)
+	app.background(func() {
+		for _, upload := range uploads {
+			err := app.abortStoredUpload(upload)
+			if err != nil {
+				log.Error(fmt.Sprintf("failed aborting upload %d of deleted user", upload.Upload_id), err)
+			}
+		}
+
+		if transfer_to == nil {
+			app.purgeOrphanedDocuments(&id)
+		}
+
+		err := app.redis_client.FlushAll(context.TODO()).Err()
+		if err != nil {
+			log.Error("Failed flushing cache", err)
+		}
+	})
+
+	err = utils.WriteJSON(w, http.StatusOK, utils.Wrap{"message": "user successfully deleted"}, nil)
 	if err != nil {
 		utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
 	}
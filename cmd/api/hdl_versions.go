@@ -0,0 +1,336 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"viadro_api/internal/data"
+	"viadro_api/internal/pdf"
+	"viadro_api/utils"
+
+	"github.com/charmbracelet/log"
+)
+
+// storeNewVersion makes blob the current revision of document, previous revision is kept in the history.
+// Caller's reference to blob is handed over to the document, it is released when the revision can't be stored.
+// Local copy of the blob is handed over as well, it is read by background processing and removed afterwards.
+func (app *application) storeNewVersion(document *data.Document, blob *data.Blob, filetype string, metadata data.FileMetadata, local *os.File) error {
+	archived := &data.DocumentVersion{
+		Document_id:    document.Document_id,
+		Version_number: document.Current_version,
+		Storage_key:    document.Storage_key,
+		Checksum:       document.Checksum,
+		Filetype:       document.Filetype,
+		Uploaded_at:    document.Revised_at,
+	}
+
+	document.Storage_key = blob.Storage_key
+	document.Checksum = blob.Checksum
+	document.Url_s3 = blob.Location
+	document.Filetype = filetype
+	document.FileMetadata = metadata
+
+	err := app.data_access.Versions.Archive(document, archived)
+	if err != nil {
+		removeTemp(local)
+		app.releaseBlob(blob.Storage_key)
+		return err
+	}
+
+	app.processDocument(document, local)
+
+	return nil
+}
+
+// List document revisions
+//
+//	@Summary      List document revisions
+//	@Description  List all revisions of document, newest first, current revision included
+//	@Tags         document
+//	@Produce      json
+//	@Success      200  {array}   data.DocumentVersion
+//	@Failure      401  {string}  "Unauthorized"
+//	@Failure      403  {string}  "Forbidden"
+//	@Failure      404  {string}  "Not found"
+//	@Failure      500  {string}  "Internal server error"
+//	@Router       /document/:id/versions [get]
+func (app *application) documentVersionGetAllHandler(w http.ResponseWriter, r *http.Request) {
+	document, ok := app.readDocument(w, r, accessView)
+	if !ok {
+		return
+	}
+
+	archived, err := app.data_access.Versions.GetAll(document.Document_id)
+	if err != nil {
+		utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+		return
+	}
+
+	versions := append([]data.DocumentVersion{data.CurrentVersion(document)}, archived...)
+
+	err = utils.WriteJSON(w, http.StatusOK, utils.Wrap{"current_version": document.Current_version, "versions_count": len(versions), "versions": versions}, nil)
+	if err != nil {
+		utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+	}
+}
+
+// Upload new document revision
+//
+//	@Summary      Upload new document revision
+//	@Description  Upload new content of document, previous content is kept as a revision which can be downloaded or restored
+//	@Tags         document
+//	@Accept       mpfd
+//	@Produce      json
+//	@Success      201  {object}  data.Document
+//	@Failure      400  {string}  "Bad request"
+//	@Failure      401  {string}  "Unauthorized"
+//	@Failure      403  {string}  "Forbidden"
+//	@Failure      404  {string}  "Not found"
+//	@Failure      409  {string}  "Edit conflict"
+//	@Failure      412  {string}  "If-Match precondition failed"
+//	@Failure      413  {string}  "File too large"
+//	@Failure      415  {string}  "Unsupported file type"
+//	@Failure      422  {string}  "Malformed PDF"
+//	@Failure      500  {string}  "Internal server error"
+//	@Router       /document/:id/versions [post]
+func (app *application) documentVersionAddHandler(w http.ResponseWriter, r *http.Request) {
+	document, ok := app.readDocument(w, r, accessEdit)
+	if !ok {
+		return
+	}
+
+	user := app.contextGetUser(r)
+	max_size := app.uploadLimit(user)
+
+	if r.ContentLength > max_size+1048576 {
+		utils.FileTooLargeResponse(w, r, max_size) //? http.StatusRequestEntityTooLarge - 413
+		return
+	}
+
+	controller := http.NewResponseController(w)
+	err := controller.SetReadDeadline(time.Now().Add(app.settings.Upload_timeout))
+	if err != nil {
+		log.Error("failed extending upload read deadline", err)
+	}
+	err = controller.SetWriteDeadline(time.Now().Add(app.settings.Upload_timeout))
+	if err != nil {
+		log.Error("failed extending upload write deadline", err)
+	}
+
+	document_part, filename, err := utils.ReadMultipartStream(w, r, &struct{}{}, max_size)
+	if err != nil {
+		utils.BadRequestResponse(w, r, err) //? http.StatusBadRequest - 400
+		return
+	}
+
+	file := bufio.NewReaderSize(document_part, 512)
+	head, err := file.Peek(512)
+	if err != nil && !errors.Is(err, io.EOF) {
+		switch {
+		case isFileTooLarge(err):
+			utils.FileTooLargeResponse(w, r, max_size) //? http.StatusRequestEntityTooLarge - 413
+		default:
+			utils.BadRequestResponse(w, r, err) //? http.StatusBadRequest - 400
+		}
+		return
+	}
+
+	filetype := utils.DetectFiletype(head, filename)
+	if !utils.IsFiletypeAllowed(filetype, app.settings.Allowed_filetypes) {
+		utils.UnsupportedFiletypeResponse(w, r, filetype) //? http.StatusUnsupportedMediaType - 415
+		return
+	}
+
+	blob, metadata, local, err := app.storeFile(document.User_id, file, document.Title, filetype)
+	if err != nil {
+		switch {
+		case isFileTooLarge(err):
+			utils.FileTooLargeResponse(w, r, max_size) //? http.StatusRequestEntityTooLarge - 413
+		case errors.Is(err, pdf.ErrMalformed):
+			utils.FailedValidationResponse(w, r, map[string]string{"file": "malformed PDF, the file can't be read"}) //? http.StatusUnprocessableEntity - 422
+		default:
+			utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+		}
+		return
+	}
+
+	err = app.storeNewVersion(document, blob, filetype, metadata, local)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			utils.EditConflictResponse(w, r) //? http.StatusConflict - 409
+		default:
+			utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+		}
+		return
+	}
+
+	headers := http.Header{}
+	headers.Set("Location", fmt.Sprintf("/v1/document/%d/versions/%d", document.Document_id, document.Current_version))
+	headers.Set("ETag", utils.VersionETag(document.Version))
+
+	err = utils.WriteJSON(w, http.StatusCreated, utils.Wrap{"document": document}, headers)
+	if err != nil {
+		utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+	}
+
+	err = app.redis_client.FlushAll(context.TODO()).Err()
+	if err != nil {
+		log.Error("Failed flushing cache", err)
+	}
+}
+
+// Download document revision
+//
+//	@Summary      Download document revision
+//	@Description  Redirect to short-lived link to content of given document revision, revisions of watermarked documents are stamped and served directly to those who can't edit them, encrypted ones are decrypted and served directly
+//	@Tags         document
+//	@Success      200  {file}    file
+//	@Success      302  {string}  "Redirect to revision content"
+//	@Failure      401  {string}  "Unauthorized"
+//	@Failure      403  {string}  "Forbidden"
+//	@Failure      404  {string}  "Not found"
+//	@Failure      409  {string}  "Watermark can't be applied"
+//	@Failure      500  {string}  "Internal server error"
+//	@Router       /document/:id/versions/:version [get]
+func (app *application) documentVersionDownloadHandler(w http.ResponseWriter, r *http.Request) {
+	version_number, err := utils.ReadNamedIDParam(r, "version")
+	if err != nil {
+		utils.NotFoundResponse(w, r) //? http.StatusNotFound - 404
+		return
+	}
+
+	document, ok := app.readDocument(w, r, accessView)
+	if !ok {
+		return
+	}
+
+	key, filetype := document.Storage_key, document.Filetype
+	if version_number != document.Current_version {
+		version, err := app.data_access.Versions.Get(document.Document_id, version_number)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				utils.NotFoundResponse(w, r) //? http.StatusNotFound - 404
+			default:
+				utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+			}
+			return
+		}
+		key, filetype = version.Storage_key, version.Filetype
+	}
+
+	watermark, err := app.watermarkFor(app.contextGetUser(r), document)
+	if err != nil {
+		utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+		return
+	}
+	if watermark != nil {
+		app.sendStamped(w, r, key, filetype, document.Title, "inline", watermark)
+		return
+	}
+
+	app.sendBlob(w, r, key, document.Title, filetype)
+}
+
+// Restore document revision
+//
+//	@Summary      Restore document revision
+//	@Description  Make content of given revision current again, it is stored as a new revision so no history is lost
+//	@Tags         document
+//	@Produce      json
+//	@Success      200  {object}  data.Document
+//	@Failure      401  {string}  "Unauthorized"
+//	@Failure      403  {string}  "Forbidden"
+//	@Failure      404  {string}  "Not found"
+//	@Failure      409  {string}  "Edit conflict"
+//	@Failure      412  {string}  "If-Match precondition failed"
+//	@Failure      422  {string}  "Revision is already current"
+//	@Failure      500  {string}  "Internal server error"
+//	@Router       /document/:id/versions/:version/restore [post]
+func (app *application) documentVersionRestoreHandler(w http.ResponseWriter, r *http.Request) {
+	version_number, err := utils.ReadNamedIDParam(r, "version")
+	if err != nil {
+		utils.NotFoundResponse(w, r) //? http.StatusNotFound - 404
+		return
+	}
+
+	document, ok := app.readDocument(w, r, accessEdit)
+	if !ok {
+		return
+	}
+
+	if version_number == document.Current_version {
+		utils.FailedValidationResponse(w, r, map[string]string{"version": "revision is already current"}) //? http.StatusUnprocessableEntity - 422
+		return
+	}
+
+	version, err := app.data_access.Versions.Get(document.Document_id, version_number)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			utils.NotFoundResponse(w, r) //? http.StatusNotFound - 404
+		default:
+			utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+		}
+		return
+	}
+
+	blob, err := app.data_access.Blobs.Get(version.Storage_key)
+	if err != nil {
+		utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+		return
+	}
+
+	//? single copy of the revision is both inspected and handed over to background processing
+	local, size, err := app.fetchTemp(blob.Storage_key)
+	if err != nil {
+		utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+		return
+	}
+
+	//? revisions stored before uploads were inspected are restored even when malformed, like they were kept
+	metadata, err := inspectFile(local, size, version.Filetype)
+	if err != nil && !errors.Is(err, pdf.ErrMalformed) {
+		removeTemp(local)
+		utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+		return
+	}
+
+	err = app.data_access.Blobs.Retain(blob.Storage_key)
+	if err != nil {
+		removeTemp(local)
+		utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+		return
+	}
+
+	err = app.storeNewVersion(document, blob, version.Filetype, metadata, local)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			utils.EditConflictResponse(w, r) //? http.StatusConflict - 409
+		default:
+			utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+		}
+		return
+	}
+
+	headers := http.Header{}
+	headers.Set("ETag", utils.VersionETag(document.Version))
+
+	err = utils.WriteJSON(w, http.StatusOK, utils.Wrap{"document": document}, headers)
+	if err != nil {
+		utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+	}
+
+	err = app.redis_client.FlushAll(context.TODO()).Err()
+	if err != nil {
+		log.Error("Failed flushing cache", err)
+	}
+}
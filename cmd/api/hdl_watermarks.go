@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"viadro_api/internal/data"
+	"viadro_api/internal/pdf"
+	"viadro_api/internal/storage"
+	"viadro_api/utils"
+
+	"github.com/charmbracelet/log"
+	"github.com/go-playground/validator/v10"
+)
+
+var errNotStampable = errors.New("watermark can't be applied to file")
+
+type watermarkInput struct {
+	Text  string `validate:"required,max=200" json:"text"`
+	Style string `validate:"omitempty,oneof=diagonal footer" json:"style"`
+}
+
+func (input *watermarkInput) watermark() *data.Watermark {
+	if input == nil {
+		return nil
+	}
+
+	style := input.Style
+	if style == "" {
+		style = data.WatermarkDiagonal
+	}
+
+	return &data.Watermark{Text: input.Text, Style: style}
+}
+
+// fillWatermark replaces placeholders in watermark's text with who downloads the document and when.
+func fillWatermark(watermark *data.Watermark, recipient string) *data.Watermark {
+	text := strings.NewReplacer("{user}", recipient, "{date}", time.Now().UTC().Format("2006-01-02")).Replace(watermark.Text)
+	return &data.Watermark{Text: text, Style: watermark.Style}
+}
+
+// watermarkFor resolves watermark stamped on document downloaded by user, nil means the original is served. Those who
+// can edit document get the original, they could replace it with an unmarked file anyway.
+func (app *application) watermarkFor(user *data.User, document *data.Document) (*data.Watermark, error) {
+	if document.Watermark == nil {
+		return nil, nil
+	}
+
+	editor, err := app.authorizeDocument(user, document, accessEdit)
+	if err != nil || editor {
+		return nil, err
+	}
+
+	recipient := "anonymous"
+	if !user.IsAnonymous() {
+		recipient = user.Email
+	}
+
+	return fillWatermark(document.Watermark, recipient), nil
+}
+
+// stampBlob writes stamped copy of blob to temporary file, the blob itself is never changed. File has to be
+// released with removeTemp. Files other than readable, unprotected PDFs are reported with errNotStampable.
+func (app *application) stampBlob(storage_key string, filetype string, watermark *data.Watermark) (*os.File, error) {
+	if filetype != utils.FiletypePDF {
+		return nil, errNotStampable
+	}
+
+	source, _, err := app.fetchTemp(storage_key)
+	if err != nil {
+		return nil, err
+	}
+	defer removeTemp(source)
+
+	stamped, err := os.CreateTemp("", "viadro-stamped-*")
+	if err != nil {
+		return nil, err
+	}
+
+	err = pdf.Stamp(source, stamped, watermark.Text, watermark.Style)
+	if err == nil {
+		_, err = stamped.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		removeTemp(stamped)
+		if errors.Is(err, pdf.ErrEncrypted) || errors.Is(err, pdf.ErrMalformed) {
+			return nil, errNotStampable
+		}
+		return nil, err
+	}
+
+	return stamped, nil
+}
+
+// stampErrorResponse writes response for failed stampBlob.
+func stampErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, errNotStampable):
+		utils.WatermarkUnavailableResponse(w, r) //? http.StatusConflict - 409
+	case errors.Is(err, storage.ErrObjectNotFound):
+		utils.NotFoundResponse(w, r) //? http.StatusNotFound - 404
+	default:
+		utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+	}
+}
+
+// serveStamped serves stamped copy of document's file made by stampBlob, it differs between downloads so it isn't cached.
+func serveStamped(w http.ResponseWriter, r *http.Request, file *os.File, title string, disposition string) {
+	w.Header().Set("Content-Type", utils.FiletypePDF)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": title}))
+	w.Header().Set("Cache-Control", "no-store")
+
+	http.ServeContent(w, r, title, time.Time{}, file)
+}
+
+// sendStamped stamps blob of document and serves it in place of the original.
+func (app *application) sendStamped(w http.ResponseWriter, r *http.Request, storage_key string, filetype string, title string, disposition string, watermark *data.Watermark) {
+	file, err := app.stampBlob(storage_key, filetype, watermark)
+	if err != nil {
+		stampErrorResponse(w, r, err)
+		return
+	}
+	defer removeTemp(file)
+
+	serveStamped(w, r, file, title, disposition)
+}
+
+// Set document watermark
+//
+//	@Summary      Set document watermark
+//	@Description  Stamp every page of PDF with text when it's downloaded by someone who can't edit it, the stored file stays untouched. Style is diagonal (default) or footer, {user} and {date} in text are replaced with e-mail of downloading user and date of the download
+//	@Tags         document
+//	@Accept       json
+//	@Produce      json
+//	@Success      200  {object}  data.Document
+//	@Failure      400  {string}  "Bad json request"
+//	@Failure      401  {string}  "Unauthorized"
+//	@Failure      403  {string}  "Forbidden"
+//	@Failure      404  {string}  "Not found"
+//	@Failure      409  {string}  "Edit conflict"
+//	@Failure      412  {string}  "If-Match precondition failed"
+//	@Failure      422  {string}  "Invalid watermark or document isn't an unprotected PDF"
+//	@Failure      500  {string}  "Internal server error"
+//	@Router       /document/:id/watermark [put]
+func (app *application) documentWatermarkSetHandler(w http.ResponseWriter, r *http.Request) {
+	document, ok := app.readDocument(w, r, accessManage)
+	if !ok {
+		return
+	}
+
+	input := watermarkInput{}
+
+	err := utils.ReadJSON(w, r, &input)
+	if err != nil {
+		utils.BadRequestResponse(w, r, err) //? http.StatusBadRequest - 400
+		return
+	}
+
+	validate := validator.New()
+	err = validate.Struct(input)
+	if err != nil {
+		utils.FailedValidationResponseValidator(w, r, err) //? http.StatusUnprocessableEntity - 422
+		return
+	}
+
+	//? stamping happens on download, files which can't take it would become undownloadable for viewers
+	if document.Filetype != utils.FiletypePDF || document.Is_encrypted {
+		utils.FailedValidationResponse(w, r, map[string]string{"document": "only PDFs without password can be watermarked"}) //? http.StatusUnprocessableEntity - 422
+		return
+	}
+
+	document.Watermark = input.watermark()
+	app.saveWatermark(w, r, document)
+}
+
+// Remove document watermark
+//
+//	@Summary      Remove document watermark
+//	@Description  Stop stamping document on download, watermarks of its share links still apply
+//	@Tags         document
+//	@Produce      json
+//	@Success      200  {object}  data.Document
+//	@Failure      401  {string}  "Unauthorized"
+//	@Failure      403  {string}  "Forbidden"
+//	@Failure      404  {string}  "Not found"
+//	@Failure      409  {string}  "Edit conflict"
+//	@Failure      412  {string}  "If-Match precondition failed"
+//	@Failure      500  {string}  "Internal server error"
+//	@Router       /document/:id/watermark [delete]
+func (app *application) documentWatermarkDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	document, ok := app.readDocument(w, r, accessManage)
+	if !ok {
+		return
+	}
+
+	document.Watermark = nil
+	app.saveWatermark(w, r, document)
+}
+
+func (app *application) saveWatermark(w http.ResponseWriter, r *http.Request, document *data.Document) {
+	err := app.data_access.Documents.SetWatermark(document)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			utils.EditConflictResponse(w, r) //? http.StatusConflict - 409
+		default:
+			utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+		}
+		return
+	}
+
+	//? cached public listing would keep linking preview of now watermarked document
+	err = app.redis_client.Del(context.TODO(), "defaultValues").Err()
+	if err != nil {
+		log.Error("failed dropping cached response", err)
+	}
+
+	headers := http.Header{}
+	headers.Set("ETag", utils.VersionETag(document.Version))
+
+	err = utils.WriteJSON(w, http.StatusOK, utils.Wrap{"document": document}, headers)
+	if err != nil {
+		utils.ServerErrorResponse(w, r, err) //? http.StatusInternalServerError - 500
+	}
+}
@@ -4,8 +4,9 @@ import (
 	"sync"
 	"viadro_api/config"
 	"viadro_api/internal/data"
+	"viadro_api/internal/preview"
+	"viadro_api/internal/storage"
 
-	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/charmbracelet/log"
 	"github.com/redis/go-redis/v9"
 	"github.com/wneessen/go-mail"
@@ -13,10 +14,13 @@ import (
 
 type application struct {
 	data_access  data.Layers
-	s3_client    *s3.Client
+	storage      storage.BlobStore
+	renderer     preview.Renderer
 	redis_client *redis.Client
 	mail_client  *mail.Client
+	settings     config.Settings
 	wait_group   sync.WaitGroup
+	quit         chan struct{}
 }
 
 // @title						Viadro API
@@ -35,18 +39,48 @@ type application struct {
 // @license.name				MIT License
 // @license.url				https://github.com/niewolinsky/go-viadro_api/blob/main/license.txt
 func main() {
-	mail_client, s3_client, postgres_client, redis_client, app_port := config.InitConfig()
+	mail_client, blob_store, kms, postgres_client, redis_client, settings := config.InitConfig()
 	defer postgres_client.Close()
 	defer redis_client.Close()
 
+	//? builtin renderer only typesets text of the page, external one draws it as it looks
+	var renderer preview.Renderer = preview.Builtin{}
+	if len(settings.Preview_command) > 0 {
+		renderer = preview.Command{Args: settings.Preview_command, Fallback: preview.Builtin{}}
+	}
+
+	data_access := data.NewLayers(postgres_client)
+
+	//? documents stored before encryption was enabled stay readable, they just aren't encrypted
+	if kms != nil {
+		blob_store = storage.NewEncryptedStore(blob_store, kms, blobKeyStore{keys: data_access.BlobKeys})
+	}
+
 	app := &application{
-		data_access:  data.NewLayers(postgres_client),
-		s3_client:    s3_client,
+		data_access:  data_access,
+		storage:      blob_store,
+		renderer:     renderer,
 		redis_client: redis_client,
 		mail_client:  mail_client,
+		settings:     settings,
+		quit:         make(chan struct{}),
 	}
 
-	err := app.serve(app_port)
+	if settings.Rotate_keys {
+		if kms == nil {
+			log.Fatal("encryption at rest isn't configured, there are no keys to rotate")
+		}
+
+		err := app.rotateKeys(kms)
+		if err != nil {
+			log.Fatal("failed rotating data keys", err)
+		}
+		return
+	}
+
+	app.startJobs()
+
+	err := app.serve(settings.Port)
 	if err != nil {
 		log.Fatal("failed starting server", err)
 	}
@@ -0,0 +1,467 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"viadro_api/internal/data"
+	"viadro_api/internal/extract"
+	"viadro_api/internal/pdf"
+	"viadro_api/internal/preview"
+	"viadro_api/internal/storage"
+	"viadro_api/utils"
+
+	"github.com/charmbracelet/log"
+)
+
+func (app *application) startJobs() {
+	app.failInterruptedJobs()
+
+	app.schedule(time.Hour, app.abortStaleUploads)
+	app.schedule(time.Hour, app.purgeExpiredTrash)
+	//? catches documents left behind when deletion job was interrupted by a crash
+	app.schedule(time.Hour, func() { app.purgeOrphanedDocuments(nil) })
+	app.schedule(time.Hour, app.removeExpiredExports)
+	app.schedule(time.Hour, app.removeFinishedJobs)
+	//? catches documents stored before indexing existed and those whose indexing was interrupted
+	app.schedule(time.Minute, app.indexPendingDocuments)
+	//? fills metadata of documents stored before it was read on upload
+	app.schedule(time.Minute, app.inspectPendingDocuments)
+	//? catches documents stored before previews existed and those whose rendering was interrupted
+	app.schedule(time.Minute, app.previewPendingDocuments)
+}
+
+// contentLimit caps text extracted from single document, tsvector of longer text wouldn't fit PostgreSQL's 1MB limit.
+const contentLimit = 512 << 10
+
+// processDocument indexes text of document's current revision and renders its preview in background, both are read
+// from local copy of the blob made by caller, so the blob isn't fetched again. The copy is removed afterwards.
+func (app *application) processDocument(document *data.Document, file *os.File) {
+	document_id, storage_key, filetype := document.Document_id, document.Storage_key, document.Filetype
+
+	app.background(func() {
+		defer removeTemp(file)
+
+		//? on failure the document is left pending, scheduled jobs pick it up again
+		info, err := file.Stat()
+		if err != nil {
+			log.Error(fmt.Sprintf("failed processing document %d", document_id), err)
+			return
+		}
+
+		err = app.extractContent(document_id, storage_key, filetype, file, info.Size())
+		if err != nil {
+			log.Error(fmt.Sprintf("failed indexing document %d", document_id), err)
+		}
+
+		reused, err := app.reusePreview(document_id, storage_key)
+		if err == nil && !reused {
+			err = app.renderPreview(document_id, storage_key, filetype, file, info.Size())
+		}
+		if err != nil {
+			log.Error(fmt.Sprintf("failed generating preview of document %d", document_id), err)
+		}
+	})
+}
+
+// indexBlob fetches blob and stores its text as content of document.
+func (app *application) indexBlob(document_id int, storage_key string, filetype string) error {
+	file, size, err := app.fetchTemp(storage_key)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrObjectNotFound):
+			return app.data_access.Documents.SetContent(document_id, storage_key, "")
+		default:
+			return err
+		}
+	}
+	defer removeTemp(file)
+
+	return app.extractContent(document_id, storage_key, filetype, file, size)
+}
+
+// extractContent stores text of blob's local copy as content of document.
+func (app *application) extractContent(document_id int, storage_key string, filetype string, file *os.File, size int64) error {
+	//? documents which can't be read are not retried, they can still be found by title
+	text, err := extract.Text(file, size, filetype, contentLimit)
+	if err != nil && !errors.Is(err, extract.ErrUnsupportedFiletype) {
+		log.Error(fmt.Sprintf("failed extracting text of document %d", document_id), err)
+	}
+
+	return app.data_access.Documents.SetContent(document_id, storage_key, text)
+}
+
+// previewTimeout bounds rendering of single preview, external renderers can hang on damaged files.
+const previewTimeout = time.Minute
+
+// makePreview fetches blob and stores its preview next to it, preview already made for the same blob
+// by another document or revision is reused.
+func (app *application) makePreview(document_id int, storage_key string, filetype string) error {
+	reused, err := app.reusePreview(document_id, storage_key)
+	if err != nil || reused {
+		return err
+	}
+
+	file, size, err := app.fetchTemp(storage_key)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrObjectNotFound):
+			return app.setPreview(document_id, storage_key, "")
+		default:
+			return err
+		}
+	}
+	defer removeTemp(file)
+
+	return app.renderPreview(document_id, storage_key, filetype, file, size)
+}
+
+// reusePreview records preview already stored for blob on document, true is returned when there was one.
+func (app *application) reusePreview(document_id int, storage_key string) (bool, error) {
+	preview_key := storage.PreviewKey(storage_key)
+
+	_, err := app.storage.Stat(context.TODO(), preview_key)
+	if err != nil {
+		if errors.Is(err, storage.ErrObjectNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, app.setPreview(document_id, storage_key, preview_key)
+}
+
+// renderPreview renders first page of blob's local copy, stores it next to the blob and records its key on document.
+func (app *application) renderPreview(document_id int, storage_key string, filetype string, file *os.File, size int64) error {
+	_, err := file.Seek(0, io.SeekStart)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), previewTimeout)
+	defer cancel()
+
+	//? documents whose preview can't be rendered are not retried, clients fall back to a generic icon
+	image := bytes.Buffer{}
+	err = preview.Generate(ctx, app.renderer, file, size, filetype, &image)
+	if err != nil {
+		if !errors.Is(err, preview.ErrUnsupportedFiletype) {
+			log.Error(fmt.Sprintf("failed rendering preview of document %d", document_id), err)
+		}
+		return app.setPreview(document_id, storage_key, "")
+	}
+
+	preview_key := storage.PreviewKey(storage_key)
+
+	_, err = app.storage.Put(context.TODO(), preview_key, &image, storage.PutOptions{Content_type: "image/png"})
+	if err != nil {
+		return err
+	}
+
+	return app.setPreview(document_id, storage_key, preview_key)
+}
+
+// setPreview records preview of document, cached public listing is dropped so it shows up there too.
+func (app *application) setPreview(document_id int, storage_key string, preview_key string) error {
+	err := app.data_access.Documents.SetPreview(document_id, storage_key, preview_key)
+	if err != nil || preview_key == "" {
+		return err
+	}
+
+	err = app.redis_client.Del(context.TODO(), "defaultValues").Err()
+	if err != nil {
+		log.Error("failed dropping cached response", err)
+	}
+
+	return nil
+}
+
+// fetchTemp copies blob to temporary file, parsers need random access to it which storage doesn't offer.
+// File has to be released with removeTemp.
+func (app *application) fetchTemp(storage_key string) (*os.File, int64, error) {
+	body, _, err := app.storage.Get(context.TODO(), storage_key)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer body.Close()
+
+	file, err := os.CreateTemp("", "viadro-blob-*")
+	if err != nil {
+		return nil, 0, err
+	}
+
+	size, err := io.Copy(file, body)
+	if err == nil {
+		_, err = file.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		removeTemp(file)
+		return nil, 0, err
+	}
+
+	return file, size, nil
+}
+
+func removeTemp(file *os.File) {
+	file.Close()
+	os.Remove(file.Name())
+}
+
+// inspectBlob reads metadata of blob, only size is known about files other than PDFs. Malformed PDF is reported
+// with pdf.ErrMalformed, returned metadata then still holds its size.
+func (app *application) inspectBlob(storage_key string, filetype string) (data.FileMetadata, error) {
+	if filetype != utils.FiletypePDF {
+		info, err := app.storage.Stat(context.TODO(), storage_key)
+		if err != nil {
+			return data.FileMetadata{}, err
+		}
+		return data.FileMetadata{Size: &info.Size}, nil
+	}
+
+	file, size, err := app.fetchTemp(storage_key)
+	if err != nil {
+		return data.FileMetadata{}, err
+	}
+	defer removeTemp(file)
+
+	return inspectFile(file, size, filetype)
+}
+
+// inspectFile reads metadata of blob's local copy, like inspectBlob does.
+func inspectFile(file *os.File, size int64, filetype string) (data.FileMetadata, error) {
+	metadata := data.FileMetadata{Size: &size}
+
+	if filetype != utils.FiletypePDF {
+		return metadata, nil
+	}
+
+	_, err := file.Seek(0, io.SeekStart)
+	if err != nil {
+		return metadata, err
+	}
+
+	info, err := pdf.Inspect(file)
+	if err != nil {
+		return metadata, err
+	}
+
+	metadata.Is_encrypted = info.Encrypted
+	if info.Page_count > 0 {
+		metadata.Page_count = &info.Page_count
+	}
+	if info.Title != "" {
+		metadata.Pdf_title = &info.Title
+	}
+	if info.Author != "" {
+		metadata.Pdf_author = &info.Author
+	}
+	if info.Producer != "" {
+		metadata.Pdf_producer = &info.Producer
+	}
+	metadata.Pdf_created_at = info.Created_at
+
+	return metadata, nil
+}
+
+// indexPendingDocuments extracts content of documents which weren't indexed yet, a batch at a time.
+func (app *application) indexPendingDocuments() {
+	documents, err := app.data_access.Documents.GetUnindexed(100)
+	if err != nil {
+		log.Error("failed fetching documents pending indexing", err)
+		return
+	}
+
+	indexed := 0
+	for _, document := range documents {
+		err = app.indexBlob(document.Document_id, document.Storage_key, document.Filetype)
+		if err != nil {
+			log.Error(fmt.Sprintf("failed indexing document %d", document.Document_id), err)
+			continue
+		}
+		indexed++
+	}
+
+	if indexed > 0 {
+		log.Info(fmt.Sprintf("indexed content of %d documents", indexed))
+	}
+}
+
+// inspectPendingDocuments reads metadata of documents stored before it was collected, a batch at a time.
+func (app *application) inspectPendingDocuments() {
+	documents, err := app.data_access.Documents.GetUninspected(100)
+	if err != nil {
+		log.Error("failed fetching documents pending inspection", err)
+		return
+	}
+
+	inspected := 0
+	for _, document := range documents {
+		//? already stored documents are kept even when malformed, the size is all that is known about them then
+		metadata, err := app.inspectBlob(document.Storage_key, document.Filetype)
+		if err != nil && !errors.Is(err, pdf.ErrMalformed) {
+			if !errors.Is(err, storage.ErrObjectNotFound) {
+				log.Error(fmt.Sprintf("failed inspecting document %d", document.Document_id), err)
+				continue
+			}
+			//? content is gone, zero size keeps the document from being picked up again
+			size := int64(0)
+			metadata.Size = &size
+		}
+
+		err = app.data_access.Documents.SetMetadata(document.Document_id, document.Storage_key, metadata)
+		if err != nil {
+			log.Error(fmt.Sprintf("failed inspecting document %d", document.Document_id), err)
+			continue
+		}
+		inspected++
+	}
+
+	if inspected > 0 {
+		log.Info(fmt.Sprintf("inspected metadata of %d documents", inspected))
+	}
+}
+
+// previewPendingDocuments renders previews of documents which don't have one yet, a batch at a time.
+func (app *application) previewPendingDocuments() {
+	documents, err := app.data_access.Documents.GetUnpreviewed(100)
+	if err != nil {
+		log.Error("failed fetching documents pending preview", err)
+		return
+	}
+
+	generated := 0
+	for _, document := range documents {
+		err = app.makePreview(document.Document_id, document.Storage_key, document.Filetype)
+		if err != nil {
+			log.Error(fmt.Sprintf("failed generating preview of document %d", document.Document_id), err)
+			continue
+		}
+		generated++
+	}
+
+	if generated > 0 {
+		log.Info(fmt.Sprintf("generated previews of %d documents", generated))
+	}
+}
+
+// abortStoredUpload discards parts of resumable upload already sent to storage.
+func (app *application) abortStoredUpload(upload data.Upload) error {
+	multipart_store, ok := app.storage.(storage.MultipartStore)
+	if !ok || upload.Storage_upload_id == "" {
+		return nil
+	}
+
+	err := multipart_store.AbortMultipart(context.TODO(), upload.Storage_key, upload.Storage_upload_id)
+	if err != nil && !errors.Is(err, storage.ErrUploadNotFound) {
+		return err
+	}
+
+	return nil
+}
+
+// abortStaleUploads removes resumable upload sessions which were not touched for longer than configured ttl.
+func (app *application) abortStaleUploads() {
+	uploads, err := app.data_access.Uploads.GetStale(time.Now().Add(-app.settings.Upload_session_ttl))
+	if err != nil {
+		log.Error("failed fetching stale uploads", err)
+		return
+	}
+
+	for _, upload := range uploads {
+		err = app.abortStoredUpload(upload)
+		if err != nil {
+			log.Error(fmt.Sprintf("failed aborting stale upload %d", upload.Upload_id), err)
+			continue
+		}
+
+		err = app.data_access.Uploads.Delete(upload.Upload_id)
+		if err != nil {
+			log.Error(fmt.Sprintf("failed deleting stale upload %d", upload.Upload_id), err)
+		}
+	}
+
+	if len(uploads) > 0 {
+		log.Info(fmt.Sprintf("aborted %d stale uploads", len(uploads)))
+	}
+}
+
+// purgeExpiredTrash permanently deletes documents which stayed in trash for longer than configured retention.
+func (app *application) purgeExpiredTrash() {
+	documents, err := app.data_access.Documents.GetExpiredDeleted(time.Now().Add(-app.settings.Trash_retention))
+	if err != nil {
+		log.Error("failed fetching expired trash", err)
+		return
+	}
+
+	purged := 0
+	for i := range documents {
+		err = app.purgeDocument(&documents[i])
+		if err != nil {
+			log.Error(fmt.Sprintf("failed purging document %d", documents[i].Document_id), err)
+			continue
+		}
+		purged++
+	}
+
+	if purged > 0 {
+		log.Info(fmt.Sprintf("purged %d documents from trash", purged))
+	}
+}
+
+// purgeOrphanedDocuments permanently deletes documents of deleted users with their stored objects,
+// user_id limits it to documents of single deleted user.
+func (app *application) purgeOrphanedDocuments(user_id *int) {
+	documents, err := app.data_access.Documents.GetOrphaned(user_id)
+	if err != nil {
+		log.Error("failed fetching orphaned documents", err)
+		return
+	}
+
+	purged := 0
+	for i := range documents {
+		err = app.purgeDocument(&documents[i])
+		if err != nil {
+			log.Error(fmt.Sprintf("failed purging orphaned document %d", documents[i].Document_id), err)
+			continue
+		}
+		purged++
+	}
+
+	if purged > 0 {
+		log.Info(fmt.Sprintf("purged %d documents of deleted users", purged))
+	}
+}
+
+// removeExpiredExports deletes archives of background exports whose download links expired.
+func (app *application) removeExpiredExports() {
+	exports, err := app.data_access.Exports.GetExpired(time.Now())
+	if err != nil {
+		log.Error("failed fetching expired exports", err)
+		return
+	}
+
+	removed := 0
+	for _, export := range exports {
+		err = app.storage.Delete(context.TODO(), export.Storage_key)
+		if err != nil && !errors.Is(err, storage.ErrObjectNotFound) {
+			log.Error(fmt.Sprintf("failed deleting expired export %d", export.Export_id), err)
+			continue
+		}
+
+		err = app.data_access.Exports.Delete(export.Export_id)
+		if err != nil {
+			log.Error(fmt.Sprintf("failed deleting expired export %d", export.Export_id), err)
+			continue
+		}
+		removed++
+	}
+
+	if removed > 0 {
+		log.Info(fmt.Sprintf("removed %d expired exports", removed))
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"viadro_api/internal/data"
+	"viadro_api/internal/envelope"
+	"viadro_api/internal/storage"
+
+	"github.com/charmbracelet/log"
+)
+
+// blobKeyStore keeps wrapped data keys of encrypted objects in the database for storage.EncryptedStore.
+type blobKeyStore struct {
+	keys data.BlobKeyLayer
+}
+
+func (b blobKeyStore) SaveKey(ctx context.Context, key string, wrapped []byte, key_id string) error {
+	return b.keys.Save(&data.BlobKey{Storage_key: key, Wrapped_key: wrapped, Key_id: key_id})
+}
+
+func (b blobKeyStore) LoadKey(ctx context.Context, key string) ([]byte, string, error) {
+	blob_key, err := b.keys.Get(key)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			return nil, "", storage.ErrKeyNotFound
+		}
+		return nil, "", err
+	}
+
+	return blob_key.Wrapped_key, blob_key.Key_id, nil
+}
+
+func (b blobKeyStore) DeleteKey(ctx context.Context, key string) error {
+	err := b.keys.Delete(key)
+	if errors.Is(err, data.ErrRecordNotFound) {
+		return storage.ErrKeyNotFound
+	}
+
+	return err
+}
+
+// rotateKeysBatch is the number of data keys rewrapped per query.
+const rotateKeysBatch = 100
+
+// rotateKeys rewraps data keys wrapped with previous master keys with the current one, encrypted objects stay
+// as they are. Previous master keys can be dropped from configuration once no keys are left behind.
+func (app *application) rotateKeys(kms envelope.KMS) error {
+	current := kms.CurrentKey()
+	rotated, failed := 0, 0
+
+	after := ""
+	for {
+		keys, err := app.data_access.BlobKeys.GetNotWrappedWith(current, after, rotateKeysBatch)
+		if err != nil {
+			return err
+		}
+		if len(keys) == 0 {
+			break
+		}
+
+		for _, key := range keys {
+			after = key.Storage_key
+
+			err = rewrapKey(app.data_access.BlobKeys, kms, key)
+			if err != nil {
+				//? key changed since it was read was wrapped with the current master key meanwhile
+				if !errors.Is(err, data.ErrEditConflict) {
+					log.Error(fmt.Sprintf("failed rotating data key of %s", key.Storage_key), err)
+					failed++
+				}
+				continue
+			}
+			rotated++
+		}
+	}
+
+	log.Info(fmt.Sprintf("rotated %d data keys to master key %s", rotated, current))
+	if failed > 0 {
+		return fmt.Errorf("%d data keys couldn't be rotated, keep their master keys", failed)
+	}
+
+	return nil
+}
+
+func rewrapKey(keys data.BlobKeyLayer, kms envelope.KMS, key *data.BlobKey) error {
+	data_key, err := kms.Unwrap(context.TODO(), key.Wrapped_key, key.Key_id)
+	if err != nil {
+		return err
+	}
+
+	old_key_id := key.Key_id
+
+	key.Wrapped_key, key.Key_id, err = kms.Wrap(context.TODO(), data_key)
+	if err != nil {
+		return err
+	}
+
+	return keys.Rewrap(key, old_key_id)
+}
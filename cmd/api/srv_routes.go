@@ -3,6 +3,8 @@ package main
 import (
 	"net/http"
 
+	"viadro_api/internal/storage"
+
 	"github.com/julienschmidt/httprouter"
 )
 
@@ -13,21 +15,86 @@ func (app *application) routes() http.Handler {
 	router.HandlerFunc(http.MethodGet, "/v1/healthcheck", app.healthcheckHandler)
 	router.Handle(http.MethodGet, "/v1/documentation/:any", app.documentationHandler)
 
+	//?storage routes, only drivers without their own endpoint (local, memory) serve blobs through the API, always behind presigned links
+	blob_store := app.storage
+	if encrypted_store, ok := blob_store.(*storage.EncryptedStore); ok {
+		//? encrypted objects can't be presigned, so only those stored in plaintext are ever served
+		blob_store = encrypted_store.Unwrap()
+	}
+	if blob_handler, ok := blob_store.(http.Handler); ok {
+		router.Handler(http.MethodGet, "/v1/storage/*key", http.StripPrefix("/v1/storage", blob_handler))
+		router.Handler(http.MethodHead, "/v1/storage/*key", http.StripPrefix("/v1/storage", blob_handler))
+	}
+
 	//?document routes
 	router.HandlerFunc(http.MethodGet, "/v1/documents", app.documentGetAllHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/documents/bulk", app.requireActivatedUser(app.documentBulkHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/documents/export", app.requireActivatedUser(app.documentExportHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/export/:token", app.exportDownloadHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/documents/merge", app.requireActivatedUser(app.documentMergeHandler))
 	router.HandlerFunc(http.MethodGet, "/v1/document/:id", app.documentGetHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/document/:id/download", app.documentDownloadHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/document/:id/preview", app.documentPreviewHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/document/:id/content", app.documentContentHandler)
+	router.HandlerFunc(http.MethodHead, "/v1/document/:id/content", app.documentContentHandler)
 	router.HandlerFunc(http.MethodPost, "/v1/document", app.requireActivatedUser(app.documentAddHandler))
 	router.HandlerFunc(http.MethodDelete, "/v1/document/:id", app.requireActivatedUser(app.documentDeleteHandler))
 	router.HandlerFunc(http.MethodPatch, "/v1/document/:id", app.requireActivatedUser(app.documentToggleVisibilityHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/document/:id/metadata", app.requireActivatedUser(app.documentUpdateHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/document/:id/watermark", app.requireActivatedUser(app.documentWatermarkSetHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/document/:id/watermark", app.requireActivatedUser(app.documentWatermarkDeleteHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/document/:id/versions", app.documentVersionGetAllHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/document/:id/versions", app.requireActivatedUser(app.documentVersionAddHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/document/:id/versions/:version", app.documentVersionDownloadHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/document/:id/versions/:version/restore", app.requireActivatedUser(app.documentVersionRestoreHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/document/:id/split", app.requireActivatedUser(app.documentSplitHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/document/:id/extract", app.requireActivatedUser(app.documentExtractHandler))
+
+	//?job routes
+	router.HandlerFunc(http.MethodGet, "/v1/jobs/:id", app.requireActivatedUser(app.jobGetHandler))
+
+	//?share routes
+	router.HandlerFunc(http.MethodGet, "/v1/document/:id/shares", app.requireActivatedUser(app.shareGetAllHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/document/:id/shares", app.requireActivatedUser(app.shareCreateHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/document/:id/shares/:share", app.requireActivatedUser(app.shareDeleteHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/share/:token", app.shareResolveHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/share/:token", app.shareResolveHandler)
+
+	//?permission routes
+	router.HandlerFunc(http.MethodGet, "/v1/document/:id/permissions", app.requireActivatedUser(app.permissionGetAllHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/document/:id/permissions", app.requireActivatedUser(app.permissionGrantHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/document/:id/permissions/:user", app.requireActivatedUser(app.permissionRevokeHandler))
+
+	//?trash routes
+	router.HandlerFunc(http.MethodGet, "/v1/trash", app.requireActivatedUser(app.trashGetAllHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/document/:id/restore", app.requireActivatedUser(app.documentRestoreHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/trash/:id", app.requireActivatedUser(app.trashPurgeHandler))
+
+	//?folder routes
+	router.HandlerFunc(http.MethodGet, "/v1/folders", app.requireActivatedUser(app.folderGetAllHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/folder", app.requireActivatedUser(app.folderCreateHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/folder/:id", app.requireActivatedUser(app.folderGetHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/folder/:id", app.requireActivatedUser(app.folderUpdateHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/folder/:id", app.requireActivatedUser(app.folderDeleteHandler))
+
+	//?resumable upload routes
+	router.HandlerFunc(http.MethodPost, "/v1/uploads", app.requireActivatedUser(app.uploadCreateHandler))
+	router.HandlerFunc(http.MethodHead, "/v1/uploads/:id", app.requireActivatedUser(app.uploadStatusHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/uploads/:id", app.requireActivatedUser(app.uploadChunkHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/uploads/:id", app.requireActivatedUser(app.uploadAbortHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/uploads/:id/complete", app.requireActivatedUser(app.uploadCompleteHandler))
 
 	//?user routes
 	router.HandlerFunc(http.MethodPost, "/v1/user", app.userRegisterHandler)
 	router.HandlerFunc(http.MethodPut, "/v1/user/activate", app.userActivateHandler)
 	router.HandlerFunc(http.MethodPut, "/v1/user/authenticate", app.userAuthenticateHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/user/password-reset", app.userPasswordResetHandler)
+	router.HandlerFunc(http.MethodPut, "/v1/user/password", app.userPasswordUpdateHandler)
 	router.HandlerFunc(http.MethodDelete, "/v1/user/:id", app.requireActivatedUser(app.userDeleteHandler))
 
 	//?admin routes
 	router.HandlerFunc(http.MethodPatch, "/v1/admin/user/:id", app.requireAdminUser(app.adminGrantPrivilegesHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/admin/user/:id/upload-limit", app.requireAdminUser(app.adminSetUploadLimitHandler))
 	router.HandlerFunc(http.MethodGet, "/v1/admin/users", app.requireAdminUser(app.adminGetAllUsersHandler))
 	router.HandlerFunc(http.MethodGet, "/v1/admin/documents", app.requireAdminUser(app.adminGetAllDocumentsHandler))
 
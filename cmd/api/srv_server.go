@@ -36,23 +36,21 @@ func (app *application) serve(app_port string) error {
 		err := srv.Shutdown(ctx)
 		if err != nil {
 			shutdown_signal <- err
+			return
 		}
 
 		log.Info("waiting for background tasks to finish")
 
+		close(app.quit)
+
 		app.wait_group.Wait()
 		shutdown_signal <- nil
 	}()
 
 	log.Info("starting server")
 	err := srv.ListenAndServe()
-	if err != nil {
-		switch {
-		case errors.Is(err, http.ErrServerClosed):
-			return nil
-		default:
-			return err
-		}
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
 	}
 
 	err = <-shutdown_signal
@@ -62,3 +60,36 @@ func (app *application) serve(app_port string) error {
 
 	return nil
 }
+
+func (app *application) background(fn func()) {
+	app.wait_group.Add(1)
+
+	go func() {
+		defer app.wait_group.Done()
+
+		defer func() {
+			if err := recover(); err != nil {
+				log.Error("background task panicked", fmt.Errorf("%s", err))
+			}
+		}()
+
+		fn()
+	}()
+}
+
+// schedule runs fn every interval in background until the server shuts down.
+func (app *application) schedule(interval time.Duration, fn func()) {
+	app.background(func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				fn()
+			case <-app.quit:
+				return
+			}
+		}
+	})
+}
@@ -2,9 +2,16 @@ package config
 
 import (
 	"context"
+	"errors"
 	"flag"
+	"fmt"
 	"os"
 	"strconv"
+	"strings"
+	"time"
+	"viadro_api/internal/envelope"
+	"viadro_api/internal/storage"
+	"viadro_api/utils"
 
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
@@ -15,9 +22,25 @@ import (
 	"github.com/wneessen/go-mail"
 )
 
+// Settings holds application-level options which handlers need at runtime.
+type Settings struct {
+	Port               string
+	Url                string
+	Allowed_filetypes  []string
+	Max_upload_size    int64
+	Upload_timeout     time.Duration
+	Upload_session_ttl time.Duration
+	Download_url_ttl   time.Duration
+	Trash_retention    time.Duration
+	Export_link_ttl    time.Duration
+	Preview_command    []string
+	Rotate_keys        bool
+}
+
 type configuration struct {
 	version string
 	port    string
+	url     string
 	env     string
 	db      struct {
 		dsn string
@@ -34,6 +57,35 @@ type configuration struct {
 		password string
 		sender   string
 	}
+	upload struct {
+		allowed_filetypes string
+		max_size          int64
+		timeout           time.Duration
+		session_ttl       time.Duration
+	}
+	storage struct {
+		driver   string
+		path     string
+		url      string
+		secret   string
+		bucket   string
+		link_ttl time.Duration
+	}
+	trash struct {
+		retention time.Duration
+	}
+	export struct {
+		link_ttl time.Duration
+	}
+	preview struct {
+		command string
+	}
+	encryption struct {
+		master_key    string
+		previous_keys string
+		keyring       string
+		rotate        bool
+	}
 }
 
 func initializePostgresClient(cfg configuration) (*pgxpool.Pool, error) {
@@ -59,14 +111,49 @@ func initializeRedisClient(cfg configuration) (*redis.Client, error) {
 	return cache_client, nil
 }
 
-func initializeS3Client() (*s3.Client, error) {
+func initializeS3Store(cfg configuration) (*storage.S3Store, error) {
 	aws_cfg, err := config.LoadDefaultConfig(context.TODO())
 	if err != nil {
 		return nil, err
 	}
 	s3_client := s3.NewFromConfig(aws_cfg)
 
-	return s3_client, nil
+	return storage.NewS3Store(s3_client, cfg.storage.bucket, aws_cfg.Region), nil
+}
+
+func initializeStorage(cfg configuration) (storage.BlobStore, error) {
+	switch cfg.storage.driver {
+	case "s3", "":
+		s3_store, err := initializeS3Store(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return s3_store, nil
+	case "local":
+		return storage.NewLocalStore(cfg.storage.path, cfg.storage.url, cfg.storage.secret)
+	case "memory":
+		return storage.NewMemoryStore(cfg.storage.url, cfg.storage.secret)
+	default:
+		return nil, fmt.Errorf("unknown storage driver: %s", cfg.storage.driver)
+	}
+}
+
+// initializeKMS returns KMS wrapping data keys of encrypted documents, nil when encryption at rest is disabled.
+func initializeKMS(cfg configuration) (envelope.KMS, error) {
+	switch {
+	case cfg.encryption.master_key != "" && cfg.encryption.keyring != "":
+		return nil, errors.New("master key and keyring file can't be used together")
+	case cfg.encryption.master_key != "":
+		previous_keys := []string{}
+		if cfg.encryption.previous_keys != "" {
+			previous_keys = strings.Split(strings.ReplaceAll(cfg.encryption.previous_keys, " ", ""), ",")
+		}
+		return envelope.NewMasterKeyring(cfg.encryption.master_key, previous_keys)
+	case cfg.encryption.keyring != "":
+		return envelope.LoadKeyring(cfg.encryption.keyring)
+	default:
+		return nil, nil
+	}
 }
 
 func initializeMailClient(cfg configuration) (*mail.Client, error) {
@@ -78,7 +165,7 @@ func initializeMailClient(cfg configuration) (*mail.Client, error) {
 	return mail_client, nil
 }
 
-func InitConfig() (*mail.Client, *s3.Client, *pgxpool.Pool, *redis.Client, string) {
+func InitConfig() (*mail.Client, storage.BlobStore, envelope.KMS, *pgxpool.Pool, *redis.Client, Settings) {
 	config := configuration{}
 
 	err := godotenv.Load()
@@ -91,6 +178,7 @@ func InitConfig() (*mail.Client, *s3.Client, *pgxpool.Pool, *redis.Client, strin
 	flag.StringVar(&config.port, "port", os.Getenv("APP_PORT"), "application erver port")
 	flag.StringVar(&config.version, "version", os.Getenv("APP_VERSION"), "application version")
 	flag.StringVar(&config.env, "env", os.Getenv("APP_ENVIRONMENT"), "application environment")
+	flag.StringVar(&config.url, "url", os.Getenv("APP_URL"), "Public base URL of the API, links sent by email point there")
 
 	//?POSTGRES
 	flag.StringVar(&config.db.dsn, "db-dsn", os.Getenv("POSTGRES_DSN"), "PostgreSQL DSN")
@@ -115,6 +203,75 @@ func InitConfig() (*mail.Client, *s3.Client, *pgxpool.Pool, *redis.Client, strin
 	flag.StringVar(&config.smtp.password, "smtp_password", os.Getenv("SMTP_PASSWORD"), "SMTP password")
 	flag.StringVar(&config.smtp.sender, "smtp_sender", os.Getenv("SMTP_SENDER"), "SMTP sender")
 
+	//?STORAGE
+	flag.StringVar(&config.storage.driver, "storage_driver", os.Getenv("STORAGE_DRIVER"), "Storage driver (s3|local|memory)")
+	flag.StringVar(&config.storage.path, "storage_path", os.Getenv("STORAGE_PATH"), "Local storage root directory")
+	flag.StringVar(&config.storage.url, "storage_url", os.Getenv("STORAGE_URL"), "Public base URL of blobs served by local and memory storage")
+	flag.StringVar(&config.storage.secret, "storage_secret", os.Getenv("STORAGE_SECRET"), "Secret used to sign local and memory storage links, at least 32 bytes")
+	flag.StringVar(&config.storage.bucket, "s3_bucket", os.Getenv("AWS_S3_BUCKET_NAME"), "S3 bucket name")
+	DOWNLOAD_URL_TTL := 15 * time.Minute
+	if os.Getenv("DOWNLOAD_URL_TTL") != "" {
+		DOWNLOAD_URL_TTL, err = time.ParseDuration(os.Getenv("DOWNLOAD_URL_TTL"))
+		if err != nil {
+			log.Fatal("failed setting download url ttl", err)
+		}
+	}
+	flag.DurationVar(&config.storage.link_ttl, "download_url_ttl", DOWNLOAD_URL_TTL, "Validity period of presigned download links")
+
+	//?UPLOAD
+	flag.StringVar(&config.upload.allowed_filetypes, "allowed_filetypes", os.Getenv("ALLOWED_FILETYPES"), "Comma separated list of accepted MIME types")
+	MAX_UPLOAD_SIZE := int64(100 << 20)
+	if os.Getenv("MAX_UPLOAD_SIZE") != "" {
+		MAX_UPLOAD_SIZE, err = strconv.ParseInt(os.Getenv("MAX_UPLOAD_SIZE"), 10, 64)
+		if err != nil {
+			log.Fatal("failed setting max upload size", err)
+		}
+	}
+	flag.Int64Var(&config.upload.max_size, "max_upload_size", MAX_UPLOAD_SIZE, "Default maximum size of uploaded file in bytes")
+	UPLOAD_TIMEOUT := time.Hour
+	if os.Getenv("UPLOAD_TIMEOUT") != "" {
+		UPLOAD_TIMEOUT, err = time.ParseDuration(os.Getenv("UPLOAD_TIMEOUT"))
+		if err != nil {
+			log.Fatal("failed setting upload timeout", err)
+		}
+	}
+	flag.DurationVar(&config.upload.timeout, "upload_timeout", UPLOAD_TIMEOUT, "Maximum duration of single upload request")
+	UPLOAD_SESSION_TTL := 24 * time.Hour
+	if os.Getenv("UPLOAD_SESSION_TTL") != "" {
+		UPLOAD_SESSION_TTL, err = time.ParseDuration(os.Getenv("UPLOAD_SESSION_TTL"))
+		if err != nil {
+			log.Fatal("failed setting upload session ttl", err)
+		}
+	}
+	flag.DurationVar(&config.upload.session_ttl, "upload_session_ttl", UPLOAD_SESSION_TTL, "Inactivity period after which resumable upload session is aborted")
+	TRASH_RETENTION := 30 * 24 * time.Hour
+	if os.Getenv("TRASH_RETENTION") != "" {
+		TRASH_RETENTION, err = time.ParseDuration(os.Getenv("TRASH_RETENTION"))
+		if err != nil {
+			log.Fatal("failed setting trash retention", err)
+		}
+	}
+	flag.DurationVar(&config.trash.retention, "trash_retention", TRASH_RETENTION, "Period after which documents in trash are purged permanently")
+
+	//?EXPORT
+	EXPORT_LINK_TTL := 72 * time.Hour
+	if os.Getenv("EXPORT_LINK_TTL") != "" {
+		EXPORT_LINK_TTL, err = time.ParseDuration(os.Getenv("EXPORT_LINK_TTL"))
+		if err != nil {
+			log.Fatal("failed setting export link ttl", err)
+		}
+	}
+	flag.DurationVar(&config.export.link_ttl, "export_link_ttl", EXPORT_LINK_TTL, "Period for which archives of background exports are kept and their emailed links stay valid")
+
+	//?PREVIEW
+	flag.StringVar(&config.preview.command, "preview_command", os.Getenv("PREVIEW_COMMAND"), "External command rendering first page of PDFs, with {input} and {output} placeholders")
+
+	//?ENCRYPTION
+	flag.StringVar(&config.encryption.master_key, "encryption_master_key", os.Getenv("ENCRYPTION_MASTER_KEY"), "Base64 encoded 32 byte master key wrapping data keys of encrypted documents")
+	flag.StringVar(&config.encryption.previous_keys, "encryption_previous_keys", os.Getenv("ENCRYPTION_PREVIOUS_KEYS"), "Comma separated master keys replaced by the current one, kept until data keys are rotated")
+	flag.StringVar(&config.encryption.keyring, "encryption_keyring", os.Getenv("ENCRYPTION_KEYRING"), "Path to JSON keyring file with master keys, used instead of master key")
+	flag.BoolVar(&config.encryption.rotate, "rotate_keys", false, "Rewrap data keys of encrypted documents with the current master key and exit")
+
 	flag.Parse()
 	log.Info("command line variables loaded")
 
@@ -130,11 +287,19 @@ func InitConfig() (*mail.Client, *s3.Client, *pgxpool.Pool, *redis.Client, strin
 	}
 	log.Info("redis client initialized")
 
-	s3_client, err := initializeS3Client()
+	blob_store, err := initializeStorage(config)
 	if err != nil {
-		log.Fatal("failed initializing s3 client", err)
+		log.Fatal("failed initializing storage", err)
+	}
+	log.Info("storage initialized")
+
+	kms, err := initializeKMS(config)
+	if err != nil {
+		log.Fatal("failed initializing encryption keys", err)
+	}
+	if kms != nil {
+		log.Info("encryption at rest enabled")
 	}
-	log.Info("s3 client initialized")
 
 	mail_client, err := initializeMailClient(config)
 	if err != nil {
@@ -142,5 +307,25 @@ func InitConfig() (*mail.Client, *s3.Client, *pgxpool.Pool, *redis.Client, strin
 	}
 	log.Info("mail client initialized")
 
-	return mail_client, s3_client, postgres_client, redis_client, config.port
+	settings := Settings{
+		Port:               config.port,
+		Url:                strings.TrimSuffix(config.url, "/"),
+		Allowed_filetypes:  utils.DefaultAllowedFiletypes,
+		Max_upload_size:    config.upload.max_size,
+		Upload_timeout:     config.upload.timeout,
+		Upload_session_ttl: config.upload.session_ttl,
+		Download_url_ttl:   config.storage.link_ttl,
+		Trash_retention:    config.trash.retention,
+		Export_link_ttl:    config.export.link_ttl,
+		Preview_command:    strings.Fields(config.preview.command),
+		Rotate_keys:        config.encryption.rotate,
+	}
+	if settings.Url == "" {
+		settings.Url = "http://localhost:" + config.port
+	}
+	if config.upload.allowed_filetypes != "" {
+		settings.Allowed_filetypes = strings.Split(strings.ReplaceAll(config.upload.allowed_filetypes, " ", ""), ",")
+	}
+
+	return mail_client, blob_store, kms, postgres_client, redis_client, settings
 }
@@ -0,0 +1,150 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// BlobKey is data key of encrypted object wrapped with master key of Key_id, objects without one are stored in plaintext.
+type BlobKey struct {
+	Storage_key string
+	Wrapped_key []byte
+	Key_id      string
+	Created_at  time.Time
+}
+
+type BlobKeyLayer struct {
+	DB *pgxpool.Pool
+}
+
+// Save stores data key of object, an overwritten object replaces key of the previous one.
+func (b BlobKeyLayer) Save(key *BlobKey) error {
+	query := `
+		INSERT INTO blob_keys (storage_key, wrapped_key, key_id)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (storage_key) DO UPDATE SET wrapped_key = EXCLUDED.wrapped_key, key_id = EXCLUDED.key_id, created_at = NOW()
+		RETURNING created_at
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := []interface{}{key.Storage_key, key.Wrapped_key, key.Key_id}
+
+	return b.DB.QueryRow(ctx, query, args...).Scan(&key.Created_at)
+}
+
+func (b BlobKeyLayer) Get(storage_key string) (*BlobKey, error) {
+	query := `
+		SELECT storage_key, wrapped_key, key_id, created_at
+		FROM blob_keys
+		WHERE storage_key = $1
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	key := BlobKey{}
+
+	err := b.DB.QueryRow(ctx, query, storage_key).Scan(&key.Storage_key, &key.Wrapped_key, &key.Key_id, &key.Created_at)
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &key, nil
+}
+
+func (b BlobKeyLayer) Delete(storage_key string) error {
+	query := `
+		DELETE FROM blob_keys
+		WHERE storage_key = $1
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := b.DB.Exec(ctx, query, storage_key)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// GetNotWrappedWith returns batch of data keys wrapped with other master key than key_id, ordered by storage key
+// and starting after the given one, so keys which can't be rewrapped are skipped by the next batch.
+func (b BlobKeyLayer) GetNotWrappedWith(key_id string, after string, limit int) ([]*BlobKey, error) {
+	query := `
+		SELECT storage_key, wrapped_key, key_id, created_at
+		FROM blob_keys
+		WHERE key_id <> $1 AND storage_key > $2
+		ORDER BY storage_key
+		LIMIT $3
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := b.DB.Query(ctx, query, key_id, after, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []*BlobKey{}
+
+	for rows.Next() {
+		key := BlobKey{}
+
+		err := rows.Scan(&key.Storage_key, &key.Wrapped_key, &key.Key_id, &key.Created_at)
+		if err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, &key)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// Rewrap replaces data key wrapped with master key old_key_id, ErrEditConflict means it was replaced meanwhile.
+func (b BlobKeyLayer) Rewrap(key *BlobKey, old_key_id string) error {
+	query := `
+		UPDATE blob_keys
+		SET wrapped_key = $1, key_id = $2
+		WHERE storage_key = $3 AND key_id = $4
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := []interface{}{key.Wrapped_key, key.Key_id, key.Storage_key, old_key_id}
+
+	result, err := b.DB.Exec(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrEditConflict
+	}
+
+	return nil
+}
@@ -0,0 +1,147 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Blob is a stored object shared by every document and revision with the same content,
+// it is removed from storage only after the last reference is released.
+type Blob struct {
+	Storage_key string
+	Checksum    *string
+	Location    string
+	Ref_count   int
+	Created_at  time.Time
+}
+
+type BlobLayer struct {
+	DB *pgxpool.Pool
+}
+
+// Acquire registers just stored blob with a reference held by the caller. When blob with the same checksum
+// already exists its reference count is increased instead and blob is replaced with the existing one,
+// caller should then delete the object it has stored.
+func (b BlobLayer) Acquire(blob *Blob) error {
+	query := `
+		INSERT INTO blobs (storage_key, checksum, location)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (checksum) DO UPDATE SET ref_count = blobs.ref_count + 1
+		RETURNING storage_key, checksum, location, ref_count, created_at
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := []interface{}{blob.Storage_key, blob.Checksum, blob.Location}
+
+	err := b.DB.QueryRow(ctx, query, args...).Scan(&blob.Storage_key, &blob.Checksum, &blob.Location, &blob.Ref_count, &blob.Created_at)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (b BlobLayer) Get(storage_key string) (*Blob, error) {
+	query := `
+		SELECT storage_key, checksum, location, ref_count, created_at
+		FROM blobs
+		WHERE storage_key = $1
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	blob := Blob{}
+
+	err := b.DB.QueryRow(ctx, query, storage_key).Scan(&blob.Storage_key, &blob.Checksum, &blob.Location, &blob.Ref_count, &blob.Created_at)
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &blob, nil
+}
+
+// Retain adds a reference to already stored blob.
+func (b BlobLayer) Retain(storage_key string) error {
+	query := `
+		UPDATE blobs
+		SET ref_count = ref_count + 1
+		WHERE storage_key = $1
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := b.DB.Exec(ctx, query, storage_key)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// Release drops a reference to blob and reports whether it was the last one, in which case blob's row
+// is deleted and caller is responsible for deleting the object from storage.
+func (b BlobLayer) Release(storage_key string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := b.DB.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+		UPDATE blobs
+		SET ref_count = ref_count - 1
+		WHERE storage_key = $1
+		RETURNING ref_count
+	`
+
+	ref_count := 0
+
+	err = tx.QueryRow(ctx, query, storage_key).Scan(&ref_count)
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			return false, ErrRecordNotFound
+		default:
+			return false, err
+		}
+	}
+
+	if ref_count <= 0 {
+		query = `
+			DELETE FROM blobs
+			WHERE storage_key = $1
+		`
+
+		_, err = tx.Exec(ctx, query, storage_key)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	return ref_count <= 0, nil
+}
@@ -0,0 +1,91 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"viadro_api/internal/data/testdb"
+)
+
+func TestBlobReferences(t *testing.T) {
+	blobs := BlobLayer{DB: testdb.Open(t)}
+
+	tests := []struct {
+		name           string
+		acquires       int
+		releases       int
+		want_ref_count int
+		want_last      bool
+	}{
+		{name: "single reference", acquires: 1, releases: 0, want_ref_count: 1},
+		{name: "same content stored twice", acquires: 2, releases: 0, want_ref_count: 2},
+		{name: "one of two references released", acquires: 2, releases: 1, want_ref_count: 1},
+		{name: "only reference released", acquires: 1, releases: 1, want_last: true},
+		{name: "every reference released", acquires: 3, releases: 3, want_last: true},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checksum := fmt.Sprintf("checksum-%d", i)
+			storage_key := ""
+
+			for j := 0; j < tt.acquires; j++ {
+				blob := &Blob{Storage_key: fmt.Sprintf("users/1/%d-%d", i, j), Checksum: &checksum, Location: "location"}
+
+				err := blobs.Acquire(blob)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if j == 0 {
+					storage_key = blob.Storage_key
+				}
+				if blob.Storage_key != storage_key {
+					t.Fatalf("acquire %d returned blob %s, want the existing %s", j, blob.Storage_key, storage_key)
+				}
+				if blob.Ref_count != j+1 {
+					t.Fatalf("acquire %d: ref_count = %d, want %d", j, blob.Ref_count, j+1)
+				}
+			}
+
+			last := false
+			for j := 0; j < tt.releases; j++ {
+				var err error
+				last, err = blobs.Release(storage_key)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if last != (j == tt.acquires-1) {
+					t.Fatalf("release %d: last = %v", j, last)
+				}
+			}
+			if last != tt.want_last {
+				t.Fatalf("last = %v, want %v", last, tt.want_last)
+			}
+
+			blob, err := blobs.Get(storage_key)
+			if tt.want_last {
+				if !errors.Is(err, ErrRecordNotFound) {
+					t.Fatalf("released blob still registered: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if blob.Ref_count != tt.want_ref_count {
+				t.Fatalf("ref_count = %d, want %d", blob.Ref_count, tt.want_ref_count)
+			}
+		})
+	}
+}
+
+func TestBlobReleaseUnknown(t *testing.T) {
+	blobs := BlobLayer{DB: testdb.Open(t)}
+
+	_, err := blobs.Release("users/1/unknown")
+	if !errors.Is(err, ErrRecordNotFound) {
+		t.Fatalf("err = %v, want ErrRecordNotFound", err)
+	}
+}
@@ -5,15 +5,33 @@ import (
 )
 
 type Layers struct {
-	Documents DocumentLayer
-	Users     UserLayer
-	Tokens    TokenLayer
+	Documents   DocumentLayer
+	Users       UserLayer
+	Tokens      TokenLayer
+	Uploads     UploadLayer
+	Versions    DocumentVersionLayer
+	Blobs       BlobLayer
+	BlobKeys    BlobKeyLayer
+	Shares      ShareLayer
+	Permissions PermissionLayer
+	Folders     FolderLayer
+	Exports     ExportLayer
+	Jobs        JobLayer
 }
 
 func NewLayers(db *pgxpool.Pool) Layers {
 	return Layers{
-		Documents: DocumentLayer{DB: db},
-		Users:     UserLayer{DB: db},
-		Tokens:    TokenLayer{DB: db},
+		Documents:   DocumentLayer{DB: db},
+		Users:       UserLayer{DB: db},
+		Tokens:      TokenLayer{DB: db},
+		Uploads:     UploadLayer{DB: db},
+		Versions:    DocumentVersionLayer{DB: db},
+		Blobs:       BlobLayer{DB: db},
+		BlobKeys:    BlobKeyLayer{DB: db},
+		Shares:      ShareLayer{DB: db},
+		Permissions: PermissionLayer{DB: db},
+		Folders:     FolderLayer{DB: db},
+		Exports:     ExportLayer{DB: db},
+		Jobs:        JobLayer{DB: db},
 	}
 }
@@ -0,0 +1,171 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type DocumentVersion struct {
+	Document_id    int        `json:"document_id"`
+	Version_number int        `json:"version_number"`
+	Storage_key    string     `json:"-"`
+	Checksum       *string    `json:"checksum"`
+	Filetype       string     `json:"filetype"`
+	Uploaded_at    time.Time  `json:"uploaded_at"`
+	Archived_at    *time.Time `json:"archived_at,omitempty"`
+	Is_current     bool       `json:"is_current"`
+}
+
+type DocumentVersionLayer struct {
+	DB *pgxpool.Pool
+}
+
+// CurrentVersion describes the revision document currently points to, it is not stored in document_versions.
+func CurrentVersion(document *Document) DocumentVersion {
+	return DocumentVersion{
+		Document_id:    document.Document_id,
+		Version_number: document.Current_version,
+		Storage_key:    document.Storage_key,
+		Checksum:       document.Checksum,
+		Filetype:       document.Filetype,
+		Uploaded_at:    document.Revised_at,
+		Is_current:     true,
+	}
+}
+
+// Archive moves document's current revision to the history and makes document point to a new blob
+// given in document's Storage_key, Checksum, Url_s3, Filetype and FileMetadata. Blob reference held by the document
+// is handed over to archived revision, extracted content and preview are cleared until they are made for the new blob.
+func (v DocumentVersionLayer) Archive(document *Document, archived *DocumentVersion) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := v.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+		UPDATE documents
+		SET filetype = $1, storage_key = $2, checksum = $3, url_s3 = $4, content = NULL, preview_key = NULL, current_version = current_version + 1, revised_at = NOW(), version = version + 1,
+			size = $8, page_count = $9, pdf_title = $10, pdf_author = $11, pdf_producer = $12, pdf_created_at = $13, is_encrypted = $14
+		WHERE document_id = $5 AND version = $6 AND current_version = $7
+		RETURNING current_version, revised_at, version
+	`
+
+	args := []interface{}{document.Filetype, document.Storage_key, document.Checksum, document.Url_s3, document.Document_id, document.Version, archived.Version_number,
+		document.Size, document.Page_count, document.Pdf_title, document.Pdf_author, document.Pdf_producer, document.Pdf_created_at, document.Is_encrypted}
+
+	err = tx.QueryRow(ctx, query, args...).Scan(&document.Current_version, &document.Revised_at, &document.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	query = `
+		INSERT INTO document_versions (document_id, version_number, storage_key, checksum, filetype, uploaded_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING archived_at
+	`
+
+	args = []interface{}{archived.Document_id, archived.Version_number, archived.Storage_key, archived.Checksum, archived.Filetype, archived.Uploaded_at}
+
+	err = tx.QueryRow(ctx, query, args...).Scan(&archived.Archived_at)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return err
+	}
+
+	archived.Is_current = false
+	document.Versions_count++
+
+	return nil
+}
+
+func (v DocumentVersionLayer) Get(document_id int, version_number int) (*DocumentVersion, error) {
+	query := `
+		SELECT document_id, version_number, storage_key, checksum, filetype, uploaded_at, archived_at
+		FROM document_versions
+		WHERE document_id = $1 AND version_number = $2
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	version := DocumentVersion{}
+
+	err := v.DB.QueryRow(ctx, query, document_id, version_number).Scan(
+		&version.Document_id,
+		&version.Version_number,
+		&version.Storage_key,
+		&version.Checksum,
+		&version.Filetype,
+		&version.Uploaded_at,
+		&version.Archived_at,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &version, nil
+}
+
+func (v DocumentVersionLayer) GetAll(document_id int) ([]DocumentVersion, error) {
+	query := `
+		SELECT document_id, version_number, storage_key, checksum, filetype, uploaded_at, archived_at
+		FROM document_versions
+		WHERE document_id = $1
+		ORDER BY version_number DESC
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := v.DB.Query(ctx, query, document_id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := []DocumentVersion{}
+
+	for rows.Next() {
+		version := DocumentVersion{}
+		err := rows.Scan(
+			&version.Document_id,
+			&version.Version_number,
+			&version.Storage_key,
+			&version.Checksum,
+			&version.Filetype,
+			&version.Uploaded_at,
+			&version.Archived_at,
+		)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, version)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return versions, nil
+}
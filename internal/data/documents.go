@@ -13,60 +13,181 @@ import (
 type Document struct {
 	Document_id int       `json:"document_id"`
 	User_id     int       `json:"user_id"`
-	Url_s3      string    `json:"url_s3"`
+	Url_s3      string    `json:"-"`
+	Storage_key string    `json:"-"`
+	Checksum    *string   `json:"checksum"`
 	Filetype    string    `json:"filetype"`
 	Uploaded_at time.Time `json:"uploaded_at"`
 	Title       string    `json:"title"`
 	Tags        []string  `json:"tags"`
 	Is_hidden   bool      `json:"is_hidden"`
+	Description string    `json:"description"`
+	Version     int       `json:"version"`
+	//? current_version numbers file revisions, version above guards concurrent edits
+	Current_version int        `json:"current_version"`
+	Versions_count  int        `json:"versions_count"`
+	Revised_at      time.Time  `json:"revised_at"`
+	Folder_id       *int       `json:"folder_id"`
+	Deleted_at      *time.Time `json:"deleted_at,omitempty"`
+	//? key of first page preview stored next to the blob, nil until it is generated and empty when there is none
+	Preview_key *string `json:"-"`
+	//? only read for single documents and selections, listings leave it out
+	Watermark *Watermark `json:"watermark,omitempty"`
+	FileMetadata
+	//? relevance and fragments of content matching full-text search, only filled by GetAll
+	Rank    float32 `json:"rank,omitempty"`
+	Snippet string  `json:"snippet,omitempty"`
+}
+
+// FileMetadata describes file of document's current revision. Size is nil until the file is inspected,
+// page count and pdf_ fields are only read from PDFs and are nil when the file doesn't carry them.
+type FileMetadata struct {
+	Size           *int64     `json:"size"`
+	Page_count     *int       `json:"page_count"`
+	Pdf_title      *string    `json:"pdf_title"`
+	Pdf_author     *string    `json:"pdf_author"`
+	Pdf_producer   *string    `json:"pdf_producer"`
+	Pdf_created_at *time.Time `json:"pdf_created_at"`
+	Is_encrypted   bool       `json:"is_encrypted"`
+}
+
+const (
+	WatermarkDiagonal = "diagonal"
+	WatermarkFooter   = "footer"
+)
+
+// Watermark is text stamped on every page of PDF downloaded by someone who can't edit the document, either
+// diagonally across the page or as a line at its bottom. {user} and {date} in text are filled in on download.
+type Watermark struct {
+	Text  string `json:"text"`
+	Style string `json:"style"`
+}
+
+// MetadataFilters narrow GetAll down by file metadata, nil bounds are not applied. Documents which weren't
+// inspected yet never match a bound on their size or page count.
+type MetadataFilters struct {
+	Min_pages    *int64
+	Max_pages    *int64
+	Min_size     *int64
+	Max_size     *int64
+	Is_encrypted *bool
 }
 
 type DocumentLayer struct {
 	DB *pgxpool.Pool
 }
 
-func (d DocumentLayer) Delete(id int) error {
+// Delete removes document permanently, documents are normally moved to trash with Trash first.
+func (d DocumentLayer) Delete(id int, version int) error {
 	query := `
 		DELETE FROM documents
-		WHERE document_id = $1
+		WHERE document_id = $1 AND version = $2
 	`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	_, err := d.DB.Exec(ctx, query, id)
+	result, err := d.DB.Exec(ctx, query, id, version)
 	if err != nil {
 		return err
 	}
 
+	if result.RowsAffected() == 0 {
+		return ErrEditConflict
+	}
+
+	return nil
+}
+
+// Trash moves document to trash, it is hidden from listings until restored or purged.
+func (d DocumentLayer) Trash(document *Document) error {
+	query := `
+		UPDATE documents
+		SET deleted_at = NOW(), version = version + 1
+		WHERE document_id = $1 AND version = $2 AND deleted_at IS NULL
+		RETURNING deleted_at, version
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := d.DB.QueryRow(ctx, query, document.Document_id, document.Version).Scan(&document.Deleted_at, &document.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (d DocumentLayer) Restore(document *Document) error {
+	query := `
+		UPDATE documents
+		SET deleted_at = NULL, version = version + 1
+		WHERE document_id = $1 AND version = $2 AND deleted_at IS NOT NULL
+		RETURNING version
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := d.DB.QueryRow(ctx, query, document.Document_id, document.Version).Scan(&document.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	document.Deleted_at = nil
+
 	return nil
 }
 
 func (d DocumentLayer) Insert(document *Document) error {
 	query := `
-		INSERT INTO documents (filetype, title, tags, is_hidden, url_s3, user_id)
-		VALUES ($1, $2, $3, $4, $5, $6)
-		RETURNING document_id, uploaded_at
+		INSERT INTO documents (filetype, title, tags, is_hidden, url_s3, storage_key, checksum, user_id, description, folder_id, size, page_count, pdf_title, pdf_author, pdf_producer, pdf_created_at, is_encrypted)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17)
+		RETURNING document_id, uploaded_at, version, current_version, revised_at
 	`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	args := []interface{}{document.Filetype, document.Title, document.Tags, document.Is_hidden, document.Url_s3, document.User_id}
+	args := []interface{}{document.Filetype, document.Title, document.Tags, document.Is_hidden, document.Url_s3, document.Storage_key, document.Checksum, document.User_id, document.Description, document.Folder_id,
+		document.Size, document.Page_count, document.Pdf_title, document.Pdf_author, document.Pdf_producer, document.Pdf_created_at, document.Is_encrypted}
 
-	err := d.DB.QueryRow(ctx, query, args...).Scan(&document.Document_id, &document.Uploaded_at)
+	err := d.DB.QueryRow(ctx, query, args...).Scan(&document.Document_id, &document.Uploaded_at, &document.Version, &document.Current_version, &document.Revised_at)
 	if err != nil {
 		return err
 	}
+	document.Versions_count = 1
 
 	return nil
 }
 
+// Get fetches document which is not in trash.
 func (d DocumentLayer) Get(id int) (*Document, error) {
+	return d.get(id, false)
+}
+
+// GetDeleted fetches document which is in trash.
+func (d DocumentLayer) GetDeleted(id int) (*Document, error) {
+	return d.get(id, true)
+}
+
+func (d DocumentLayer) get(id int, deleted bool) (*Document, error) {
 	query := `
-		SELECT document_id, user_id, url_s3, filetype, uploaded_at, title, tags, is_hidden
+		SELECT document_id, user_id, url_s3, storage_key, checksum, filetype, uploaded_at, title, tags, is_hidden, description, version, current_version, revised_at, folder_id, size, page_count, pdf_title, pdf_author, pdf_producer, pdf_created_at, is_encrypted, preview_key, watermark, deleted_at,
+			(SELECT count(*) + 1 FROM document_versions WHERE document_versions.document_id = documents.document_id)
 		FROM documents
 		WHERE document_id = $1
+		AND (deleted_at IS NOT NULL) = $2
 	`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
@@ -74,15 +195,33 @@ func (d DocumentLayer) Get(id int) (*Document, error) {
 
 	document := Document{}
 
-	err := d.DB.QueryRow(ctx, query, id).Scan(
+	err := d.DB.QueryRow(ctx, query, id, deleted).Scan(
 		&document.Document_id,
 		&document.User_id,
 		&document.Url_s3,
+		&document.Storage_key,
+		&document.Checksum,
 		&document.Filetype,
 		&document.Uploaded_at,
 		&document.Title,
 		&document.Tags,
 		&document.Is_hidden,
+		&document.Description,
+		&document.Version,
+		&document.Current_version,
+		&document.Revised_at,
+		&document.Folder_id,
+		&document.Size,
+		&document.Page_count,
+		&document.Pdf_title,
+		&document.Pdf_author,
+		&document.Pdf_producer,
+		&document.Pdf_created_at,
+		&document.Is_encrypted,
+		&document.Preview_key,
+		&document.Watermark,
+		&document.Deleted_at,
+		&document.Versions_count,
 	)
 	if err != nil {
 		switch {
@@ -96,22 +235,38 @@ func (d DocumentLayer) Get(id int) (*Document, error) {
 	return &document, nil
 }
 
-func (d DocumentLayer) GetAll(title string, tags []string, owner *int, flag *int, filters Filters) ([]Document, FilterMetadata, error) {
+// GetAll lists public documents filtered by title, tags and file metadata. Owner lists documents of single user
+// including hidden ones, flag excludes documents of user and shared lists documents other users granted user access to.
+// Search is a full-text query (websearch syntax) over title and extracted content, matching documents can be sorted
+// by rank and carry highlighted snippets of content.
+func (d DocumentLayer) GetAll(title string, search string, tags []string, owner *int, flag *int, shared *int, file_filters MetadataFilters, filters Filters) ([]Document, FilterMetadata, error) {
 	query := fmt.Sprintf(`
-		SELECT count(*) OVER(), document_id, user_id, url_s3, filetype, uploaded_at, title, tags, is_hidden
+		SELECT count(*) OVER(), document_id, user_id, url_s3, storage_key, checksum, filetype, uploaded_at, title, tags, is_hidden, description, version, current_version, revised_at, folder_id, size, page_count, pdf_title, pdf_author, pdf_producer, pdf_created_at, is_encrypted, preview_key, watermark,
+			(SELECT count(*) + 1 FROM document_versions WHERE document_versions.document_id = documents.document_id),
+			CASE WHEN $8 = '' THEN 0 ELSE ts_rank(setweight(to_tsvector('simple', title), 'A') || setweight(coalesce(content_tsv, ''), 'B'), websearch_to_tsquery('simple', $8)) END AS rank,
+			CASE WHEN $8 = '' THEN '' ELSE ts_headline('simple', coalesce(content, ''), websearch_to_tsquery('simple', $8), 'StartSel=<mark>, StopSel=</mark>, MaxFragments=3, MaxWords=30, MinWords=10') END
 		FROM documents
 		WHERE (to_tsvector('simple', title) @@ plainto_tsquery('simple', $1) OR $1 = '')
 		AND (tags @> $2 OR $2 = '{}')
-		AND ($3::int IS NOT NULL OR is_hidden = false)
+		AND ($3::int IS NOT NULL OR $5::int IS NOT NULL OR is_hidden = false)
 		AND ($3::int IS NULL OR user_id = $3)
 		AND ($4::int IS NULL OR user_id != $4)
-		ORDER BY %s %s, document_id ASC
-		LIMIT $5 OFFSET $6`, filters.sortColumn(), filters.sortDirection())
+		AND ($5::int IS NULL OR document_id IN (SELECT document_id FROM document_permissions WHERE user_id = $5))
+		AND ($8 = '' OR to_tsvector('simple', title) @@ websearch_to_tsquery('simple', $8) OR content_tsv @@ websearch_to_tsquery('simple', $8))
+		AND ($9::bigint IS NULL OR page_count >= $9)
+		AND ($10::bigint IS NULL OR page_count <= $10)
+		AND ($11::bigint IS NULL OR size >= $11)
+		AND ($12::bigint IS NULL OR size <= $12)
+		AND ($13::boolean IS NULL OR is_encrypted = $13)
+		AND deleted_at IS NULL
+		ORDER BY %s %s NULLS LAST, document_id ASC
+		LIMIT $6 OFFSET $7`, filters.sortColumn(), filters.sortDirection())
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	args := []interface{}{title, tags, owner, flag, filters.limit(), filters.offset()}
+	args := []interface{}{title, tags, owner, flag, shared, filters.limit(), filters.offset(), search,
+		file_filters.Min_pages, file_filters.Max_pages, file_filters.Min_size, file_filters.Max_size, file_filters.Is_encrypted}
 
 	rows, err := d.DB.Query(ctx, query, args...)
 	if err != nil {
@@ -129,11 +284,30 @@ func (d DocumentLayer) GetAll(title string, tags []string, owner *int, flag *int
 			&document.Document_id,
 			&document.User_id,
 			&document.Url_s3,
+			&document.Storage_key,
+			&document.Checksum,
 			&document.Filetype,
 			&document.Uploaded_at,
 			&document.Title,
 			&document.Tags,
 			&document.Is_hidden,
+			&document.Description,
+			&document.Version,
+			&document.Current_version,
+			&document.Revised_at,
+			&document.Folder_id,
+			&document.Size,
+			&document.Page_count,
+			&document.Pdf_title,
+			&document.Pdf_author,
+			&document.Pdf_producer,
+			&document.Pdf_created_at,
+			&document.Is_encrypted,
+			&document.Preview_key,
+			&document.Watermark,
+			&document.Versions_count,
+			&document.Rank,
+			&document.Snippet,
 		)
 		if err != nil {
 			return nil, FilterMetadata{}, err
@@ -150,10 +324,12 @@ func (d DocumentLayer) GetAll(title string, tags []string, owner *int, flag *int
 
 func (d DocumentLayer) GetAllAdmin(title string, tags []string, filters Filters) ([]Document, FilterMetadata, error) {
 	query := fmt.Sprintf(`
-		SELECT count(*) OVER(), document_id, user_id, url_s3, filetype, uploaded_at, title, tags, is_hidden
+		SELECT count(*) OVER(), document_id, user_id, url_s3, storage_key, checksum, filetype, uploaded_at, title, tags, is_hidden, description, version, current_version, revised_at, folder_id, size, page_count, pdf_title, pdf_author, pdf_producer, pdf_created_at, is_encrypted, preview_key,
+			(SELECT count(*) + 1 FROM document_versions WHERE document_versions.document_id = documents.document_id)
 		FROM documents
 		WHERE (to_tsvector('simple', title) @@ plainto_tsquery('simple', $1) OR $1 = '')
 		AND (tags @> $2 OR $2 = '{}')
+		AND deleted_at IS NULL
 		ORDER BY %s %s, document_id ASC
 		LIMIT $3 OFFSET $4`, filters.sortColumn(), filters.sortDirection())
 
@@ -178,11 +354,27 @@ func (d DocumentLayer) GetAllAdmin(title string, tags []string, filters Filters)
 			&document.Document_id,
 			&document.User_id,
 			&document.Url_s3,
+			&document.Storage_key,
+			&document.Checksum,
 			&document.Filetype,
 			&document.Uploaded_at,
 			&document.Title,
 			&document.Tags,
 			&document.Is_hidden,
+			&document.Description,
+			&document.Version,
+			&document.Current_version,
+			&document.Revised_at,
+			&document.Folder_id,
+			&document.Size,
+			&document.Page_count,
+			&document.Pdf_title,
+			&document.Pdf_author,
+			&document.Pdf_producer,
+			&document.Pdf_created_at,
+			&document.Is_encrypted,
+			&document.Preview_key,
+			&document.Versions_count,
 		)
 		if err != nil {
 			return nil, FilterMetadata{}, err
@@ -197,12 +389,307 @@ func (d DocumentLayer) GetAllAdmin(title string, tags []string, filters Filters)
 	return documents, metadata, nil
 }
 
-func (d DocumentLayer) ToggleVisibility(id int) (*Document, error) {
+func (d DocumentLayer) GetAllInFolder(folder_id int, filters Filters) ([]Document, FilterMetadata, error) {
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), document_id, user_id, url_s3, storage_key, checksum, filetype, uploaded_at, title, tags, is_hidden, description, version, current_version, revised_at, folder_id, size, page_count, pdf_title, pdf_author, pdf_producer, pdf_created_at, is_encrypted, preview_key,
+			(SELECT count(*) + 1 FROM document_versions WHERE document_versions.document_id = documents.document_id)
+		FROM documents
+		WHERE folder_id = $1
+		AND deleted_at IS NULL
+		ORDER BY %s %s, document_id ASC
+		LIMIT $2 OFFSET $3`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := d.DB.Query(ctx, query, folder_id, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, FilterMetadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	documents := []Document{}
+
+	for rows.Next() {
+		document := Document{}
+		err := rows.Scan(
+			&totalRecords,
+			&document.Document_id,
+			&document.User_id,
+			&document.Url_s3,
+			&document.Storage_key,
+			&document.Checksum,
+			&document.Filetype,
+			&document.Uploaded_at,
+			&document.Title,
+			&document.Tags,
+			&document.Is_hidden,
+			&document.Description,
+			&document.Version,
+			&document.Current_version,
+			&document.Revised_at,
+			&document.Folder_id,
+			&document.Size,
+			&document.Page_count,
+			&document.Pdf_title,
+			&document.Pdf_author,
+			&document.Pdf_producer,
+			&document.Pdf_created_at,
+			&document.Is_encrypted,
+			&document.Preview_key,
+			&document.Versions_count,
+		)
+		if err != nil {
+			return nil, FilterMetadata{}, err
+		}
+		documents = append(documents, document)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, FilterMetadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return documents, metadata, nil
+}
+
+// GetAllInFolderTree lists documents of folder and all of its subfolders, without pagination. Documents already
+// in trash are not included.
+func (d DocumentLayer) GetAllInFolderTree(folder_id int) ([]Document, error) {
+	query := `
+		WITH RECURSIVE tree AS (
+			SELECT folder_id FROM folders WHERE folder_id = $1
+			UNION ALL
+			SELECT folders.folder_id FROM folders JOIN tree ON folders.parent_id = tree.folder_id
+		)
+		SELECT document_id, user_id, url_s3, storage_key, checksum, filetype, uploaded_at, title, tags, is_hidden, description, version, current_version, revised_at, folder_id, size, page_count, pdf_title, pdf_author, pdf_producer, pdf_created_at, is_encrypted, preview_key
+		FROM documents
+		WHERE folder_id IN (SELECT folder_id FROM tree)
+		AND deleted_at IS NULL
+		ORDER BY document_id ASC
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := d.DB.Query(ctx, query, folder_id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	documents := []Document{}
+
+	for rows.Next() {
+		document := Document{}
+		err := rows.Scan(
+			&document.Document_id,
+			&document.User_id,
+			&document.Url_s3,
+			&document.Storage_key,
+			&document.Checksum,
+			&document.Filetype,
+			&document.Uploaded_at,
+			&document.Title,
+			&document.Tags,
+			&document.Is_hidden,
+			&document.Description,
+			&document.Version,
+			&document.Current_version,
+			&document.Revised_at,
+			&document.Folder_id,
+			&document.Size,
+			&document.Page_count,
+			&document.Pdf_title,
+			&document.Pdf_author,
+			&document.Pdf_producer,
+			&document.Pdf_created_at,
+			&document.Is_encrypted,
+			&document.Preview_key,
+		)
+		if err != nil {
+			return nil, err
+		}
+		documents = append(documents, document)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return documents, nil
+}
+
+// GetAllDeleted lists documents of user which are in trash, most recently deleted first.
+func (d DocumentLayer) GetAllDeleted(user_id int, filters Filters) ([]Document, FilterMetadata, error) {
+	query := `
+		SELECT count(*) OVER(), document_id, user_id, url_s3, storage_key, checksum, filetype, uploaded_at, title, tags, is_hidden, description, version, current_version, revised_at, folder_id, size, page_count, pdf_title, pdf_author, pdf_producer, pdf_created_at, is_encrypted, preview_key, deleted_at,
+			(SELECT count(*) + 1 FROM document_versions WHERE document_versions.document_id = documents.document_id)
+		FROM documents
+		WHERE user_id = $1
+		AND deleted_at IS NOT NULL
+		ORDER BY deleted_at DESC, document_id ASC
+		LIMIT $2 OFFSET $3`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := d.DB.Query(ctx, query, user_id, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, FilterMetadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	documents := []Document{}
+
+	for rows.Next() {
+		document := Document{}
+		err := rows.Scan(
+			&totalRecords,
+			&document.Document_id,
+			&document.User_id,
+			&document.Url_s3,
+			&document.Storage_key,
+			&document.Checksum,
+			&document.Filetype,
+			&document.Uploaded_at,
+			&document.Title,
+			&document.Tags,
+			&document.Is_hidden,
+			&document.Description,
+			&document.Version,
+			&document.Current_version,
+			&document.Revised_at,
+			&document.Folder_id,
+			&document.Size,
+			&document.Page_count,
+			&document.Pdf_title,
+			&document.Pdf_author,
+			&document.Pdf_producer,
+			&document.Pdf_created_at,
+			&document.Is_encrypted,
+			&document.Preview_key,
+			&document.Deleted_at,
+			&document.Versions_count,
+		)
+		if err != nil {
+			return nil, FilterMetadata{}, err
+		}
+		documents = append(documents, document)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, FilterMetadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return documents, metadata, nil
+}
+
+// GetExpiredDeleted lists documents which were moved to trash before given time.
+func (d DocumentLayer) GetExpiredDeleted(before time.Time) ([]Document, error) {
+	query := `
+		SELECT document_id, user_id, storage_key, version, deleted_at
+		FROM documents
+		WHERE deleted_at < $1
+		ORDER BY deleted_at ASC
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := d.DB.Query(ctx, query, before)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	documents := []Document{}
+
+	for rows.Next() {
+		document := Document{}
+		err := rows.Scan(&document.Document_id, &document.User_id, &document.Storage_key, &document.Version, &document.Deleted_at)
+		if err != nil {
+			return nil, err
+		}
+		documents = append(documents, document)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return documents, nil
+}
+
+// GetOrphaned lists documents, trashed ones included, whose owner no longer exists. When user_id is given
+// only documents of that deleted user are listed, documents of existing users are never returned.
+func (d DocumentLayer) GetOrphaned(user_id *int) ([]Document, error) {
+	query := `
+		SELECT document_id, user_id, storage_key, version
+		FROM documents
+		WHERE NOT EXISTS (SELECT 1 FROM users WHERE users.user_id = documents.user_id)
+		AND ($1::int IS NULL OR user_id = $1)
+		ORDER BY document_id ASC
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := d.DB.Query(ctx, query, user_id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	documents := []Document{}
+
+	for rows.Next() {
+		document := Document{}
+		err := rows.Scan(&document.Document_id, &document.User_id, &document.Storage_key, &document.Version)
+		if err != nil {
+			return nil, err
+		}
+		documents = append(documents, document)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return documents, nil
+}
+
+func (d DocumentLayer) Update(document *Document) error {
 	query := `
 		UPDATE documents
-		SET is_hidden = NOT is_hidden
-		WHERE document_id = $1
-		RETURNING document_id, url_s3, filetype, uploaded_at, title, tags, is_hidden
+		SET title = $1, tags = $2, is_hidden = $3, description = $4, url_s3 = $5, folder_id = $6, version = version + 1
+		WHERE document_id = $7 AND version = $8 AND deleted_at IS NULL
+		RETURNING version
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := []interface{}{document.Title, document.Tags, document.Is_hidden, document.Description, document.Url_s3, document.Folder_id, document.Document_id, document.Version}
+
+	err := d.DB.QueryRow(ctx, query, args...).Scan(&document.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (d DocumentLayer) ToggleVisibility(id int, version int) (*Document, error) {
+	query := `
+		UPDATE documents
+		SET is_hidden = NOT is_hidden, version = version + 1
+		WHERE document_id = $1 AND version = $2 AND deleted_at IS NULL
+		RETURNING document_id, url_s3, storage_key, checksum, filetype, uploaded_at, title, tags, is_hidden, description, version, current_version, revised_at, folder_id, size, page_count, pdf_title, pdf_author, pdf_producer, pdf_created_at, is_encrypted, preview_key, watermark,
+			(SELECT count(*) + 1 FROM document_versions WHERE document_versions.document_id = documents.document_id)
 	`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
@@ -210,18 +697,382 @@ func (d DocumentLayer) ToggleVisibility(id int) (*Document, error) {
 
 	document := Document{}
 
-	err := d.DB.QueryRow(ctx, query, id).Scan(
+	err := d.DB.QueryRow(ctx, query, id, version).Scan(
 		&document.Document_id,
 		&document.Url_s3,
+		&document.Storage_key,
+		&document.Checksum,
 		&document.Filetype,
 		&document.Uploaded_at,
 		&document.Title,
 		&document.Tags,
 		&document.Is_hidden,
+		&document.Description,
+		&document.Version,
+		&document.Current_version,
+		&document.Revised_at,
+		&document.Folder_id,
+		&document.Size,
+		&document.Page_count,
+		&document.Pdf_title,
+		&document.Pdf_author,
+		&document.Pdf_producer,
+		&document.Pdf_created_at,
+		&document.Is_encrypted,
+		&document.Preview_key,
+		&document.Watermark,
+		&document.Versions_count,
 	)
 	if err != nil {
-		return nil, err
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			return nil, ErrEditConflict
+		default:
+			return nil, err
+		}
 	}
 
 	return &document, nil
 }
+
+// GetMany fetches documents which are not in trash, ids which don't exist are skipped.
+func (d DocumentLayer) GetMany(ids []int) ([]Document, error) {
+	query := `
+		SELECT document_id, user_id, url_s3, storage_key, checksum, filetype, uploaded_at, title, tags, is_hidden, description, version, current_version, revised_at, folder_id, size, page_count, pdf_title, pdf_author, pdf_producer, pdf_created_at, is_encrypted, preview_key, watermark
+		FROM documents
+		WHERE document_id = ANY($1)
+		AND deleted_at IS NULL
+		ORDER BY document_id ASC
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := d.DB.Query(ctx, query, ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	documents := []Document{}
+
+	for rows.Next() {
+		document := Document{}
+		err := rows.Scan(
+			&document.Document_id,
+			&document.User_id,
+			&document.Url_s3,
+			&document.Storage_key,
+			&document.Checksum,
+			&document.Filetype,
+			&document.Uploaded_at,
+			&document.Title,
+			&document.Tags,
+			&document.Is_hidden,
+			&document.Description,
+			&document.Version,
+			&document.Current_version,
+			&document.Revised_at,
+			&document.Folder_id,
+			&document.Size,
+			&document.Page_count,
+			&document.Pdf_title,
+			&document.Pdf_author,
+			&document.Pdf_producer,
+			&document.Pdf_created_at,
+			&document.Is_encrypted,
+			&document.Preview_key,
+			&document.Watermark,
+		)
+		if err != nil {
+			return nil, err
+		}
+		documents = append(documents, document)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return documents, nil
+}
+
+// SetWatermark changes watermark of document, nil removes it.
+func (d DocumentLayer) SetWatermark(document *Document) error {
+	query := `
+		UPDATE documents
+		SET watermark = $1, version = version + 1
+		WHERE document_id = $2 AND version = $3 AND deleted_at IS NULL
+		RETURNING version
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := d.DB.QueryRow(ctx, query, document.Watermark, document.Document_id, document.Version).Scan(&document.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// FindIDs lists ids of user's documents matching the same title and tags filters as GetAll, at most limit of them.
+func (d DocumentLayer) FindIDs(title string, tags []string, owner int, limit int) ([]int, error) {
+	query := `
+		SELECT document_id
+		FROM documents
+		WHERE (to_tsvector('simple', title) @@ plainto_tsquery('simple', $1) OR $1 = '')
+		AND (tags @> $2 OR $2 = '{}')
+		AND user_id = $3
+		AND deleted_at IS NULL
+		ORDER BY document_id ASC
+		LIMIT $4
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := d.DB.Query(ctx, query, title, tags, owner, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int{}
+
+	for rows.Next() {
+		id := 0
+		err := rows.Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+// TrashMany moves documents to trash, returned ids are those actually changed.
+func (d DocumentLayer) TrashMany(ids []int) ([]int, error) {
+	return d.updateMany(ids, "deleted_at = NOW()")
+}
+
+func (d DocumentLayer) SetHiddenMany(ids []int, hidden bool) ([]int, error) {
+	return d.updateMany(ids, "is_hidden = $2", hidden)
+}
+
+func (d DocumentLayer) AddTagsMany(ids []int, tags []string) ([]int, error) {
+	return d.updateMany(ids, "tags = ARRAY(SELECT DISTINCT unnest(COALESCE(tags, '{}') || $2::text[]) ORDER BY 1)", tags)
+}
+
+func (d DocumentLayer) RemoveTagsMany(ids []int, tags []string) ([]int, error) {
+	return d.updateMany(ids, "tags = ARRAY(SELECT tag FROM unnest(COALESCE(tags, '{}')) AS tag WHERE tag <> ALL($2::text[]))", tags)
+}
+
+func (d DocumentLayer) MoveMany(ids []int, folder_id *int) ([]int, error) {
+	return d.updateMany(ids, "folder_id = $2", folder_id)
+}
+
+// updateMany applies set clause to documents in a single statement, so either all of them change or none.
+func (d DocumentLayer) updateMany(ids []int, set string, args ...interface{}) ([]int, error) {
+	query := fmt.Sprintf(`
+		UPDATE documents
+		SET %s, version = version + 1
+		WHERE document_id = ANY($1)
+		AND deleted_at IS NULL
+		RETURNING document_id`, set)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := d.DB.Query(ctx, query, append([]interface{}{ids}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	updated := []int{}
+
+	for rows.Next() {
+		id := 0
+		err := rows.Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+		updated = append(updated, id)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return updated, nil
+}
+
+// SetContent stores text extracted from document's blob, nothing is changed when document meanwhile
+// got a new revision, as its content is then extracted again.
+func (d DocumentLayer) SetContent(id int, storage_key string, content string) error {
+	query := `
+		UPDATE documents
+		SET content = $3
+		WHERE document_id = $1 AND storage_key = $2
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := d.DB.Exec(ctx, query, id, storage_key, content)
+
+	return err
+}
+
+// GetUnindexed lists documents whose content wasn't extracted yet, at most limit of them.
+func (d DocumentLayer) GetUnindexed(limit int) ([]Document, error) {
+	query := `
+		SELECT document_id, storage_key, filetype
+		FROM documents
+		WHERE content IS NULL
+		ORDER BY document_id ASC
+		LIMIT $1
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := d.DB.Query(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	documents := []Document{}
+
+	for rows.Next() {
+		document := Document{}
+		err := rows.Scan(&document.Document_id, &document.Storage_key, &document.Filetype)
+		if err != nil {
+			return nil, err
+		}
+		documents = append(documents, document)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return documents, nil
+}
+
+// SetMetadata stores metadata read from document's blob, nothing is changed when document meanwhile
+// got a new revision, as that one is inspected on its own.
+func (d DocumentLayer) SetMetadata(id int, storage_key string, metadata FileMetadata) error {
+	query := `
+		UPDATE documents
+		SET size = $3, page_count = $4, pdf_title = $5, pdf_author = $6, pdf_producer = $7, pdf_created_at = $8, is_encrypted = $9
+		WHERE document_id = $1 AND storage_key = $2
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := []interface{}{id, storage_key, metadata.Size, metadata.Page_count, metadata.Pdf_title, metadata.Pdf_author, metadata.Pdf_producer, metadata.Pdf_created_at, metadata.Is_encrypted}
+
+	_, err := d.DB.Exec(ctx, query, args...)
+
+	return err
+}
+
+// GetUninspected lists documents whose metadata wasn't read yet, at most limit of them.
+func (d DocumentLayer) GetUninspected(limit int) ([]Document, error) {
+	query := `
+		SELECT document_id, storage_key, filetype
+		FROM documents
+		WHERE size IS NULL
+		ORDER BY document_id ASC
+		LIMIT $1
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := d.DB.Query(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	documents := []Document{}
+
+	for rows.Next() {
+		document := Document{}
+		err := rows.Scan(&document.Document_id, &document.Storage_key, &document.Filetype)
+		if err != nil {
+			return nil, err
+		}
+		documents = append(documents, document)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return documents, nil
+}
+
+// SetPreview stores key of preview made from document's blob, empty key records there is none. Nothing is changed
+// when document meanwhile got a new revision, as its preview is then made again.
+func (d DocumentLayer) SetPreview(id int, storage_key string, preview_key string) error {
+	query := `
+		UPDATE documents
+		SET preview_key = $3
+		WHERE document_id = $1 AND storage_key = $2
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := d.DB.Exec(ctx, query, id, storage_key, preview_key)
+
+	return err
+}
+
+// GetUnpreviewed lists documents whose preview wasn't made yet, at most limit of them.
+func (d DocumentLayer) GetUnpreviewed(limit int) ([]Document, error) {
+	query := `
+		SELECT document_id, storage_key, filetype
+		FROM documents
+		WHERE preview_key IS NULL
+		ORDER BY document_id ASC
+		LIMIT $1
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := d.DB.Query(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	documents := []Document{}
+
+	for rows.Next() {
+		document := Document{}
+		err := rows.Scan(&document.Document_id, &document.Storage_key, &document.Filetype)
+		if err != nil {
+			return nil, err
+		}
+		documents = append(documents, document)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return documents, nil
+}
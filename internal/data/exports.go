@@ -0,0 +1,147 @@
+package data
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Export is an archive of documents built in background, kept in storage until expiry so emailed link can be used.
+// It doesn't reference users table, archives of deleted users are removed once they expire like any other.
+// Token of the link is hashed like Token's.
+type Export struct {
+	Export_id       int       `json:"export_id"`
+	User_id         int       `json:"user_id"`
+	Storage_key     string    `json:"-"`
+	Plaintext       string    `json:"-"`
+	Hash            []byte    `json:"-"`
+	Documents_count int       `json:"documents_count"`
+	Created_at      time.Time `json:"created_at"`
+	Expiry          time.Time `json:"expiry"`
+}
+
+type ExportLayer struct {
+	DB *pgxpool.Pool
+}
+
+func (e ExportLayer) Insert(export *Export) error {
+	var err error
+	export.Plaintext, export.Hash, err = generateSecret()
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO exports (user_id, storage_key, documents_count, expiry, hash)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING export_id, created_at
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := []interface{}{export.User_id, export.Storage_key, export.Documents_count, export.Expiry, export.Hash}
+
+	return e.DB.QueryRow(ctx, query, args...).Scan(&export.Export_id, &export.Created_at)
+}
+
+// GetForToken returns export the emailed link points to, ErrRecordNotFound once it expires.
+func (e ExportLayer) GetForToken(tokenPlaintext string) (*Export, error) {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+
+	query := `
+		SELECT export_id, user_id, storage_key, documents_count, created_at, expiry
+		FROM exports
+		WHERE hash = $1 AND expiry > NOW()
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	export := Export{}
+
+	err := e.DB.QueryRow(ctx, query, tokenHash[:]).Scan(
+		&export.Export_id,
+		&export.User_id,
+		&export.Storage_key,
+		&export.Documents_count,
+		&export.Created_at,
+		&export.Expiry,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &export, nil
+}
+
+// GetExpired returns exports whose links expired before given time.
+func (e ExportLayer) GetExpired(before time.Time) ([]Export, error) {
+	query := `
+		SELECT export_id, user_id, storage_key, documents_count, created_at, expiry
+		FROM exports
+		WHERE expiry < $1
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := e.DB.Query(ctx, query, before)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	exports := []Export{}
+
+	for rows.Next() {
+		export := Export{}
+		err := rows.Scan(
+			&export.Export_id,
+			&export.User_id,
+			&export.Storage_key,
+			&export.Documents_count,
+			&export.Created_at,
+			&export.Expiry,
+		)
+		if err != nil {
+			return nil, err
+		}
+		exports = append(exports, export)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return exports, nil
+}
+
+func (e ExportLayer) Delete(id int) error {
+	query := `
+		DELETE FROM exports
+		WHERE export_id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := e.DB.Exec(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
@@ -20,6 +20,16 @@ type FilterMetadata struct {
 	TotalRecords int `json:"total_records,omitempty"`
 }
 
+// SortAllowed reports whether requested sort is on the safelist, queries can't be built with any other.
+func (f Filters) SortAllowed() bool {
+	for _, safeValue := range f.SortSafelist {
+		if f.Sort == safeValue {
+			return true
+		}
+	}
+	return false
+}
+
 func (f Filters) sortColumn() string {
 	for _, safeValue := range f.SortSafelist {
 		if f.Sort == safeValue {
@@ -0,0 +1,266 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	ErrDuplicateFolder = errors.New("duplicate folder")
+	ErrFolderCycle     = errors.New("folder cycle")
+)
+
+// Folder groups documents of single user, folders without parent are at the top level.
+type Folder struct {
+	Folder_id  int       `json:"folder_id"`
+	User_id    int       `json:"user_id"`
+	Parent_id  *int      `json:"parent_id"`
+	Name       string    `json:"name"`
+	Created_at time.Time `json:"created_at"`
+	Version    int       `json:"version"`
+}
+
+type FolderLayer struct {
+	DB *pgxpool.Pool
+}
+
+func (f FolderLayer) Insert(folder *Folder) error {
+	query := `
+		INSERT INTO folders (user_id, parent_id, name)
+		VALUES ($1, $2, $3)
+		RETURNING folder_id, created_at, version
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := []interface{}{folder.User_id, folder.Parent_id, folder.Name}
+
+	err := f.DB.QueryRow(ctx, query, args...).Scan(&folder.Folder_id, &folder.Created_at, &folder.Version)
+	if err != nil {
+		switch {
+		case err.Error() == `ERROR: duplicate key value violates unique constraint "folders_name_index" (SQLSTATE 23505)`:
+			return ErrDuplicateFolder
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (f FolderLayer) Get(id int) (*Folder, error) {
+	query := `
+		SELECT folder_id, user_id, parent_id, name, created_at, version
+		FROM folders
+		WHERE folder_id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	folder := Folder{}
+
+	err := f.DB.QueryRow(ctx, query, id).Scan(&folder.Folder_id, &folder.User_id, &folder.Parent_id, &folder.Name, &folder.Created_at, &folder.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &folder, nil
+}
+
+// GetAll lists folders of user, parent limits them to direct subfolders of single folder.
+func (f FolderLayer) GetAll(user_id int, parent *int) ([]Folder, error) {
+	query := `
+		SELECT folder_id, user_id, parent_id, name, created_at, version
+		FROM folders
+		WHERE user_id = $1
+		AND ($2::int IS NULL OR parent_id = $2)
+		ORDER BY name ASC, folder_id ASC
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := f.DB.Query(ctx, query, user_id, parent)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	folders := []Folder{}
+
+	for rows.Next() {
+		folder := Folder{}
+		err := rows.Scan(&folder.Folder_id, &folder.User_id, &folder.Parent_id, &folder.Name, &folder.Created_at, &folder.Version)
+		if err != nil {
+			return nil, err
+		}
+		folders = append(folders, folder)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return folders, nil
+}
+
+// Update renames folder or moves it under another parent. Moving folder into itself or one of its
+// subfolders fails with ErrFolderCycle, moves of single user are serialized so concurrent moves can't form a cycle either.
+func (f FolderLayer) Update(folder *Folder) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := f.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext('folders'), $1)`, folder.User_id)
+	if err != nil {
+		return err
+	}
+
+	if folder.Parent_id != nil {
+		query := `
+			WITH RECURSIVE tree AS (
+				SELECT folder_id FROM folders WHERE folder_id = $1
+				UNION ALL
+				SELECT folders.folder_id FROM folders JOIN tree ON folders.parent_id = tree.folder_id
+			)
+			SELECT EXISTS (SELECT 1 FROM tree WHERE folder_id = $2)
+		`
+
+		cycle := false
+
+		err = tx.QueryRow(ctx, query, folder.Folder_id, *folder.Parent_id).Scan(&cycle)
+		if err != nil {
+			return err
+		}
+		if cycle {
+			return ErrFolderCycle
+		}
+	}
+
+	query := `
+		UPDATE folders
+		SET name = $1, parent_id = $2, version = version + 1
+		WHERE folder_id = $3 AND version = $4
+		RETURNING version
+	`
+
+	args := []interface{}{folder.Name, folder.Parent_id, folder.Folder_id, folder.Version}
+
+	err = tx.QueryRow(ctx, query, args...).Scan(&folder.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			return ErrEditConflict
+		case err.Error() == `ERROR: duplicate key value violates unique constraint "folders_name_index" (SQLSTATE 23505)`:
+			return ErrDuplicateFolder
+		default:
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+// IsEmpty reports whether folder has no documents and no subfolders, documents in trash don't count.
+func (f FolderLayer) IsEmpty(id int) (bool, error) {
+	query := `
+		SELECT NOT EXISTS (SELECT 1 FROM folders WHERE parent_id = $1)
+		AND NOT EXISTS (SELECT 1 FROM documents WHERE folder_id = $1 AND deleted_at IS NULL)
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	empty := false
+
+	err := f.DB.QueryRow(ctx, query, id).Scan(&empty)
+	if err != nil {
+		return false, err
+	}
+
+	return empty, nil
+}
+
+// Delete removes folder together with its subfolders, documents left inside are moved to the top level,
+// so callers delete them first.
+func (f FolderLayer) Delete(id int, version int) error {
+	query := `
+		DELETE FROM folders
+		WHERE folder_id = $1 AND version = $2
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := f.DB.Exec(ctx, query, id, version)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrEditConflict
+	}
+
+	return nil
+}
+
+// DeleteWithDocuments moves documents in folder and its subfolders to trash and removes the folders, all in one
+// transaction, so either the whole tree is deleted or nothing changes.
+func (f FolderLayer) DeleteWithDocuments(id int, version int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := f.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+		WITH RECURSIVE tree AS (
+			SELECT folder_id FROM folders WHERE folder_id = $1
+			UNION ALL
+			SELECT folders.folder_id FROM folders JOIN tree ON folders.parent_id = tree.folder_id
+		)
+		UPDATE documents
+		SET deleted_at = NOW(), version = version + 1
+		WHERE folder_id IN (SELECT folder_id FROM tree)
+		AND deleted_at IS NULL
+	`
+
+	_, err = tx.Exec(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	query = `
+		DELETE FROM folders
+		WHERE folder_id = $1 AND version = $2
+	`
+
+	result, err := tx.Exec(ctx, query, id, version)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrEditConflict
+	}
+
+	return tx.Commit(ctx)
+}
@@ -0,0 +1,96 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"viadro_api/internal/data/testdb"
+)
+
+func TestFolderDeleteWithDocuments(t *testing.T) {
+	layers := NewLayers(testdb.Open(t))
+
+	user := &User{Username: "tester", Email: "tester@example.com", Activated: true}
+	err := user.Password.Set("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = layers.Users.Insert(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		stale        bool
+		want_err     error
+		want_deleted bool
+	}{
+		{name: "current version", want_deleted: true},
+		{name: "stale version", stale: true, want_err: ErrEditConflict},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := &Folder{User_id: user.User_id, Name: fmt.Sprintf("root-%d", i)}
+			err := layers.Folders.Insert(root)
+			if err != nil {
+				t.Fatal(err)
+			}
+			child := &Folder{User_id: user.User_id, Parent_id: &root.Folder_id, Name: "child"}
+			err = layers.Folders.Insert(child)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			insert := func(folder_id *int) *Document {
+				checksum := fmt.Sprintf("checksum-%d-%v", i, folder_id)
+				blob := &Blob{Storage_key: fmt.Sprintf("users/%d/%s", user.User_id, checksum), Checksum: &checksum}
+				err := layers.Blobs.Acquire(blob)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				document := &Document{User_id: user.User_id, Filetype: "text/plain", Title: checksum, Storage_key: blob.Storage_key, Folder_id: folder_id}
+				err = layers.Documents.Insert(document)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return document
+			}
+
+			inside := []*Document{insert(&root.Folder_id), insert(&child.Folder_id)}
+			outside := insert(nil)
+
+			version := root.Version
+			if tt.stale {
+				version--
+			}
+
+			err = layers.Folders.DeleteWithDocuments(root.Folder_id, version)
+			if !errors.Is(err, tt.want_err) {
+				t.Fatalf("err = %v, want %v", err, tt.want_err)
+			}
+
+			for _, folder := range []*Folder{root, child} {
+				_, err = layers.Folders.Get(folder.Folder_id)
+				if deleted := errors.Is(err, ErrRecordNotFound); deleted != tt.want_deleted {
+					t.Fatalf("folder %s deleted = %v, want %v", folder.Name, deleted, tt.want_deleted)
+				}
+			}
+
+			for _, document := range inside {
+				_, err = layers.Documents.Get(document.Document_id)
+				if trashed := errors.Is(err, ErrRecordNotFound); trashed != tt.want_deleted {
+					t.Fatalf("document %s trashed = %v, want %v", document.Title, trashed, tt.want_deleted)
+				}
+			}
+
+			_, err = layers.Documents.Get(outside.Document_id)
+			if err != nil {
+				t.Fatalf("document outside of folder: %v", err)
+			}
+		})
+	}
+}
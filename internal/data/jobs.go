@@ -0,0 +1,174 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	JobMerge   = "merge"
+	JobSplit   = "split"
+	JobExtract = "extract"
+)
+
+const (
+	JobPending = "pending"
+	JobRunning = "running"
+	JobDone    = "done"
+	JobFailed  = "failed"
+)
+
+// Job is a PDF operation run in background on behalf of user. Document_ids are source documents in order,
+// Pages holds page selections, one per resulting document. Result_ids are documents created by the job.
+type Job struct {
+	Job_id       int        `json:"job_id"`
+	User_id      int        `json:"user_id"`
+	Operation    string     `json:"operation"`
+	Status       string     `json:"status"`
+	Document_ids []int      `json:"document_ids"`
+	Pages        []string   `json:"pages"`
+	Title        string     `json:"title"`
+	Result_ids   []int      `json:"result_ids"`
+	Error        string     `json:"error,omitempty"`
+	Created_at   time.Time  `json:"created_at"`
+	Finished_at  *time.Time `json:"finished_at"`
+}
+
+type JobLayer struct {
+	DB *pgxpool.Pool
+}
+
+func (j JobLayer) Insert(job *Job) error {
+	query := `
+		INSERT INTO document_jobs (user_id, operation, document_ids, pages, title)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING job_id, status, result_ids, created_at
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := []interface{}{job.User_id, job.Operation, job.Document_ids, job.Pages, job.Title}
+
+	return j.DB.QueryRow(ctx, query, args...).Scan(&job.Job_id, &job.Status, &job.Result_ids, &job.Created_at)
+}
+
+func (j JobLayer) Get(id int) (*Job, error) {
+	query := `
+		SELECT job_id, user_id, operation, status, document_ids, pages, title, result_ids, error, created_at, finished_at
+		FROM document_jobs
+		WHERE job_id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	job := Job{}
+
+	err := j.DB.QueryRow(ctx, query, id).Scan(
+		&job.Job_id,
+		&job.User_id,
+		&job.Operation,
+		&job.Status,
+		&job.Document_ids,
+		&job.Pages,
+		&job.Title,
+		&job.Result_ids,
+		&job.Error,
+		&job.Created_at,
+		&job.Finished_at,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &job, nil
+}
+
+// Start marks pending job as running.
+func (j JobLayer) Start(job *Job) error {
+	query := `
+		UPDATE document_jobs
+		SET status = 'running'
+		WHERE job_id = $1 AND status = 'pending'
+		RETURNING status
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := j.DB.QueryRow(ctx, query, job.Job_id).Scan(&job.Status)
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Finish records outcome of running job, it failed when message isn't empty. Documents created before
+// the failure are still reported in results.
+func (j JobLayer) Finish(job *Job, result_ids []int, message string) error {
+	query := `
+		UPDATE document_jobs
+		SET status = CASE WHEN $3 = '' THEN 'done' ELSE 'failed' END, result_ids = $2, error = $3, finished_at = NOW()
+		WHERE job_id = $1
+		RETURNING status, result_ids, error, finished_at
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return j.DB.QueryRow(ctx, query, job.Job_id, result_ids, message).Scan(&job.Status, &job.Result_ids, &job.Error, &job.Finished_at)
+}
+
+// FailUnfinished fails jobs left pending or running, jobs only run inside the server process so those
+// were interrupted by its shutdown. Returns the number of failed jobs.
+func (j JobLayer) FailUnfinished() (int64, error) {
+	query := `
+		UPDATE document_jobs
+		SET status = 'failed', error = 'interrupted by server restart', finished_at = NOW()
+		WHERE status IN ('pending', 'running')
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := j.DB.Exec(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected(), nil
+}
+
+// DeleteFinished removes jobs which finished before given time, their results stay as regular documents.
+func (j JobLayer) DeleteFinished(before time.Time) (int64, error) {
+	query := `
+		DELETE FROM document_jobs
+		WHERE finished_at < $1
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := j.DB.Exec(ctx, query, before)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected(), nil
+}
@@ -0,0 +1,132 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	RoleRead = "read"
+	RoleEdit = "edit"
+)
+
+// Permission grants single user access to document beyond its visibility, owner and admins don't need one.
+type Permission struct {
+	Document_id int       `json:"document_id"`
+	User_id     int       `json:"user_id"`
+	Role        string    `json:"role"`
+	Granted_by  *int      `json:"granted_by"`
+	Created_at  time.Time `json:"created_at"`
+}
+
+type PermissionLayer struct {
+	DB *pgxpool.Pool
+}
+
+// Grant gives user a role on document, role of user who already has access is replaced.
+func (p PermissionLayer) Grant(permission *Permission) error {
+	query := `
+		INSERT INTO document_permissions (document_id, user_id, role, granted_by)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (document_id, user_id) DO UPDATE SET role = EXCLUDED.role, granted_by = EXCLUDED.granted_by
+		RETURNING created_at
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := []interface{}{permission.Document_id, permission.User_id, permission.Role, permission.Granted_by}
+
+	return p.DB.QueryRow(ctx, query, args...).Scan(&permission.Created_at)
+}
+
+func (p PermissionLayer) Revoke(document_id int, user_id int) error {
+	query := `
+		DELETE FROM document_permissions
+		WHERE document_id = $1 AND user_id = $2
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := p.DB.Exec(ctx, query, document_id, user_id)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// GetRole returns user's role on document, ErrRecordNotFound means user has no permission granted.
+func (p PermissionLayer) GetRole(document_id int, user_id int) (string, error) {
+	query := `
+		SELECT role
+		FROM document_permissions
+		WHERE document_id = $1 AND user_id = $2
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	role := ""
+
+	err := p.DB.QueryRow(ctx, query, document_id, user_id).Scan(&role)
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			return "", ErrRecordNotFound
+		default:
+			return "", err
+		}
+	}
+
+	return role, nil
+}
+
+func (p PermissionLayer) GetAllForDocument(document_id int) ([]Permission, error) {
+	query := `
+		SELECT document_id, user_id, role, granted_by, created_at
+		FROM document_permissions
+		WHERE document_id = $1
+		ORDER BY created_at ASC, user_id ASC
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := p.DB.Query(ctx, query, document_id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	permissions := []Permission{}
+
+	for rows.Next() {
+		permission := Permission{}
+		err := rows.Scan(
+			&permission.Document_id,
+			&permission.User_id,
+			&permission.Role,
+			&permission.Granted_by,
+			&permission.Created_at,
+		)
+		if err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, permission)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return permissions, nil
+}
@@ -0,0 +1,268 @@
+package data
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Share is a link giving access to single document without an account, token is hashed like Token's.
+// Watermark overrides document's own one for downloads through the link.
+type Share struct {
+	Share_id      int        `json:"share_id"`
+	Document_id   int        `json:"document_id"`
+	User_id       int        `json:"user_id"`
+	Plaintext     string     `json:"token,omitempty"`
+	Hash          []byte     `json:"-"`
+	Expiry        *time.Time `json:"expiry"`
+	Max_downloads *int       `json:"max_downloads"`
+	Downloads     int        `json:"downloads"`
+	Password      password   `json:"-"`
+	Has_password  bool       `json:"has_password"`
+	Watermark     *Watermark `json:"watermark"`
+	Created_at    time.Time  `json:"created_at"`
+	//? wrong passwords entered since the last correct one, link is locked for a while once there are too many
+	Failed_attempts int        `json:"-"`
+	Locked_until    *time.Time `json:"-"`
+}
+
+type ShareLayer struct {
+	DB *pgxpool.Pool
+}
+
+// Usable reports whether share link can still be resolved.
+func (s *Share) Usable() bool {
+	if s.Expiry != nil && time.Now().After(*s.Expiry) {
+		return false
+	}
+	if s.Max_downloads != nil && s.Downloads >= *s.Max_downloads {
+		return false
+	}
+
+	return true
+}
+
+// Locked reports whether protected share is locked after too many wrong passwords.
+func (s *Share) Locked() bool {
+	return s.Locked_until != nil && time.Now().Before(*s.Locked_until)
+}
+
+// Matches checks password of protected share, shares without password match anything.
+func (s *Share) Matches(plaintextPassword string) (bool, error) {
+	if !s.Has_password {
+		return true, nil
+	}
+
+	return s.Password.Matches(plaintextPassword)
+}
+
+func (s ShareLayer) New(share *Share) error {
+	var err error
+	share.Plaintext, share.Hash, err = generateSecret()
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO shares (document_id, user_id, hash, expiry, max_downloads, password_hash, watermark)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING share_id, created_at
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := []interface{}{share.Document_id, share.User_id, share.Hash, share.Expiry, share.Max_downloads, share.Password.hash, share.Watermark}
+
+	err = s.DB.QueryRow(ctx, query, args...).Scan(&share.Share_id, &share.Created_at)
+	if err != nil {
+		return err
+	}
+
+	share.Has_password = share.Password.hash != nil
+
+	return nil
+}
+
+func (s ShareLayer) GetForToken(tokenPlaintext string) (*Share, error) {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+
+	query := `
+		SELECT share_id, document_id, user_id, expiry, max_downloads, downloads, password_hash, watermark, created_at, failed_attempts, locked_until
+		FROM shares
+		WHERE hash = $1
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	share := Share{}
+
+	err := s.DB.QueryRow(ctx, query, tokenHash[:]).Scan(
+		&share.Share_id,
+		&share.Document_id,
+		&share.User_id,
+		&share.Expiry,
+		&share.Max_downloads,
+		&share.Downloads,
+		&share.Password.hash,
+		&share.Watermark,
+		&share.Created_at,
+		&share.Failed_attempts,
+		&share.Locked_until,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	share.Has_password = share.Password.hash != nil
+
+	return &share, nil
+}
+
+func (s ShareLayer) GetAllForDocument(document_id int) ([]Share, error) {
+	query := `
+		SELECT share_id, document_id, user_id, expiry, max_downloads, downloads, password_hash IS NOT NULL, watermark, created_at
+		FROM shares
+		WHERE document_id = $1
+		ORDER BY share_id ASC
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := s.DB.Query(ctx, query, document_id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	shares := []Share{}
+
+	for rows.Next() {
+		share := Share{}
+		err := rows.Scan(
+			&share.Share_id,
+			&share.Document_id,
+			&share.User_id,
+			&share.Expiry,
+			&share.Max_downloads,
+			&share.Downloads,
+			&share.Has_password,
+			&share.Watermark,
+			&share.Created_at,
+		)
+		if err != nil {
+			return nil, err
+		}
+		shares = append(shares, share)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return shares, nil
+}
+
+// RecordDownload counts a download, ErrRecordNotFound means share expired or ran out of downloads
+// in the meantime, so the limit holds even when the link is resolved concurrently.
+func (s ShareLayer) RecordDownload(share *Share) error {
+	query := `
+		UPDATE shares
+		SET downloads = downloads + 1
+		WHERE share_id = $1
+		AND (expiry IS NULL OR expiry > NOW())
+		AND (max_downloads IS NULL OR downloads < max_downloads)
+		RETURNING downloads
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := s.DB.QueryRow(ctx, query, share.Share_id).Scan(&share.Downloads)
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RecordFailedAttempt counts wrong password, the max_attempts-th one in a row locks share for lockout and starts
+// counting anew. Attempts made while share is locked are not counted.
+func (s ShareLayer) RecordFailedAttempt(share *Share, max_attempts int, lockout time.Duration) error {
+	query := `
+		UPDATE shares
+		SET failed_attempts = CASE WHEN failed_attempts + 1 >= $2 THEN 0 ELSE failed_attempts + 1 END,
+		locked_until = CASE WHEN failed_attempts + 1 >= $2 THEN NOW() + make_interval(secs => $3) ELSE locked_until END
+		WHERE share_id = $1
+		AND (locked_until IS NULL OR locked_until <= NOW())
+		RETURNING failed_attempts, locked_until
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := []interface{}{share.Share_id, max_attempts, lockout.Seconds()}
+
+	err := s.DB.QueryRow(ctx, query, args...).Scan(&share.Failed_attempts, &share.Locked_until)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return err
+	}
+
+	return nil
+}
+
+// ResetFailedAttempts forgets wrong passwords entered before the correct one.
+func (s ShareLayer) ResetFailedAttempts(share *Share) error {
+	query := `
+		UPDATE shares
+		SET failed_attempts = 0
+		WHERE share_id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := s.DB.Exec(ctx, query, share.Share_id)
+	if err != nil {
+		return err
+	}
+	share.Failed_attempts = 0
+
+	return nil
+}
+
+func (s ShareLayer) Delete(share_id int, document_id int) error {
+	query := `
+		DELETE FROM shares
+		WHERE share_id = $1 AND document_id = $2
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := s.DB.Exec(ctx, query, share_id, document_id)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,81 @@
+// Package testdb prepares PostgreSQL database for tests which need one. Tests are skipped unless TEST_POSTGRES_DSN
+// points to a database they can create schemas in, every test gets its own schema with all migrations applied.
+package testdb
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func Open(t testing.TB) *pgxpool.Pool {
+	t.Helper()
+
+	dsn := os.Getenv("TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("TEST_POSTGRES_DSN is not set")
+	}
+
+	ctx := context.Background()
+
+	admin, err := pgxpool.New(ctx, dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	schema := fmt.Sprintf("test_%d", time.Now().UnixNano())
+	_, err = admin.Exec(ctx, "CREATE SCHEMA "+schema)
+	if err != nil {
+		admin.Close()
+		t.Fatal(err)
+	}
+
+	config, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	//? migrations expect extensions (citext) to be installed in public schema
+	config.ConnConfig.RuntimeParams["search_path"] = schema + ", public"
+
+	pool, err := pgxpool.NewWithConfig(ctx, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		pool.Close()
+		_, err := admin.Exec(ctx, "DROP SCHEMA "+schema+" CASCADE")
+		if err != nil {
+			t.Error(err)
+		}
+		admin.Close()
+	})
+
+	_, source, _, _ := runtime.Caller(0)
+	migrations, err := filepath.Glob(filepath.Join(filepath.Dir(source), "..", "..", "..", "migrations", "*.up.sql"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(migrations)
+
+	for _, migration := range migrations {
+		content, err := os.ReadFile(migration)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = pool.Exec(ctx, string(content))
+		if err != nil {
+			t.Fatalf("%s: %v", filepath.Base(migration), err)
+		}
+	}
+
+	return pool
+}
@@ -13,6 +13,7 @@ import (
 const (
 	ScopeAuthentication = "authentication"
 	ScopeActivation     = "activation"
+	ScopePasswordReset  = "password-reset"
 )
 
 type Token struct {
@@ -34,19 +35,29 @@ func generateToken(userID int, ttl time.Duration, scope string) (*Token, error)
 		Scope:   scope,
 	}
 
+	var err error
+	token.Plaintext, token.Hash, err = generateSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+// generateSecret returns random plaintext handed to the client and its hash, only the hash is stored.
+func generateSecret() (string, []byte, error) {
 	randomBytes := make([]byte, 16)
 
 	_, err := rand.Read(randomBytes)
 	if err != nil {
-		return nil, err
+		return "", nil, err
 	}
 
-	token.Plaintext = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes)
+	plaintext := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes)
 
-	hash := sha256.Sum256([]byte(token.Plaintext))
-	token.Hash = hash[:]
+	hash := sha256.Sum256([]byte(plaintext))
 
-	return token, nil
+	return plaintext, hash[:], nil
 }
 
 func (t TokenLayer) New(userID int, ttl time.Duration, scope string) (*Token, error) {
@@ -0,0 +1,238 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type Upload struct {
+	Upload_id         int       `json:"upload_id"`
+	User_id           int       `json:"user_id"`
+	Filename          string    `json:"filename"`
+	Filetype          string    `json:"filetype"`
+	Tags              []string  `json:"tags"`
+	Is_hidden         bool      `json:"is_hidden"`
+	Size              int64     `json:"size"`
+	Uploaded_size     int64     `json:"uploaded_size"`
+	Storage_key       string    `json:"-"`
+	Storage_upload_id string    `json:"-"`
+	Part_etags        []string  `json:"-"`
+	Hash_state        []byte    `json:"-"`
+	Leased_until      time.Time `json:"-"`
+	Created_at        time.Time `json:"created_at"`
+	Updated_at        time.Time `json:"updated_at"`
+}
+
+type UploadLayer struct {
+	DB *pgxpool.Pool
+}
+
+func (u UploadLayer) Insert(upload *Upload) error {
+	query := `
+		INSERT INTO uploads (user_id, filename, tags, is_hidden, size, storage_key)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING upload_id, created_at, updated_at
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := []interface{}{upload.User_id, upload.Filename, upload.Tags, upload.Is_hidden, upload.Size, upload.Storage_key}
+
+	err := u.DB.QueryRow(ctx, query, args...).Scan(&upload.Upload_id, &upload.Created_at, &upload.Updated_at)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (u UploadLayer) Get(id int) (*Upload, error) {
+	query := `
+		SELECT upload_id, user_id, filename, filetype, tags, is_hidden, size, uploaded_size, storage_key, storage_upload_id, part_etags, hash_state, created_at, updated_at
+		FROM uploads
+		WHERE upload_id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	upload := Upload{}
+
+	err := u.DB.QueryRow(ctx, query, id).Scan(
+		&upload.Upload_id,
+		&upload.User_id,
+		&upload.Filename,
+		&upload.Filetype,
+		&upload.Tags,
+		&upload.Is_hidden,
+		&upload.Size,
+		&upload.Uploaded_size,
+		&upload.Storage_key,
+		&upload.Storage_upload_id,
+		&upload.Part_etags,
+		&upload.Hash_state,
+		&upload.Created_at,
+		&upload.Updated_at,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &upload, nil
+}
+
+// Lease reserves chunk at offset for the caller until given time, so only one request at a time stores a part
+// of the upload, completing and aborting claim the whole session the same way. ErrEditConflict means the offset
+// moved on or the session is held by another request. Storage_upload_id and parts are reloaded, a concurrent
+// request might have changed them.
+func (u UploadLayer) Lease(upload *Upload, offset int64, until time.Time) error {
+	query := `
+		UPDATE uploads
+		SET leased_until = $1
+		WHERE upload_id = $2 AND uploaded_size = $3 AND (leased_until IS NULL OR leased_until < NOW())
+		RETURNING leased_until, storage_upload_id, part_etags, hash_state
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := u.DB.QueryRow(ctx, query, until, upload.Upload_id, offset).Scan(&upload.Leased_until, &upload.Storage_upload_id, &upload.Part_etags, &upload.Hash_state)
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ReleaseLease gives up chunk reserved with Lease which wasn't stored, next one doesn't have to wait for it to expire.
+func (u UploadLayer) ReleaseLease(upload *Upload) error {
+	query := `
+		UPDATE uploads
+		SET leased_until = NULL
+		WHERE upload_id = $1 AND leased_until = $2
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := u.DB.Exec(ctx, query, upload.Upload_id, upload.Leased_until)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Update saves upload progress and releases lease of the stored chunk, ErrEditConflict means the lease expired
+// and the chunk at previousSize could have been stored by someone else meanwhile.
+func (u UploadLayer) Update(upload *Upload, previousSize int64) error {
+	query := `
+		UPDATE uploads
+		SET filetype = $1, uploaded_size = $2, storage_upload_id = $3, part_etags = $4, hash_state = $5, leased_until = NULL, updated_at = NOW()
+		WHERE upload_id = $6 AND uploaded_size = $7 AND leased_until = $8
+		RETURNING updated_at
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := []interface{}{upload.Filetype, upload.Uploaded_size, upload.Storage_upload_id, upload.Part_etags, upload.Hash_state, upload.Upload_id, previousSize, upload.Leased_until}
+
+	err := u.DB.QueryRow(ctx, query, args...).Scan(&upload.Updated_at)
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (u UploadLayer) Delete(id int) error {
+	query := `
+		DELETE FROM uploads
+		WHERE upload_id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := u.DB.Exec(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// GetStale lists sessions inactive since before, sessions held by a request are left alone.
+func (u UploadLayer) GetStale(before time.Time) ([]Upload, error) {
+	query := `
+		SELECT upload_id, user_id, storage_key, storage_upload_id
+		FROM uploads
+		WHERE updated_at < $1 AND (leased_until IS NULL OR leased_until < NOW())
+	`
+
+	return u.getSessions(query, before)
+}
+
+func (u UploadLayer) GetAllForUser(user_id int) ([]Upload, error) {
+	query := `
+		SELECT upload_id, user_id, storage_key, storage_upload_id
+		FROM uploads
+		WHERE user_id = $1
+	`
+
+	return u.getSessions(query, user_id)
+}
+
+// getSessions lists uploads with just the fields needed to abort them in storage.
+func (u UploadLayer) getSessions(query string, arg interface{}) ([]Upload, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := u.DB.Query(ctx, query, arg)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	uploads := []Upload{}
+
+	for rows.Next() {
+		upload := Upload{}
+		err := rows.Scan(
+			&upload.Upload_id,
+			&upload.User_id,
+			&upload.Storage_key,
+			&upload.Storage_upload_id,
+		)
+		if err != nil {
+			return nil, err
+		}
+		uploads = append(uploads, upload)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return uploads, nil
+}
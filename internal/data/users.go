@@ -15,6 +15,7 @@ var (
 	ErrDuplicateEmail = errors.New("duplicate email")
 	ErrRecordNotFound = errors.New("record not found")
 	ErrBadPassword    = errors.New("bad password")
+	ErrEditConflict   = errors.New("edit conflict")
 )
 
 type UserLayer struct {
@@ -29,13 +30,15 @@ type password struct {
 var AnonymousUser = &User{}
 
 type User struct {
-	User_id    int       `json:"user_id"`
-	Created_at time.Time `json:"created_at"`
-	Username   string    `json:"username"`
-	Email      string    `json:"email"`
-	Password   password  `json:"-"`
-	Activated  bool      `json:"activated"`
-	Is_admin   bool      `json:"is_admin"`
+	User_id         int       `json:"user_id"`
+	Created_at      time.Time `json:"created_at"`
+	Username        string    `json:"username"`
+	Email           string    `json:"email"`
+	Password        password  `json:"-"`
+	Activated       bool      `json:"activated"`
+	Is_admin        bool      `json:"is_admin"`
+	Max_upload_size *int64    `json:"max_upload_size,omitempty"`
+	Version         int       `json:"-"`
 }
 
 func (u *User) IsAnonymous() bool {
@@ -72,14 +75,14 @@ func (u UserLayer) Insert(user *User) error {
 	query := `
 		INSERT INTO users (username, email, password_hash, activated, is_admin)
 		VALUES ($1, $2, $3, $4, $5)
-		RETURNING user_id, created_at
+		RETURNING user_id, created_at, version
 	`
 	args := []interface{}{user.Username, user.Email, user.Password.hash, user.Activated, user.Is_admin}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	err := u.DB.QueryRow(ctx, query, args...).Scan(&user.User_id, &user.Created_at)
+	err := u.DB.QueryRow(ctx, query, args...).Scan(&user.User_id, &user.Created_at, &user.Version)
 	if err != nil {
 		switch {
 		case err.Error() == `ERROR: duplicate key value violates unique constraint "users_email_key" (SQLSTATE 23505)`:
@@ -95,8 +98,9 @@ func (u UserLayer) Insert(user *User) error {
 func (u UserLayer) Update(user *User) error {
 	query := `
 		UPDATE users
-		SET username = $1, email = $2, password_hash = $3, activated = $4, is_admin = $5
-		WHERE user_id = $6
+		SET username = $1, email = $2, password_hash = $3, activated = $4, is_admin = $5, max_upload_size = $6, version = version + 1
+		WHERE user_id = $7 AND version = $8
+		RETURNING version
 	`
 
 	args := []interface{}{
@@ -105,15 +109,22 @@ func (u UserLayer) Update(user *User) error {
 		user.Password.hash,
 		user.Activated,
 		user.Is_admin,
+		user.Max_upload_size,
 		user.User_id,
+		user.Version,
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	_, err := u.DB.Exec(ctx, query, args...)
+	err := u.DB.QueryRow(ctx, query, args...).Scan(&user.Version)
 	if err != nil {
-		return err
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
 	}
 
 	return nil
@@ -123,7 +134,7 @@ func (u UserLayer) GetForToken(tokenScope, tokenPlaintext string) (*User, error)
 	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
 
 	query := `
-		SELECT users.user_id, users.created_at, users.username, users.email, users.password_hash, users.activated, users.is_admin
+		SELECT users.user_id, users.created_at, users.username, users.email, users.password_hash, users.activated, users.is_admin, users.max_upload_size, users.version
 		FROM users
 		INNER JOIN tokens
 		ON users.user_id = tokens.user_id
@@ -147,6 +158,8 @@ func (u UserLayer) GetForToken(tokenScope, tokenPlaintext string) (*User, error)
 		&user.Password.hash,
 		&user.Activated,
 		&user.Is_admin,
+		&user.Max_upload_size,
+		&user.Version,
 	)
 	if err != nil {
 		switch {
@@ -162,7 +175,7 @@ func (u UserLayer) GetForToken(tokenScope, tokenPlaintext string) (*User, error)
 
 func (u UserLayer) GetByEmail(email string) (*User, error) {
 	query := `
-		SELECT user_id, created_at, username, email, password_hash, activated, is_admin
+		SELECT user_id, created_at, username, email, password_hash, activated, is_admin, max_upload_size, version
 		FROM users
 		WHERE email = $1
 	`
@@ -180,6 +193,8 @@ func (u UserLayer) GetByEmail(email string) (*User, error) {
 		&user.Password.hash,
 		&user.Activated,
 		&user.Is_admin,
+		&user.Max_upload_size,
+		&user.Version,
 	)
 	if err != nil {
 		switch {
@@ -195,7 +210,7 @@ func (u UserLayer) GetByEmail(email string) (*User, error) {
 
 func (u UserLayer) GetById(id int) (*User, error) {
 	query := `
-		SELECT user_id, created_at, username, email, password_hash, activated, is_admin
+		SELECT user_id, created_at, username, email, password_hash, activated, is_admin, max_upload_size, version
 		FROM users
 		WHERE user_id = $1
 	`
@@ -213,6 +228,8 @@ func (u UserLayer) GetById(id int) (*User, error) {
 		&user.Password.hash,
 		&user.Activated,
 		&user.Is_admin,
+		&user.Max_upload_size,
+		&user.Version,
 	)
 	if err != nil {
 		switch {
@@ -228,7 +245,7 @@ func (u UserLayer) GetById(id int) (*User, error) {
 
 func (u UserLayer) GetAll() ([]User, error) {
 	query := `
-		SELECT user_id, username, email, created_at, activated, is_admin
+		SELECT user_id, username, email, created_at, activated, is_admin, max_upload_size, version
 		FROM users
 	`
 
@@ -252,6 +269,8 @@ func (u UserLayer) GetAll() ([]User, error) {
 			&user.Created_at,
 			&user.Activated,
 			&user.Is_admin,
+			&user.Max_upload_size,
+			&user.Version,
 		)
 		if err != nil {
 			return nil, err
@@ -265,24 +284,56 @@ func (u UserLayer) GetAll() ([]User, error) {
 	return users, nil
 }
 
-func (u UserLayer) Delete(id int) error {
-	query := `
-		DELETE FROM users
-		WHERE user_id = $1
-	`
-
+// Delete removes user, documents are not referenced by users table and have to be purged separately,
+// unless transfer_to is given, in which case they are handed over to that user in the same transaction.
+func (u UserLayer) Delete(id int, transfer_to *int) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	_, err := u.DB.Exec(ctx, query, id)
+	tx, err := u.DB.Begin(ctx)
 	if err != nil {
-		switch {
-		case errors.Is(err, pgx.ErrNoRows):
-			return ErrRecordNotFound
-		default:
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if transfer_to != nil {
+		//? new owner doesn't need permissions granted on documents it now owns, folders stay behind
+		query := `
+			DELETE FROM document_permissions
+			WHERE user_id = $2
+			AND document_id IN (SELECT document_id FROM documents WHERE user_id = $1)
+		`
+
+		_, err = tx.Exec(ctx, query, id, *transfer_to)
+		if err != nil {
+			return err
+		}
+
+		query = `
+			UPDATE documents
+			SET user_id = $2, folder_id = NULL, version = version + 1
+			WHERE user_id = $1
+		`
+
+		_, err = tx.Exec(ctx, query, id, *transfer_to)
+		if err != nil {
 			return err
 		}
 	}
 
-	return nil
+	query := `
+		DELETE FROM users
+		WHERE user_id = $1
+	`
+
+	result, err := tx.Exec(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrRecordNotFound
+	}
+
+	return tx.Commit(ctx)
 }
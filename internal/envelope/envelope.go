@@ -0,0 +1,154 @@
+// Package envelope implements envelope encryption of blobs: every blob is sealed with its own random data key,
+// which is stored wrapped (encrypted) by a master key held by KMS. Master keys can be rotated by rewrapping data
+// keys, blobs themselves are never re-encrypted.
+package envelope
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// DataKeySize is the size of AES-256 keys used for both data and master keys.
+const DataKeySize = 32
+
+var (
+	ErrUnknownKey = errors.New("master key not found")
+	ErrInvalidKey = errors.New("invalid master key")
+	ErrUnwrap     = errors.New("data key is corrupted or was wrapped with another master key")
+)
+
+// KMS wraps and unwraps data keys with master keys it holds, master keys never leave it. Implementations backed
+// by cloud key management services only have to satisfy this interface.
+type KMS interface {
+	// Wrap encrypts data key with the current master key and returns id of the master key used.
+	Wrap(ctx context.Context, data_key []byte) ([]byte, string, error)
+	// Unwrap decrypts data key wrapped with master key of given id, ErrUnknownKey is returned when the key is gone.
+	Unwrap(ctx context.Context, wrapped []byte, key_id string) ([]byte, error)
+	// CurrentKey returns id of master key new data keys are wrapped with.
+	CurrentKey() string
+}
+
+// NewDataKey generates random data key for a single blob.
+func NewDataKey() ([]byte, error) {
+	data_key := make([]byte, DataKeySize)
+	_, err := rand.Read(data_key)
+	if err != nil {
+		return nil, err
+	}
+
+	return data_key, nil
+}
+
+// Keyring is KMS keeping master keys in memory, the current key wraps new data keys and the others are kept
+// to unwrap data keys until they are rotated.
+type Keyring struct {
+	current string
+	keys    map[string][]byte
+}
+
+// NewKeyring builds keyring from base64 encoded master keys, current one included in keys under its id.
+func NewKeyring(current string, keys map[string]string) (*Keyring, error) {
+	keyring := &Keyring{current: current, keys: make(map[string][]byte, len(keys))}
+
+	for id, encoded := range keys {
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(key) != DataKeySize {
+			return nil, fmt.Errorf("%w: %s must be %d bytes encoded in base64", ErrInvalidKey, id, DataKeySize)
+		}
+		keyring.keys[id] = key
+	}
+
+	if _, ok := keyring.keys[current]; !ok {
+		return nil, fmt.Errorf("%w: current key %s", ErrUnknownKey, current)
+	}
+
+	return keyring, nil
+}
+
+// NewMasterKeyring builds keyring from master key given in configuration, previous master keys stay usable for
+// unwrapping until data keys are rotated. Ids of the keys are derived from their content.
+func NewMasterKeyring(master_key string, previous_keys []string) (*Keyring, error) {
+	keys := map[string]string{masterKeyID(master_key): master_key}
+	for _, encoded := range previous_keys {
+		keys[masterKeyID(encoded)] = encoded
+	}
+
+	return NewKeyring(masterKeyID(master_key), keys)
+}
+
+func masterKeyID(encoded string) string {
+	digest := sha256.Sum256([]byte(encoded))
+	return "master-" + hex.EncodeToString(digest[:4])
+}
+
+type keyringFile struct {
+	Current string            `json:"current"`
+	Keys    map[string]string `json:"keys"`
+}
+
+// LoadKeyring reads keyring from local JSON file in the form of {"current": "<id>", "keys": {"<id>": "<base64 key>"}}.
+// To rotate, a new key is added and made current, the old one can be removed once data keys are rewrapped.
+func LoadKeyring(path string) (*Keyring, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	file := keyringFile{}
+	err = json.Unmarshal(content, &file)
+	if err != nil {
+		return nil, fmt.Errorf("malformed keyring file: %w", err)
+	}
+
+	return NewKeyring(file.Current, file.Keys)
+}
+
+func (k *Keyring) CurrentKey() string {
+	return k.current
+}
+
+// Wrap seals data key with AES-GCM under the current master key, id of the key is authenticated along.
+func (k *Keyring) Wrap(ctx context.Context, data_key []byte) ([]byte, string, error) {
+	aead, err := newAEAD(k.keys[k.current])
+	if err != nil {
+		return nil, "", err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return aead.Seal(nonce, nonce, data_key, []byte(k.current)), k.current, nil
+}
+
+func (k *Keyring) Unwrap(ctx context.Context, wrapped []byte, key_id string) ([]byte, error) {
+	master_key, ok := k.keys[key_id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKey, key_id)
+	}
+
+	aead, err := newAEAD(master_key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(wrapped) < aead.NonceSize() {
+		return nil, ErrUnwrap
+	}
+
+	data_key, err := aead.Open(nil, wrapped[:aead.NonceSize()], wrapped[aead.NonceSize():], []byte(key_id))
+	if err != nil {
+		return nil, ErrUnwrap
+	}
+
+	return data_key, nil
+}
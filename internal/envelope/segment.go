@@ -0,0 +1,128 @@
+package envelope
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// SealedSize returns size of plaintext of given size once it's sealed in chunks.
+func SealedSize(plain_size int64) int64 {
+	return plain_size + chunks(plain_size)*Overhead
+}
+
+// SealSegment seals size bytes of plain with a data key of its own, wrapped by kms. Segment starts with header
+// holding the wrapped key and plaintext size, so segments stored one after another can be read back by OpenSegments
+// without knowing where one ends and another begins.
+func SealSegment(ctx context.Context, kms KMS, plain io.Reader, size int64) ([]byte, error) {
+	data_key, err := NewDataKey()
+	if err != nil {
+		return nil, err
+	}
+
+	wrapped, key_id, err := kms.Wrap(ctx, data_key)
+	if err != nil {
+		return nil, err
+	}
+
+	segment := bytes.NewBuffer(make([]byte, 0, 2+len(key_id)+2+len(wrapped)+8+int(SealedSize(size))))
+	_ = binary.Write(segment, binary.BigEndian, uint16(len(key_id)))
+	segment.WriteString(key_id)
+	_ = binary.Write(segment, binary.BigEndian, uint16(len(wrapped)))
+	segment.Write(wrapped)
+	_ = binary.Write(segment, binary.BigEndian, uint64(size))
+
+	sealed, err := NewEncrypter(io.LimitReader(plain, size), data_key)
+	if err != nil {
+		return nil, err
+	}
+
+	n, err := io.Copy(segment, sealed)
+	if err != nil {
+		return nil, err
+	}
+	if n != SealedSize(size) {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	return segment.Bytes(), nil
+}
+
+type segmentReader struct {
+	ctx    context.Context
+	kms    KMS
+	source io.Reader
+	plain  io.Reader
+}
+
+// OpenSegments returns reader of plaintext of segments sealed with SealSegment and read one after another from source.
+// Tampered or truncated segments are reported with ErrCorrupted.
+func OpenSegments(ctx context.Context, kms KMS, source io.Reader) io.Reader {
+	return &segmentReader{ctx: ctx, kms: kms, source: source}
+}
+
+func (s *segmentReader) Read(p []byte) (int, error) {
+	for {
+		if s.plain == nil {
+			plain, err := s.next()
+			if err != nil {
+				return 0, err
+			}
+			s.plain = plain
+		}
+
+		n, err := s.plain.Read(p)
+		if errors.Is(err, io.EOF) {
+			s.plain = nil
+			err = nil
+		}
+		if n > 0 || err != nil {
+			return n, err
+		}
+	}
+}
+
+// next reads header of the following segment and returns reader of its plaintext, io.EOF when there are no more.
+func (s *segmentReader) next() (io.Reader, error) {
+	var key_id_size uint16
+	err := binary.Read(s.source, binary.BigEndian, &key_id_size)
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, io.EOF
+		}
+		return nil, ErrCorrupted
+	}
+
+	key_id := make([]byte, key_id_size)
+	_, err = io.ReadFull(s.source, key_id)
+	if err != nil {
+		return nil, ErrCorrupted
+	}
+
+	var wrapped_size uint16
+	err = binary.Read(s.source, binary.BigEndian, &wrapped_size)
+	if err != nil {
+		return nil, ErrCorrupted
+	}
+
+	wrapped := make([]byte, wrapped_size)
+	_, err = io.ReadFull(s.source, wrapped)
+	if err != nil {
+		return nil, ErrCorrupted
+	}
+
+	var size uint64
+	err = binary.Read(s.source, binary.BigEndian, &size)
+	if err != nil || int64(size) < 0 {
+		return nil, ErrCorrupted
+	}
+
+	data_key, err := s.kms.Unwrap(s.ctx, wrapped, string(key_id))
+	if err != nil {
+		return nil, err
+	}
+
+	return NewDecrypter(io.LimitReader(s.source, SealedSize(int64(size))), data_key, 0, chunks(int64(size)), 0)
+}
@@ -0,0 +1,208 @@
+package envelope
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+const (
+	// ChunkSize is the amount of plaintext sealed at once, chunks are independent so any range of the blob
+	// can be decrypted without reading what precedes it.
+	ChunkSize = 64 << 10
+	// Overhead is the size of authentication tag appended to every chunk.
+	Overhead = 16
+
+	sealedChunkSize = ChunkSize + Overhead
+)
+
+var ErrCorrupted = errors.New("encrypted blob is corrupted or was encrypted with another key")
+
+// chunks returns number of chunks plaintext of given size is sealed in, empty plaintext still takes one.
+func chunks(plain_size int64) int64 {
+	if plain_size == 0 {
+		return 1
+	}
+
+	return (plain_size + ChunkSize - 1) / ChunkSize
+}
+
+// PlainSize returns size of plaintext held by encrypted blob of given size.
+func PlainSize(encrypted_size int64) int64 {
+	count := (encrypted_size + sealedChunkSize - 1) / sealedChunkSize
+	if count == 0 {
+		return 0
+	}
+
+	return encrypted_size - count*Overhead
+}
+
+// TotalChunks returns number of chunks in encrypted blob of given size.
+func TotalChunks(encrypted_size int64) int64 {
+	return chunks(PlainSize(encrypted_size))
+}
+
+// SealedRange translates plaintext range into range of whole chunks of encrypted blob which hold it, along with
+// index of the first chunk. Plaintext range starts skip bytes into decrypted chunks.
+func SealedRange(offset, length int64) (first_chunk int64, sealed_offset int64, sealed_length int64, skip int64) {
+	first_chunk = offset / ChunkSize
+	last_chunk := first_chunk
+	if length > 0 {
+		last_chunk = (offset + length - 1) / ChunkSize
+	}
+
+	sealed_offset = first_chunk * sealedChunkSize
+	sealed_length = (last_chunk - first_chunk + 1) * sealedChunkSize
+	skip = offset - first_chunk*ChunkSize
+
+	return first_chunk, sealed_offset, sealed_length, skip
+}
+
+func newAEAD(data_key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(data_key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// chunkNonce derives nonce from chunk's position, data keys are never reused between blobs so positions are
+// unique. The last chunk is marked, so blob cut at chunk boundary doesn't decrypt.
+func chunkNonce(index int64, last bool) []byte {
+	nonce := make([]byte, 12)
+	binary.BigEndian.PutUint64(nonce, uint64(index))
+	if last {
+		nonce[11] = 1
+	}
+
+	return nonce
+}
+
+type encrypter struct {
+	aead   cipher.AEAD
+	source *bufio.Reader
+	index  int64
+	buffer []byte
+	out    []byte
+	sealed []byte
+	done   bool
+}
+
+// NewEncrypter returns reader of plain sealed chunk by chunk with data key, it never holds more than a chunk in memory.
+func NewEncrypter(plain io.Reader, data_key []byte) (io.Reader, error) {
+	aead, err := newAEAD(data_key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &encrypter{
+		aead:   aead,
+		source: bufio.NewReaderSize(plain, ChunkSize),
+		buffer: make([]byte, ChunkSize),
+		out:    make([]byte, 0, sealedChunkSize),
+	}, nil
+}
+
+func (e *encrypter) Read(p []byte) (int, error) {
+	for len(e.sealed) == 0 {
+		if e.done {
+			return 0, io.EOF
+		}
+
+		n, err := io.ReadFull(e.source, e.buffer)
+		if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+			return 0, err
+		}
+
+		//? chunk is the last one when nothing follows it
+		last := n < ChunkSize
+		if !last {
+			_, err = e.source.Peek(1)
+			if err != nil && !errors.Is(err, io.EOF) {
+				return 0, err
+			}
+			last = errors.Is(err, io.EOF)
+		}
+
+		e.sealed = e.aead.Seal(e.out[:0], chunkNonce(e.index, last), e.buffer[:n], nil)
+		e.index++
+		e.done = last
+	}
+
+	n := copy(p, e.sealed)
+	e.sealed = e.sealed[n:]
+
+	return n, nil
+}
+
+type decrypter struct {
+	aead   cipher.AEAD
+	source io.Reader
+	index  int64
+	total  int64
+	buffer []byte
+	plain  []byte
+	skip   int64
+}
+
+// NewDecrypter returns reader of plaintext held by sealed chunks read from source, starting at chunk first_chunk of
+// blob sealed in total_chunks chunks, first skip bytes of plaintext are dropped. Reading a range of the blob, plaintext
+// has to be limited to its length. Tampered or truncated blobs are reported with ErrCorrupted.
+func NewDecrypter(source io.Reader, data_key []byte, first_chunk int64, total_chunks int64, skip int64) (io.Reader, error) {
+	aead, err := newAEAD(data_key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &decrypter{
+		aead:   aead,
+		source: source,
+		index:  first_chunk,
+		total:  total_chunks,
+		buffer: make([]byte, sealedChunkSize),
+		skip:   skip,
+	}, nil
+}
+
+func (d *decrypter) Read(p []byte) (int, error) {
+	for len(d.plain) == 0 {
+		if d.index >= d.total {
+			return 0, io.EOF
+		}
+
+		//? only the last chunk is shorter, readers of ranges stop before reaching past them
+		n, err := io.ReadFull(d.source, d.buffer)
+		switch {
+		case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+			if d.index != d.total-1 || n == 0 {
+				return 0, ErrCorrupted
+			}
+		case err != nil:
+			return 0, err
+		}
+
+		d.plain, err = d.aead.Open(d.buffer[:0], chunkNonce(d.index, d.index == d.total-1), d.buffer[:n], nil)
+		if err != nil {
+			return 0, ErrCorrupted
+		}
+		d.index++
+
+		if d.skip > 0 {
+			skipped := d.skip
+			if skipped > int64(len(d.plain)) {
+				skipped = int64(len(d.plain))
+			}
+			d.plain = d.plain[skipped:]
+			d.skip -= skipped
+		}
+	}
+
+	n := copy(p, d.plain)
+	d.plain = d.plain[n:]
+
+	return n, nil
+}
@@ -0,0 +1,264 @@
+package envelope
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func newTestKeyring(t *testing.T) *Keyring {
+	t.Helper()
+
+	master_key, err := NewDataKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyring, err := NewMasterKeyring(base64.StdEncoding.EncodeToString(master_key), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return keyring
+}
+
+func randomBytes(t *testing.T, size int) []byte {
+	t.Helper()
+
+	plain := make([]byte, size)
+	_, err := rand.Read(plain)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return plain
+}
+
+func seal(t *testing.T, plain []byte, data_key []byte) []byte {
+	t.Helper()
+
+	encrypter, err := NewEncrypter(bytes.NewReader(plain), data_key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sealed, err := io.ReadAll(encrypter)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return sealed
+}
+
+func TestSealedRange(t *testing.T) {
+	tests := []struct {
+		name              string
+		offset            int64
+		length            int64
+		want_first_chunk  int64
+		want_sealed_start int64
+		want_sealed_size  int64
+		want_skip         int64
+	}{
+		{name: "start of first chunk", offset: 0, length: 10, want_first_chunk: 0, want_sealed_start: 0, want_sealed_size: sealedChunkSize, want_skip: 0},
+		{name: "whole first chunk", offset: 0, length: ChunkSize, want_first_chunk: 0, want_sealed_start: 0, want_sealed_size: sealedChunkSize, want_skip: 0},
+		{name: "last byte of first chunk", offset: ChunkSize - 1, length: 1, want_first_chunk: 0, want_sealed_start: 0, want_sealed_size: sealedChunkSize, want_skip: ChunkSize - 1},
+		{name: "across boundary", offset: ChunkSize - 1, length: 2, want_first_chunk: 0, want_sealed_start: 0, want_sealed_size: 2 * sealedChunkSize, want_skip: ChunkSize - 1},
+		{name: "start of second chunk", offset: ChunkSize, length: 1, want_first_chunk: 1, want_sealed_start: sealedChunkSize, want_sealed_size: sealedChunkSize, want_skip: 0},
+		{name: "spanning three chunks", offset: ChunkSize + 5, length: 2 * ChunkSize, want_first_chunk: 1, want_sealed_start: sealedChunkSize, want_sealed_size: 3 * sealedChunkSize, want_skip: 5},
+		{name: "empty range", offset: 2 * ChunkSize, length: 0, want_first_chunk: 2, want_sealed_start: 2 * sealedChunkSize, want_sealed_size: sealedChunkSize, want_skip: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			first_chunk, sealed_offset, sealed_length, skip := SealedRange(tt.offset, tt.length)
+			if first_chunk != tt.want_first_chunk || sealed_offset != tt.want_sealed_start || sealed_length != tt.want_sealed_size || skip != tt.want_skip {
+				t.Fatalf("SealedRange(%d, %d) = %d, %d, %d, %d, want %d, %d, %d, %d", tt.offset, tt.length,
+					first_chunk, sealed_offset, sealed_length, skip,
+					tt.want_first_chunk, tt.want_sealed_start, tt.want_sealed_size, tt.want_skip)
+			}
+		})
+	}
+}
+
+func TestSizes(t *testing.T) {
+	tests := []struct {
+		plain_size  int64
+		want_chunks int64
+	}{
+		{plain_size: 0, want_chunks: 1},
+		{plain_size: 1, want_chunks: 1},
+		{plain_size: ChunkSize, want_chunks: 1},
+		{plain_size: ChunkSize + 1, want_chunks: 2},
+		{plain_size: 3 * ChunkSize, want_chunks: 3},
+	}
+
+	for _, tt := range tests {
+		sealed_size := SealedSize(tt.plain_size)
+		if sealed_size != tt.plain_size+tt.want_chunks*Overhead {
+			t.Fatalf("SealedSize(%d) = %d", tt.plain_size, sealed_size)
+		}
+		if PlainSize(sealed_size) != tt.plain_size {
+			t.Fatalf("PlainSize(%d) = %d, want %d", sealed_size, PlainSize(sealed_size), tt.plain_size)
+		}
+		if TotalChunks(sealed_size) != tt.want_chunks {
+			t.Fatalf("TotalChunks(%d) = %d, want %d", sealed_size, TotalChunks(sealed_size), tt.want_chunks)
+		}
+	}
+}
+
+func TestDecryptRange(t *testing.T) {
+	data_key, err := NewDataKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plain := randomBytes(t, 3*ChunkSize+100)
+	sealed := seal(t, plain, data_key)
+	if int64(len(sealed)) != SealedSize(int64(len(plain))) {
+		t.Fatalf("sealed %d bytes, want %d", len(sealed), SealedSize(int64(len(plain))))
+	}
+
+	tests := []struct {
+		name   string
+		offset int64
+		length int64
+	}{
+		{name: "whole blob", offset: 0, length: int64(len(plain))},
+		{name: "first byte", offset: 0, length: 1},
+		{name: "end of first chunk", offset: ChunkSize - 10, length: 10},
+		{name: "across first boundary", offset: ChunkSize - 10, length: 20},
+		{name: "exactly second chunk", offset: ChunkSize, length: ChunkSize},
+		{name: "across two boundaries", offset: ChunkSize - 1, length: ChunkSize + 2},
+		{name: "last chunk", offset: 3 * ChunkSize, length: 100},
+		{name: "tail of last chunk", offset: 3*ChunkSize + 99, length: 1},
+		{name: "into last chunk", offset: 2*ChunkSize + 50, length: ChunkSize + 50},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			first_chunk, sealed_offset, sealed_length, skip := SealedRange(tt.offset, tt.length)
+			end := sealed_offset + sealed_length
+			if end > int64(len(sealed)) {
+				end = int64(len(sealed))
+			}
+
+			decrypter, err := NewDecrypter(bytes.NewReader(sealed[sealed_offset:end]), data_key, first_chunk, TotalChunks(int64(len(sealed))), skip)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := io.ReadAll(io.LimitReader(decrypter, tt.length))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, plain[tt.offset:tt.offset+tt.length]) {
+				t.Fatalf("decrypted range differs from plaintext")
+			}
+		})
+	}
+}
+
+func TestDecryptCorrupted(t *testing.T) {
+	data_key, err := NewDataKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other_key, err := NewDataKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plain := randomBytes(t, 2*ChunkSize+10)
+	sealed := seal(t, plain, data_key)
+
+	flipped := bytes.Clone(sealed)
+	flipped[ChunkSize+20] ^= 1
+
+	tests := []struct {
+		name     string
+		sealed   []byte
+		data_key []byte
+	}{
+		{name: "other key", sealed: sealed, data_key: other_key},
+		{name: "flipped bit", sealed: flipped, data_key: data_key},
+		{name: "cut at chunk boundary", sealed: sealed[:2*sealedChunkSize], data_key: data_key},
+		{name: "cut inside chunk", sealed: sealed[:len(sealed)-5], data_key: data_key},
+		{name: "empty", sealed: []byte{}, data_key: data_key},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			//? size is what storage reports, blobs cut at chunk boundary look complete
+			decrypter, err := NewDecrypter(bytes.NewReader(tt.sealed), tt.data_key, 0, TotalChunks(int64(len(sealed))), 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = io.ReadAll(decrypter)
+			if !errors.Is(err, ErrCorrupted) {
+				t.Fatalf("err = %v, want ErrCorrupted", err)
+			}
+		})
+	}
+}
+
+func TestSegments(t *testing.T) {
+	keyring := newTestKeyring(t)
+
+	tests := []struct {
+		name  string
+		sizes []int
+	}{
+		{name: "single segment", sizes: []int{100}},
+		{name: "empty segment", sizes: []int{0}},
+		{name: "segments at chunk boundaries", sizes: []int{ChunkSize, 2 * ChunkSize}},
+		{name: "uneven segments", sizes: []int{ChunkSize + 1, 7, ChunkSize - 1, 0, 3}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plain := []byte{}
+			staged := []byte{}
+
+			for _, size := range tt.sizes {
+				part := randomBytes(t, size)
+				plain = append(plain, part...)
+
+				segment, err := SealSegment(context.Background(), keyring, bytes.NewReader(part), int64(size))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if bytes.Contains(segment, part) && size > 0 {
+					t.Fatal("segment holds plaintext")
+				}
+				staged = append(staged, segment...)
+			}
+
+			got, err := io.ReadAll(OpenSegments(context.Background(), keyring, bytes.NewReader(staged)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, plain) {
+				t.Fatal("opened segments differ from plaintext")
+			}
+
+			_, err = io.ReadAll(OpenSegments(context.Background(), keyring, bytes.NewReader(staged[:len(staged)-1])))
+			if !errors.Is(err, ErrCorrupted) {
+				t.Fatalf("truncated segments: err = %v, want ErrCorrupted", err)
+			}
+		})
+	}
+
+	t.Run("short plaintext", func(t *testing.T) {
+		_, err := SealSegment(context.Background(), keyring, strings.NewReader("short"), 10)
+		if !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Fatalf("err = %v, want io.ErrUnexpectedEOF", err)
+		}
+	})
+}
@@ -0,0 +1,344 @@
+package extract
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+
+	"viadro_api/utils"
+
+	"github.com/ledongthuc/pdf"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/unicode/norm"
+)
+
+var (
+	ErrUnsupportedFiletype = errors.New("text can't be extracted from this file type")
+	ErrMalformed           = errors.New("malformed document")
+)
+
+// Text extracts plain text of document with given filetype, at most limit bytes are returned. Extraction stops
+// at the limit rather than failing, so huge documents are still searchable by their beginning.
+func Text(file io.ReaderAt, size int64, filetype string, limit int) (string, error) {
+	return text(file, size, filetype, limit, 0)
+}
+
+// FirstPage extracts text of document's first page, formats without pages are read from their beginning
+// up to the limit.
+func FirstPage(file io.ReaderAt, size int64, filetype string, limit int) (string, error) {
+	return text(file, size, filetype, limit, 1)
+}
+
+// text extracts at most limit bytes of document's text, pages above 0 stops PDFs after that many pages.
+func text(file io.ReaderAt, size int64, filetype string, limit int, pages int) (string, error) {
+	var text string
+	var err error
+
+	switch filetype {
+	case utils.FiletypePDF:
+		text, err = pdfText(file, size, limit, pages)
+	case utils.FiletypeText, utils.FiletypeMarkdown:
+		text, err = plainText(io.NewSectionReader(file, 0, size), limit)
+	case utils.FiletypeRTF:
+		text, err = rtfText(io.NewSectionReader(file, 0, size), limit)
+	case utils.FiletypeDOCX:
+		text, err = docxText(file, size, limit)
+	default:
+		return "", ErrUnsupportedFiletype
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return normalize(text, limit), nil
+}
+
+// normalize collapses whitespace and drops what PostgreSQL text can't hold (NUL bytes, invalid UTF-8),
+// compatibility forms like ligatures are decomposed, so words containing them can be found.
+func normalize(text string, limit int) string {
+	text = strings.ToValidUTF8(strings.ReplaceAll(text, "\x00", ""), "")
+	text = norm.NFKC.String(text)
+
+	builder := strings.Builder{}
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.Join(strings.Fields(line), " ")
+		if line == "" {
+			continue
+		}
+		if builder.Len()+len(line) >= limit {
+			//? cut at character boundary, a single line can be the whole document
+			line = strings.ToValidUTF8(line[:limit-builder.Len()], "")
+			builder.WriteString(line)
+			break
+		}
+		builder.WriteString(line)
+		builder.WriteByte('\n')
+	}
+
+	return strings.TrimSuffix(builder.String(), "\n")
+}
+
+func pdfText(file io.ReaderAt, size int64, limit int, pages int) (text string, err error) {
+	//? parser panics on malformed files instead of returning errors
+	defer func() {
+		if r := recover(); r != nil {
+			text = ""
+			err = fmt.Errorf("%w: %v", ErrMalformed, r)
+		}
+	}()
+
+	reader, err := pdf.NewReader(file, size)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrMalformed, err)
+	}
+
+	builder := strings.Builder{}
+
+	last := reader.NumPage()
+	if pages > 0 && pages < last {
+		last = pages
+	}
+
+	for i := 1; i <= last && builder.Len() < limit; i++ {
+		page := reader.Page(i)
+		if page.V.IsNull() {
+			continue
+		}
+
+		builder.WriteString(pageText(page))
+		builder.WriteByte('\n')
+	}
+
+	return builder.String(), nil
+}
+
+// pageText lays out glyphs of the page into lines and words by their positions, PDFs rarely contain
+// spaces between words, they just place them apart. Pages which can't be parsed are skipped.
+func pageText(page pdf.Page) (text string) {
+	defer func() {
+		if r := recover(); r != nil {
+			text = ""
+		}
+	}()
+
+	builder := strings.Builder{}
+	var previous *pdf.Text
+
+	glyphs := page.Content().Text
+	for i, glyph := range glyphs {
+		if previous != nil {
+			size := previous.FontSize
+			if size <= 0 {
+				size = 1
+			}
+
+			switch {
+			case math.Abs(glyph.Y-previous.Y) > size/2:
+				builder.WriteByte('\n')
+			case glyph.X-(previous.X+previous.W) > size*0.15:
+				builder.WriteByte(' ')
+			}
+		}
+
+		builder.WriteString(glyph.S)
+		previous = &glyphs[i]
+	}
+
+	return builder.String()
+}
+
+func plainText(file io.Reader, limit int) (string, error) {
+	//? character split by the limit is dropped with other invalid UTF-8 by normalize
+	content, err := io.ReadAll(io.LimitReader(file, int64(limit)))
+	if err != nil {
+		return "", err
+	}
+
+	return string(content), nil
+}
+
+// rtfText strips control words and groups which don't hold document text, \'hh escapes are read as Windows-1252.
+func rtfText(file io.Reader, limit int) (string, error) {
+	reader := bufio.NewReader(file)
+	builder := strings.Builder{}
+
+	depth := 0
+	skip_depth := -1 //? group depth whose content is skipped (destinations like \fonttbl or \*)
+
+	for builder.Len() < limit {
+		char, err := reader.ReadByte()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return "", err
+		}
+
+		switch char {
+		case '{':
+			depth++
+		case '}':
+			if depth == skip_depth {
+				skip_depth = -1
+			}
+			depth--
+		case '\\':
+			word, arg := readRTFControl(reader)
+			if skip_depth != -1 {
+				continue
+			}
+			switch word {
+			case "*", "fonttbl", "colortbl", "stylesheet", "info", "pict", "header", "footer", "listtable", "listoverridetable":
+				skip_depth = depth
+			case "par", "line", "row", "sect", "page":
+				builder.WriteByte('\n')
+			case "tab", "cell":
+				builder.WriteByte('\t')
+			case "'":
+				builder.WriteRune(charmap.Windows1252.DecodeByte(byte(arg)))
+			case "u":
+				//? \uN is followed by a fallback character for readers without unicode support
+				if arg < 0 {
+					arg += 65536
+				}
+				builder.WriteRune(rune(arg))
+				reader.ReadByte()
+			case "\\", "{", "}":
+				builder.WriteString(word)
+			}
+		case '\r', '\n':
+		default:
+			if skip_depth == -1 {
+				builder.WriteByte(char)
+			}
+		}
+	}
+
+	return builder.String(), nil
+}
+
+// readRTFControl reads control word (or symbol) following backslash, argument is its numeric parameter
+// or value of \'hh escape.
+func readRTFControl(reader *bufio.Reader) (string, int) {
+	char, err := reader.ReadByte()
+	if err != nil {
+		return "", 0
+	}
+
+	if char == '\'' {
+		hex := make([]byte, 2)
+		_, err = io.ReadFull(reader, hex)
+		if err != nil {
+			return "", 0
+		}
+		value := 0
+		fmt.Sscanf(string(hex), "%x", &value)
+		return "'", value
+	}
+
+	if !isLetter(char) {
+		return string(char), 0
+	}
+
+	word := []byte{char}
+	for {
+		char, err = reader.ReadByte()
+		if err != nil {
+			return string(word), 0
+		}
+		if !isLetter(char) {
+			break
+		}
+		word = append(word, char)
+	}
+
+	arg, sign := 0, 1
+	if char == '-' {
+		sign = -1
+		char, _ = reader.ReadByte()
+	}
+	for char >= '0' && char <= '9' {
+		arg = arg*10 + int(char-'0')
+		char, err = reader.ReadByte()
+		if err != nil {
+			return string(word), arg * sign
+		}
+	}
+
+	//? single space delimits control word and is not part of the text
+	if char != ' ' {
+		reader.UnreadByte()
+	}
+
+	return string(word), arg * sign
+}
+
+func isLetter(char byte) bool {
+	return (char >= 'a' && char <= 'z') || (char >= 'A' && char <= 'Z')
+}
+
+// docxText reads text runs of word/document.xml, paragraphs become lines.
+func docxText(file io.ReaderAt, size int64, limit int) (string, error) {
+	archive, err := zip.NewReader(file, size)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrMalformed, err)
+	}
+
+	for _, entry := range archive.File {
+		if entry.Name != "word/document.xml" {
+			continue
+		}
+
+		content, err := entry.Open()
+		if err != nil {
+			return "", fmt.Errorf("%w: %v", ErrMalformed, err)
+		}
+		defer content.Close()
+
+		builder := strings.Builder{}
+		decoder := xml.NewDecoder(content)
+		in_text := false
+
+		for builder.Len() < limit {
+			token, err := decoder.Token()
+			if err != nil {
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				return "", fmt.Errorf("%w: %v", ErrMalformed, err)
+			}
+
+			switch element := token.(type) {
+			case xml.StartElement:
+				switch element.Name.Local {
+				case "t":
+					in_text = true
+				case "tab":
+					builder.WriteByte('\t')
+				case "br", "cr":
+					builder.WriteByte('\n')
+				}
+			case xml.EndElement:
+				switch element.Name.Local {
+				case "t":
+					in_text = false
+				case "p":
+					builder.WriteByte('\n')
+				}
+			case xml.CharData:
+				if in_text {
+					builder.Write(element)
+				}
+			}
+		}
+
+		return builder.String(), nil
+	}
+
+	return "", fmt.Errorf("%w: missing word/document.xml", ErrMalformed)
+}
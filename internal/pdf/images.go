@@ -0,0 +1,55 @@
+package pdf
+
+import (
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+)
+
+// FirstPageImage decodes the largest image placed on the first page, nil is returned when there is none which
+// could be decoded. Scanned documents usually consist of a single such image.
+func FirstPageImage(file io.ReadSeeker) (largest image.Image, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			largest = nil
+			err = fmt.Errorf("%w: %v", ErrMalformed, r)
+		}
+	}()
+
+	ctx, err := read(file, model.EXTRACTIMAGES)
+	if err != nil {
+		return nil, err
+	}
+
+	images, err := pdfcpu.ExtractPageImages(ctx, 1, false)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformed, err)
+	}
+
+	area := 0
+	for _, embedded := range images {
+		if embedded.IsImgMask {
+			continue
+		}
+
+		//? only formats of the standard library are decoded, pdfcpu hands out others (e.g. CMYK as TIFF) too
+		decoded, _, err := image.Decode(embedded)
+		if err != nil {
+			continue
+		}
+
+		//? dimensions pdfcpu reports aren't always filled, decoded ones are
+		bounds := decoded.Bounds()
+		if bounds.Dx()*bounds.Dy() > area {
+			largest = decoded
+			area = bounds.Dx() * bounds.Dy()
+		}
+	}
+
+	return largest, nil
+}
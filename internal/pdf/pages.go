@@ -0,0 +1,150 @@
+package pdf
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+)
+
+var (
+	ErrInvalidPages = errors.New("invalid page selection")
+	ErrPageRange    = errors.New("page out of range")
+	ErrEncrypted    = errors.New("PDF is password protected")
+)
+
+// PageRange selects pages From to To inclusive, To 0 means the last page.
+type PageRange struct {
+	From int
+	To   int
+}
+
+func (r PageRange) String() string {
+	switch {
+	case r.To == 0:
+		return fmt.Sprintf("%d-", r.From)
+	case r.To == r.From:
+		return strconv.Itoa(r.From)
+	default:
+		return fmt.Sprintf("%d-%d", r.From, r.To)
+	}
+}
+
+// ParsePages parses page selection like "1-3,5,8-", pages are selected in the given order and may repeat.
+func ParsePages(selection string) ([]PageRange, error) {
+	ranges := []PageRange{}
+
+	for _, part := range strings.Split(selection, ",") {
+		part = strings.TrimSpace(part)
+		from, to, is_range := strings.Cut(part, "-")
+		from, to = strings.TrimSpace(from), strings.TrimSpace(to)
+
+		page_range := PageRange{}
+		var err error
+
+		page_range.From, err = strconv.Atoi(from)
+		if err != nil || page_range.From < 1 {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidPages, part)
+		}
+
+		switch {
+		case !is_range:
+			page_range.To = page_range.From
+		case to != "":
+			page_range.To, err = strconv.Atoi(to)
+			if err != nil || page_range.To < page_range.From {
+				return nil, fmt.Errorf("%w: %q", ErrInvalidPages, part)
+			}
+		}
+
+		ranges = append(ranges, page_range)
+	}
+
+	return ranges, nil
+}
+
+// FormatPages is the inverse of ParsePages.
+func FormatPages(ranges []PageRange) string {
+	parts := make([]string, 0, len(ranges))
+	for _, page_range := range ranges {
+		parts = append(parts, page_range.String())
+	}
+
+	return strings.Join(parts, ",")
+}
+
+// read opens PDF for editing, password protected files are reported with ErrEncrypted and unreadable ones with ErrMalformed.
+func read(file io.ReadSeeker, cmd model.CommandMode) (*model.Context, error) {
+	conf := configuration()
+	conf.Cmd = cmd
+
+	ctx, err := api.ReadValidateAndOptimize(file, conf)
+	if err != nil {
+		if errors.Is(err, pdfcpu.ErrWrongPassword) {
+			return nil, ErrEncrypted
+		}
+		return nil, fmt.Errorf("%w: %v", ErrMalformed, err)
+	}
+
+	return ctx, nil
+}
+
+// SelectPages writes PDF made of selected pages of file into out, selection beyond the last page is rejected
+// with ErrPageRange rather than silently shortened.
+func SelectPages(file io.ReadSeeker, out io.Writer, ranges []PageRange) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%w: %v", ErrMalformed, r)
+		}
+	}()
+
+	ctx, err := read(file, model.COLLECT)
+	if err != nil {
+		return err
+	}
+
+	pages := []int{}
+	for _, page_range := range ranges {
+		to := page_range.To
+		if to == 0 {
+			to = ctx.PageCount
+		}
+		if page_range.From > ctx.PageCount || to > ctx.PageCount {
+			return fmt.Errorf("%w: %s, document has %d pages", ErrPageRange, page_range, ctx.PageCount)
+		}
+		for page := page_range.From; page <= to; page++ {
+			pages = append(pages, page)
+		}
+	}
+
+	selected, err := pdfcpu.ExtractPages(ctx, pages, false)
+	if err != nil {
+		return err
+	}
+
+	return api.Write(selected, out, ctx.Configuration)
+}
+
+// Merge writes PDF made of all pages of files, in their order, into out.
+func Merge(files []io.ReadSeeker, out io.Writer) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%w: %v", ErrMalformed, r)
+		}
+	}()
+
+	err = api.MergeRaw(files, out, false, configuration())
+	if err != nil {
+		if errors.Is(err, pdfcpu.ErrWrongPassword) {
+			return ErrEncrypted
+		}
+		return err
+	}
+
+	return nil
+}
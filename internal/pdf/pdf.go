@@ -0,0 +1,112 @@
+package pdf
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+var ErrMalformed = errors.New("malformed PDF")
+
+func init() {
+	//? pdfcpu would otherwise create its configuration directory in user's home on first use
+	api.DisableConfigDir()
+}
+
+// Info describes PDF as read from its trailer and info dictionary, entries missing in the file are left empty.
+// Password protected files can't be read any further, only Encrypted is known about them.
+type Info struct {
+	Page_count int
+	Title      string
+	Author     string
+	Producer   string
+	Created_at *time.Time
+	Encrypted  bool
+}
+
+func configuration() *model.Configuration {
+	conf := model.NewDefaultConfiguration()
+	conf.ValidationMode = model.ValidationRelaxed
+	return conf
+}
+
+// Inspect reads and validates structure of PDF file, ErrMalformed is returned when it isn't a readable PDF.
+func Inspect(file io.ReadSeeker) (info *Info, err error) {
+	//? parser can panic on damaged cross-reference tables instead of returning errors
+	defer func() {
+		if r := recover(); r != nil {
+			info = nil
+			err = fmt.Errorf("%w: %v", ErrMalformed, r)
+		}
+	}()
+
+	ctx, err := api.ReadContext(file, configuration())
+	if err != nil {
+		if errors.Is(err, pdfcpu.ErrWrongPassword) {
+			return &Info{Encrypted: true}, nil
+		}
+		return nil, fmt.Errorf("%w: %v", ErrMalformed, err)
+	}
+
+	//? relaxed validation tolerates common deviations from the spec, which readers cope with too
+	err = api.ValidateContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformed, err)
+	}
+
+	err = ctx.EnsurePageCount()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformed, err)
+	}
+
+	info = &Info{
+		Page_count: ctx.PageCount,
+		Encrypted:  ctx.Encrypt != nil,
+	}
+
+	if ctx.Info == nil {
+		return info, nil
+	}
+
+	//? info dictionary is optional metadata, a damaged one doesn't make the document unreadable
+	dict, err := ctx.DereferenceDict(*ctx.Info)
+	if err != nil || dict == nil {
+		return info, nil
+	}
+
+	info.Title = infoText(ctx, dict, "Title")
+	info.Author = infoText(ctx, dict, "Author")
+	info.Producer = infoText(ctx, dict, "Producer")
+
+	date := infoText(ctx, dict, "CreationDate")
+	if date != "" {
+		created, ok := types.DateTime(date, true)
+		if ok {
+			created = created.UTC()
+			info.Created_at = &created
+		}
+	}
+
+	return info, nil
+}
+
+func infoText(ctx *model.Context, dict types.Dict, key string) string {
+	value, found := dict.Find(key)
+	if !found {
+		return ""
+	}
+
+	text, err := ctx.DereferenceText(value)
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(strings.ToValidUTF8(strings.ReplaceAll(text, "\x00", ""), ""))
+}
@@ -0,0 +1,53 @@
+package pdf
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+const (
+	StampDiagonal = "diagonal"
+	StampFooter   = "footer"
+)
+
+// stampStyles describe look of stamps in pdfcpu's watermark syntax, stamps are drawn over page content
+// so opaque backgrounds like scans can't hide them.
+var stampStyles = map[string]string{
+	StampDiagonal: "fontname:Helvetica-Bold, points:48, diagonal:1, scalefactor:0.8 rel, opacity:0.25, fillcolor:0.5 0.5 0.5",
+	StampFooter:   "fontname:Helvetica, points:9, position:bc, offset:0 12, rotation:0, scalefactor:1 abs, opacity:0.8, fillcolor:0.3 0.3 0.3",
+}
+
+// Stamp writes file into out with text drawn on every page in given style. Text is set in standard PDF
+// fonts, so characters outside of Latin-1 aren't shown.
+func Stamp(file io.ReadSeeker, out io.Writer, text string, style string) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%w: %v", ErrMalformed, r)
+		}
+	}()
+
+	description, ok := stampStyles[style]
+	if !ok {
+		return fmt.Errorf("unknown stamp style: %s", style)
+	}
+
+	watermark, err := api.TextWatermark(text, description, true, false, types.POINTS)
+	if err != nil {
+		return err
+	}
+
+	err = api.AddWatermarks(file, out, nil, watermark, configuration())
+	if err != nil {
+		if errors.Is(err, pdfcpu.ErrWrongPassword) {
+			return ErrEncrypted
+		}
+		return fmt.Errorf("%w: %v", ErrMalformed, err)
+	}
+
+	return nil
+}
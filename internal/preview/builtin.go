@@ -0,0 +1,127 @@
+package preview
+
+import (
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"viadro_api/internal/extract"
+	"viadro_api/internal/pdf"
+	"viadro_api/utils"
+
+	"golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+const (
+	margin     = 20
+	fontSize   = 9
+	lineHeight = 12
+	//? more than fits on the page even with the shortest lines
+	textLimit = 8 << 10
+)
+
+var regular, _ = opentype.Parse(goregular.TTF)
+
+var ink = image.NewUniform(color.Gray{Y: 0x30})
+
+// Builtin renders previews in pure Go, text of the first page is typeset onto a blank page without the original
+// layout and fonts. PDFs without text, like scans, are shown by the largest image of their first page instead.
+type Builtin struct{}
+
+func (Builtin) Render(ctx context.Context, file *os.File, size int64, filetype string) (image.Image, error) {
+	text, err := extract.FirstPage(file, size, filetype, textLimit)
+	if err != nil {
+		if errors.Is(err, extract.ErrUnsupportedFiletype) {
+			return nil, ErrUnsupportedFiletype
+		}
+		return nil, err
+	}
+
+	if text == "" && filetype == utils.FiletypePDF {
+		_, err = file.Seek(0, io.SeekStart)
+		if err != nil {
+			return nil, err
+		}
+
+		//? page without text nor readable image is rendered blank, which is what it most likely is
+		scan, err := pdf.FirstPageImage(file)
+		if err == nil && scan != nil {
+			return scan, nil
+		}
+	}
+
+	return typeset(text)
+}
+
+// typeset draws text onto white page of Width and Height, lines are wrapped at word boundaries and whatever
+// doesn't fit on the page is left out.
+func typeset(text string) (image.Image, error) {
+	face, err := opentype.NewFace(regular, &opentype.FaceOptions{Size: fontSize, DPI: 72, Hinting: font.HintingFull})
+	if err != nil {
+		return nil, err
+	}
+	defer face.Close()
+
+	page := image.NewRGBA(image.Rect(0, 0, Width, Height))
+	draw.Draw(page, page.Bounds(), image.White, image.Point{}, draw.Src)
+
+	drawer := font.Drawer{Dst: page, Src: ink, Face: face}
+	y := margin + fontSize
+
+	for _, line := range wrap(drawer, text, Width-2*margin) {
+		if y > Height-margin {
+			break
+		}
+		drawer.Dot = fixed.P(margin, y)
+		drawer.DrawString(line)
+		y += lineHeight
+	}
+
+	return page, nil
+}
+
+// wrap breaks text into lines no wider than width, words too long for a line of their own are split.
+func wrap(drawer font.Drawer, text string, width int) []string {
+	lines := []string{}
+	fits := func(s string) bool { return drawer.MeasureString(s).Ceil() <= width }
+
+	for _, paragraph := range strings.Split(text, "\n") {
+		line := ""
+		for _, word := range strings.Fields(paragraph) {
+			candidate := word
+			if line != "" {
+				candidate = line + " " + word
+			}
+			if fits(candidate) {
+				line = candidate
+				continue
+			}
+
+			if line != "" {
+				lines = append(lines, line)
+			}
+			for !fits(word) {
+				cut := len(word)
+				for utf8.RuneCountInString(word[:cut]) > 1 && !fits(word[:cut]) {
+					_, last := utf8.DecodeLastRuneInString(word[:cut])
+					cut -= last
+				}
+				lines = append(lines, word[:cut])
+				word = word[cut:]
+			}
+			line = word
+		}
+		lines = append(lines, line)
+	}
+
+	return lines
+}
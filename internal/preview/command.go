@@ -0,0 +1,88 @@
+package preview
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"viadro_api/utils"
+)
+
+// Command renders PDFs with external program, e.g. pdftoppm or mutool, so previews look like the actual page.
+// Args are the program with its arguments, {input} is replaced with path of the PDF and {output} with path
+// the program writes PNG or JPEG image to, programs which append an extension to it are handled too.
+// Without {output} the image is read from program's standard output. Other filetypes go to Fallback.
+type Command struct {
+	Args     []string
+	Fallback Renderer
+}
+
+func (c Command) Render(ctx context.Context, file *os.File, size int64, filetype string) (image.Image, error) {
+	if filetype != utils.FiletypePDF || len(c.Args) == 0 {
+		if c.Fallback == nil {
+			return nil, ErrUnsupportedFiletype
+		}
+		return c.Fallback.Render(ctx, file, size, filetype)
+	}
+
+	dir, err := os.MkdirTemp("", "viadro-preview-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	output := filepath.Join(dir, "preview")
+	replacer := strings.NewReplacer("{input}", file.Name(), "{output}", output)
+
+	args := make([]string, len(c.Args))
+	to_file := false
+	for i, arg := range c.Args {
+		to_file = to_file || strings.Contains(arg, "{output}")
+		args[i] = replacer.Replace(arg)
+	}
+
+	stdout, stderr := bytes.Buffer{}, bytes.Buffer{}
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err = cmd.Run()
+	if err != nil {
+		return nil, fmt.Errorf("preview command failed: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	var source io.Reader = &stdout
+	if to_file {
+		written, err := filepath.Glob(output + "*")
+		if err != nil {
+			return nil, err
+		}
+		if len(written) == 0 {
+			return nil, errors.New("preview command didn't write any image")
+		}
+
+		image_file, err := os.Open(written[0])
+		if err != nil {
+			return nil, err
+		}
+		defer image_file.Close()
+
+		source = image_file
+	}
+
+	rendered, _, err := image.Decode(source)
+	if err != nil {
+		return nil, fmt.Errorf("preview command wrote unreadable image: %v", err)
+	}
+
+	return rendered, nil
+}
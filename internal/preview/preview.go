@@ -0,0 +1,61 @@
+package preview
+
+import (
+	"context"
+	"errors"
+	"image"
+	"image/png"
+	"io"
+	"os"
+
+	"golang.org/x/image/draw"
+)
+
+// Width and Height bound generated previews, they are about the proportions of A4 page.
+const (
+	Width  = 300
+	Height = 424
+)
+
+var ErrUnsupportedFiletype = errors.New("preview can't be made for this file type")
+
+// Renderer draws first page of document, file is a local copy of its blob which can be read and seeked freely.
+// Renderers are shared by all background jobs, so they have to be safe for concurrent use.
+type Renderer interface {
+	Render(ctx context.Context, file *os.File, size int64, filetype string) (image.Image, error)
+}
+
+// Generate renders preview of document with renderer and writes it into out as PNG scaled down to fit
+// within Width and Height.
+func Generate(ctx context.Context, renderer Renderer, file *os.File, size int64, filetype string, out io.Writer) error {
+	rendered, err := renderer.Render(ctx, file, size, filetype)
+	if err != nil {
+		return err
+	}
+
+	return png.Encode(out, fit(rendered))
+}
+
+// fit scales image down to fit within Width and Height keeping its proportions, smaller images are left as they are.
+func fit(source image.Image) image.Image {
+	bounds := source.Bounds()
+	if bounds.Dx() <= Width && bounds.Dy() <= Height {
+		return source
+	}
+
+	width, height := Width, bounds.Dy()*Width/bounds.Dx()
+	if height > Height {
+		width, height = bounds.Dx()*Height/bounds.Dy(), Height
+	}
+	if width < 1 {
+		width = 1
+	}
+	if height < 1 {
+		height = 1
+	}
+
+	scaled := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.ApproxBiLinear.Scale(scaled, scaled.Bounds(), source, bounds, draw.Src, nil)
+
+	return scaled
+}
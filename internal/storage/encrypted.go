@@ -0,0 +1,290 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"time"
+
+	"viadro_api/internal/envelope"
+)
+
+var (
+	ErrKeyNotFound    = errors.New("data key not found")
+	ErrNotPresignable = errors.New("encrypted object can't be linked to")
+)
+
+// KeyStore keeps wrapped data keys of encrypted objects outside of storage, so master keys can be rotated
+// without touching objects.
+type KeyStore interface {
+	SaveKey(ctx context.Context, key string, wrapped []byte, key_id string) error
+	// LoadKey returns ErrKeyNotFound for objects stored in plaintext.
+	LoadKey(ctx context.Context, key string) ([]byte, string, error)
+	DeleteKey(ctx context.Context, key string) error
+}
+
+// EncryptedStore encrypts objects of documents (keys under users/) and export archives (keys under exports/) stored
+// through another driver with envelope encryption, reads decrypt them transparently. Objects stored before encryption was enabled have no data key and
+// are read as they are. Encrypted objects can't be presigned, they have to be streamed through the API.
+type EncryptedStore struct {
+	store BlobStore
+	kms   envelope.KMS
+	keys  KeyStore
+}
+
+func NewEncryptedStore(store BlobStore, kms envelope.KMS, keys KeyStore) *EncryptedStore {
+	return &EncryptedStore{store: store, kms: kms, keys: keys}
+}
+
+// Unwrap returns the driver objects are stored through.
+func (e *EncryptedStore) Unwrap() BlobStore {
+	return e.store
+}
+
+// encrypts reports whether object is encrypted when stored.
+func (e *EncryptedStore) encrypts(key string) bool {
+	return strings.HasPrefix(key, "users/") || strings.HasPrefix(key, "exports/")
+}
+
+// dataKey returns unwrapped data key of object, nil when object is stored in plaintext.
+func (e *EncryptedStore) dataKey(ctx context.Context, key string) ([]byte, error) {
+	wrapped, key_id, err := e.keys.LoadKey(ctx, key)
+	if err != nil {
+		if errors.Is(err, ErrKeyNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return e.kms.Unwrap(ctx, wrapped, key_id)
+}
+
+func (e *EncryptedStore) Put(ctx context.Context, key string, body io.Reader, opts PutOptions) (string, error) {
+	if !e.encrypts(key) {
+		return e.store.Put(ctx, key, body, opts)
+	}
+
+	data_key, err := envelope.NewDataKey()
+	if err != nil {
+		return "", err
+	}
+
+	wrapped, key_id, err := e.kms.Wrap(ctx, data_key)
+	if err != nil {
+		return "", err
+	}
+
+	//? key goes first, an object without it would be read as plaintext
+	err = e.keys.SaveKey(ctx, key, wrapped, key_id)
+	if err != nil {
+		return "", err
+	}
+
+	sealed, err := envelope.NewEncrypter(body, data_key)
+	if err != nil {
+		return "", err
+	}
+
+	location, err := e.store.Put(ctx, key, sealed, opts)
+	if err != nil {
+		_ = e.keys.DeleteKey(ctx, key)
+		return "", err
+	}
+
+	return location, nil
+}
+
+func (e *EncryptedStore) Get(ctx context.Context, key string) (io.ReadCloser, *ObjectInfo, error) {
+	data_key, err := e.dataKey(ctx, key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	body, info, err := e.store.Get(ctx, key)
+	if err != nil || data_key == nil {
+		return body, info, err
+	}
+
+	plain, err := envelope.NewDecrypter(body, data_key, 0, envelope.TotalChunks(info.Size), 0)
+	if err != nil {
+		body.Close()
+		return nil, nil, err
+	}
+	info.Size = envelope.PlainSize(info.Size)
+
+	return readCloser{Reader: plain, Closer: body}, info, nil
+}
+
+func (e *EncryptedStore) GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	data_key, err := e.dataKey(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if data_key == nil {
+		return e.store.GetRange(ctx, key, offset, length)
+	}
+
+	//? position of the last chunk has to be known to decrypt it
+	info, err := e.store.Stat(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	first_chunk, sealed_offset, sealed_length, skip := envelope.SealedRange(offset, length)
+	body, err := e.store.GetRange(ctx, key, sealed_offset, sealed_length)
+	if err != nil {
+		return nil, err
+	}
+
+	plain, err := envelope.NewDecrypter(body, data_key, first_chunk, envelope.TotalChunks(info.Size), skip)
+	if err != nil {
+		body.Close()
+		return nil, err
+	}
+
+	return readCloser{Reader: io.LimitReader(plain, length), Closer: body}, nil
+}
+
+// Copy shares data key of source with the copy, content of both is the same.
+func (e *EncryptedStore) Copy(ctx context.Context, src_key, dst_key string, opts PutOptions) (string, error) {
+	wrapped, key_id, err := e.keys.LoadKey(ctx, src_key)
+	switch {
+	case err == nil:
+		err = e.keys.SaveKey(ctx, dst_key, wrapped, key_id)
+		if err != nil {
+			return "", err
+		}
+	case !errors.Is(err, ErrKeyNotFound):
+		return "", err
+	}
+
+	return e.store.Copy(ctx, src_key, dst_key, opts)
+}
+
+// Delete removes object before its data key, failure can't leave behind an object which can't be decrypted.
+func (e *EncryptedStore) Delete(ctx context.Context, key string) error {
+	err := e.store.Delete(ctx, key)
+	if err != nil && !errors.Is(err, ErrObjectNotFound) {
+		return err
+	}
+
+	key_err := e.keys.DeleteKey(ctx, key)
+	if key_err != nil && !errors.Is(key_err, ErrKeyNotFound) {
+		return key_err
+	}
+
+	return err
+}
+
+func (e *EncryptedStore) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	info, err := e.store.Stat(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	_, _, err = e.keys.LoadKey(ctx, key)
+	switch {
+	case err == nil:
+		info.Size = envelope.PlainSize(info.Size)
+	case !errors.Is(err, ErrKeyNotFound):
+		return nil, err
+	}
+
+	return info, nil
+}
+
+// PresignGet returns ErrNotPresignable for encrypted objects, link would serve them encrypted.
+func (e *EncryptedStore) PresignGet(ctx context.Context, key string, ttl time.Duration, opts PresignOptions) (string, error) {
+	_, _, err := e.keys.LoadKey(ctx, key)
+	switch {
+	case err == nil:
+		return "", ErrNotPresignable
+	case !errors.Is(err, ErrKeyNotFound):
+		return "", err
+	}
+
+	return e.store.PresignGet(ctx, key, ttl, opts)
+}
+
+func (e *EncryptedStore) multipartStore() (MultipartStore, error) {
+	multipart_store, ok := e.store.(MultipartStore)
+	if !ok {
+		return nil, errors.New("storage driver does not support resumable uploads")
+	}
+
+	return multipart_store, nil
+}
+
+// stagingKey names object parts of encrypted object are assembled into before it's encrypted as a whole.
+func (e *EncryptedStore) stagingKey(key string) string {
+	if !e.encrypts(key) {
+		return key
+	}
+
+	return "uploads/" + key
+}
+
+func (e *EncryptedStore) CreateMultipart(ctx context.Context, key string, opts PutOptions) (string, error) {
+	multipart_store, err := e.multipartStore()
+	if err != nil {
+		return "", err
+	}
+
+	return multipart_store.CreateMultipart(ctx, e.stagingKey(key), opts)
+}
+
+// UploadPart seals every part of encrypted object with a data key of its own before it's staged, so parts never
+// reach storage in plaintext. Retried parts get a new key, nonces are never reused.
+func (e *EncryptedStore) UploadPart(ctx context.Context, key, upload_id string, part_number int32, body io.ReadSeeker, size int64) (string, error) {
+	multipart_store, err := e.multipartStore()
+	if err != nil {
+		return "", err
+	}
+
+	if !e.encrypts(key) {
+		return multipart_store.UploadPart(ctx, key, upload_id, part_number, body, size)
+	}
+
+	segment, err := envelope.SealSegment(ctx, e.kms, body, size)
+	if err != nil {
+		return "", err
+	}
+
+	return multipart_store.UploadPart(ctx, e.stagingKey(key), upload_id, part_number, bytes.NewReader(segment), int64(len(segment)))
+}
+
+// CompleteMultipart assembles sealed parts and stores their plaintext encrypted under key, chunks of the object are
+// counted from its beginning so it has to be encrypted as a whole once all parts are known.
+func (e *EncryptedStore) CompleteMultipart(ctx context.Context, key, upload_id string, parts []CompletedPart) (string, error) {
+	multipart_store, err := e.multipartStore()
+	if err != nil {
+		return "", err
+	}
+
+	staging_key := e.stagingKey(key)
+
+	location, err := multipart_store.CompleteMultipart(ctx, staging_key, upload_id, parts)
+	if err != nil || staging_key == key {
+		return location, err
+	}
+	defer e.store.Delete(ctx, staging_key)
+
+	body, info, err := e.store.Get(ctx, staging_key)
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+
+	return e.Put(ctx, key, envelope.OpenSegments(ctx, e.kms, body), PutOptions{Content_type: info.Content_type, Content_disposition: info.Content_disposition})
+}
+
+func (e *EncryptedStore) AbortMultipart(ctx context.Context, key, upload_id string) error {
+	multipart_store, err := e.multipartStore()
+	if err != nil {
+		return err
+	}
+
+	return multipart_store.AbortMultipart(ctx, e.stagingKey(key), upload_id)
+}
@@ -0,0 +1,259 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"viadro_api/internal/envelope"
+)
+
+type memoryKey struct {
+	wrapped []byte
+	key_id  string
+}
+
+type memoryKeyStore struct {
+	mu   sync.Mutex
+	keys map[string]memoryKey
+}
+
+func (m *memoryKeyStore) SaveKey(ctx context.Context, key string, wrapped []byte, key_id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.keys[key] = memoryKey{wrapped: wrapped, key_id: key_id}
+	return nil
+}
+
+func (m *memoryKeyStore) LoadKey(ctx context.Context, key string) ([]byte, string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.keys[key]
+	if !ok {
+		return nil, "", ErrKeyNotFound
+	}
+	return stored.wrapped, stored.key_id, nil
+}
+
+func (m *memoryKeyStore) DeleteKey(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, ok := m.keys[key]
+	if !ok {
+		return ErrKeyNotFound
+	}
+	delete(m.keys, key)
+	return nil
+}
+
+func newTestEncryptedStore(t *testing.T) (*EncryptedStore, *MemoryStore) {
+	t.Helper()
+
+	master_key, err := envelope.NewDataKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyring, err := envelope.NewMasterKeyring(base64.StdEncoding.EncodeToString(master_key), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	memory_store := newTestMemoryStore(t, nil)
+
+	return NewEncryptedStore(memory_store, keyring, &memoryKeyStore{keys: map[string]memoryKey{}}), memory_store
+}
+
+func randomContent(t *testing.T, size int) []byte {
+	t.Helper()
+
+	content := make([]byte, size)
+	_, err := rand.Read(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return content
+}
+
+func TestEncryptedGetRange(t *testing.T) {
+	e, memory_store := newTestEncryptedStore(t)
+
+	key := "users/1/document"
+	plain := randomContent(t, 3*envelope.ChunkSize+100)
+
+	_, err := e.Put(context.Background(), key, bytes.NewReader(plain), PutOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	raw, _, err := memory_store.Get(context.Background(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored, err := io.ReadAll(raw)
+	raw.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(stored, plain[:envelope.ChunkSize]) {
+		t.Fatal("object is stored in plaintext")
+	}
+
+	info, err := e.Stat(context.Background(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size != int64(len(plain)) {
+		t.Fatalf("size = %d, want %d", info.Size, len(plain))
+	}
+
+	tests := []struct {
+		name   string
+		offset int64
+		length int64
+	}{
+		{name: "whole object", offset: 0, length: int64(len(plain))},
+		{name: "end of first chunk", offset: envelope.ChunkSize - 3, length: 3},
+		{name: "across boundary", offset: envelope.ChunkSize - 3, length: 6},
+		{name: "start of second chunk", offset: envelope.ChunkSize, length: 1},
+		{name: "whole middle chunk", offset: 2 * envelope.ChunkSize, length: envelope.ChunkSize},
+		{name: "into last chunk", offset: 3*envelope.ChunkSize - 1, length: 101},
+		{name: "last byte", offset: int64(len(plain)) - 1, length: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, err := e.GetRange(context.Background(), key, tt.offset, tt.length)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer body.Close()
+
+			got, err := io.ReadAll(body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, plain[tt.offset:tt.offset+tt.length]) {
+				t.Fatalf("range of %d bytes at %d differs from plaintext", tt.length, tt.offset)
+			}
+		})
+	}
+}
+
+func TestEncryptedKeys(t *testing.T) {
+	e, memory_store := newTestEncryptedStore(t)
+
+	tests := []struct {
+		name      string
+		key       string
+		encrypted bool
+	}{
+		{name: "document", key: "users/1/document", encrypted: true},
+		{name: "export archive", key: "exports/1/archive.zip", encrypted: true},
+		{name: "other object", key: "other/object", encrypted: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plain := []byte("content of " + tt.key)
+
+			_, err := e.Put(context.Background(), tt.key, bytes.NewReader(plain), PutOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			info, err := memory_store.Stat(context.Background(), tt.key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if encrypted := info.Size != int64(len(plain)); encrypted != tt.encrypted {
+				t.Fatalf("encrypted = %v, want %v", encrypted, tt.encrypted)
+			}
+
+			_, err = e.PresignGet(context.Background(), tt.key, time.Minute, PresignOptions{})
+			if presignable := !errors.Is(err, ErrNotPresignable); presignable == tt.encrypted {
+				t.Fatalf("presign err = %v", err)
+			}
+
+			body, _, err := e.Get(context.Background(), tt.key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := io.ReadAll(body)
+			body.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, plain) {
+				t.Fatalf("read %q, want %q", got, plain)
+			}
+		})
+	}
+}
+
+func TestEncryptedMultipart(t *testing.T) {
+	e, memory_store := newTestEncryptedStore(t)
+
+	key := "users/1/upload"
+	parts := [][]byte{randomContent(t, envelope.ChunkSize+1), randomContent(t, envelope.ChunkSize-1), randomContent(t, 10)}
+
+	upload_id, err := e.CreateMultipart(context.Background(), key, PutOptions{Content_type: "application/pdf"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	completed := []CompletedPart{}
+	for i, part := range parts {
+		part_number := int32(i + 1)
+
+		etag, err := e.UploadPart(context.Background(), key, upload_id, part_number, bytes.NewReader(part), int64(len(part)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		completed = append(completed, CompletedPart{Part_number: part_number, ETag: etag})
+
+		memory_store.mu.RLock()
+		staged := memory_store.uploads[upload_id].parts[part_number]
+		memory_store.mu.RUnlock()
+		if bytes.Contains(staged, part) {
+			t.Fatalf("part %d is staged in plaintext", part_number)
+		}
+	}
+
+	_, err = e.CompleteMultipart(context.Background(), key, upload_id, completed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = memory_store.Stat(context.Background(), e.stagingKey(key))
+	if !errors.Is(err, ErrObjectNotFound) {
+		t.Fatalf("staged object left behind: %v", err)
+	}
+
+	body, info, err := e.Get(context.Background(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer body.Close()
+
+	got, err := io.ReadAll(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, bytes.Join(parts, nil)) {
+		t.Fatal("assembled object differs from uploaded parts")
+	}
+	if info.Content_type != "application/pdf" {
+		t.Fatalf("content type = %q", info.Content_type)
+	}
+}
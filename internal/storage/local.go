@@ -0,0 +1,351 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// LocalStore keeps blobs on the local filesystem, metadata is kept in a parallel tree of JSON files.
+type LocalStore struct {
+	root   string
+	signer signer
+}
+
+type localMetadata struct {
+	Content_type        string `json:"content_type"`
+	Content_disposition string `json:"content_disposition"`
+}
+
+type localUpload struct {
+	Key      string        `json:"key"`
+	Metadata localMetadata `json:"metadata"`
+}
+
+func NewLocalStore(root, base_url, secret string) (*LocalStore, error) {
+	if root == "" {
+		return nil, errors.New("local storage requires a root directory")
+	}
+
+	link_signer, err := newSigner(base_url, secret)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, dir := range []string{"blobs", "meta", "uploads"} {
+		err = os.MkdirAll(filepath.Join(root, dir), 0o750)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &LocalStore{root: root, signer: link_signer}, nil
+}
+
+func (l *LocalStore) paths(key string) (string, string, error) {
+	key, err := cleanKey(key)
+	if err != nil {
+		return "", "", err
+	}
+
+	blob_path := filepath.Join(l.root, "blobs", filepath.FromSlash(key))
+	meta_path := filepath.Join(l.root, "meta", filepath.FromSlash(key)+".json")
+
+	return blob_path, meta_path, nil
+}
+
+// writeAtomic writes to a temporary file first, so readers never observe partially written blobs.
+func writeAtomic(target string, body io.Reader) error {
+	err := os.MkdirAll(filepath.Dir(target), 0o750)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(target), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = io.Copy(tmp, body)
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+
+	err = tmp.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), target)
+}
+
+func (l *LocalStore) Put(ctx context.Context, key string, body io.Reader, opts PutOptions) (string, error) {
+	blob_path, meta_path, err := l.paths(key)
+	if err != nil {
+		return "", err
+	}
+
+	err = writeAtomic(blob_path, body)
+	if err != nil {
+		return "", err
+	}
+
+	metadata, err := json.Marshal(localMetadata{Content_type: opts.Content_type, Content_disposition: opts.Content_disposition})
+	if err != nil {
+		return "", err
+	}
+
+	err = writeAtomic(meta_path, bytes.NewReader(metadata))
+	if err != nil {
+		return "", err
+	}
+
+	return l.signer.location(key), nil
+}
+
+func (l *LocalStore) Copy(ctx context.Context, src_key, dst_key string, opts PutOptions) (string, error) {
+	src, _, err := l.open(src_key)
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+
+	return l.Put(ctx, dst_key, src, opts)
+}
+
+func (l *LocalStore) open(key string) (io.ReadSeekCloser, *ObjectInfo, error) {
+	info, err := l.Stat(context.Background(), key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	blob_path, _, err := l.paths(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	file, err := os.Open(blob_path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil, ErrObjectNotFound
+		}
+		return nil, nil, err
+	}
+
+	return file, info, nil
+}
+
+func (l *LocalStore) Get(ctx context.Context, key string) (io.ReadCloser, *ObjectInfo, error) {
+	return l.open(key)
+}
+
+func (l *LocalStore) GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	blob, _, err := l.open(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return sectionOf(blob, offset, length)
+}
+
+func (l *LocalStore) Delete(ctx context.Context, key string) error {
+	blob_path, meta_path, err := l.paths(key)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range []string{blob_path, meta_path} {
+		err = os.Remove(p)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (l *LocalStore) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	blob_path, meta_path, err := l.paths(key)
+	if err != nil {
+		return nil, err
+	}
+
+	stat, err := os.Stat(blob_path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, ErrObjectNotFound
+		}
+		return nil, err
+	}
+
+	metadata := localMetadata{}
+	raw, err := os.ReadFile(meta_path)
+	if err == nil {
+		err = json.Unmarshal(raw, &metadata)
+	}
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	info := &ObjectInfo{
+		Key:                 key,
+		Size:                stat.Size(),
+		Content_type:        metadata.Content_type,
+		Content_disposition: metadata.Content_disposition,
+		Last_modified:       stat.ModTime(),
+	}
+
+	return info, nil
+}
+
+func (l *LocalStore) PresignGet(ctx context.Context, key string, ttl time.Duration, opts PresignOptions) (string, error) {
+	key, err := cleanKey(key)
+	if err != nil {
+		return "", err
+	}
+
+	return l.signer.presign(key, ttl, opts), nil
+}
+
+func (l *LocalStore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	serveBlob(w, r, l.signer, l.open)
+}
+
+func (l *LocalStore) uploadDir(upload_id string) (string, error) {
+	_, err := hex.DecodeString(upload_id)
+	if err != nil || upload_id == "" {
+		return "", ErrUploadNotFound
+	}
+
+	dir := filepath.Join(l.root, "uploads", upload_id)
+	_, err = os.Stat(dir)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return "", ErrUploadNotFound
+		}
+		return "", err
+	}
+
+	return dir, nil
+}
+
+func (l *LocalStore) CreateMultipart(ctx context.Context, key string, opts PutOptions) (string, error) {
+	key, err := cleanKey(key)
+	if err != nil {
+		return "", err
+	}
+
+	random_bytes := make([]byte, 16)
+	_, err = rand.Read(random_bytes)
+	if err != nil {
+		return "", err
+	}
+	upload_id := hex.EncodeToString(random_bytes)
+
+	upload, err := json.Marshal(localUpload{
+		Key:      key,
+		Metadata: localMetadata{Content_type: opts.Content_type, Content_disposition: opts.Content_disposition},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	err = writeAtomic(filepath.Join(l.root, "uploads", upload_id, "upload.json"), bytes.NewReader(upload))
+	if err != nil {
+		return "", err
+	}
+
+	return upload_id, nil
+}
+
+func (l *LocalStore) UploadPart(ctx context.Context, key, upload_id string, part_number int32, body io.ReadSeeker, size int64) (string, error) {
+	dir, err := l.uploadDir(upload_id)
+	if err != nil {
+		return "", err
+	}
+
+	hash := md5.New()
+	err = writeAtomic(filepath.Join(dir, strconv.Itoa(int(part_number))), io.TeeReader(body, hash))
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func (l *LocalStore) CompleteMultipart(ctx context.Context, key, upload_id string, parts []CompletedPart) (string, error) {
+	dir, err := l.uploadDir(upload_id)
+	if err != nil {
+		return "", err
+	}
+
+	raw, err := os.ReadFile(filepath.Join(dir, "upload.json"))
+	if err != nil {
+		return "", err
+	}
+	upload := localUpload{}
+	err = json.Unmarshal(raw, &upload)
+	if err != nil {
+		return "", err
+	}
+
+	readers := []io.Reader{}
+	for _, part := range parts {
+		file, err := os.Open(filepath.Join(dir, strconv.Itoa(int(part.Part_number))))
+		if err != nil {
+			return "", err
+		}
+		defer file.Close()
+
+		readers = append(readers, file)
+	}
+
+	blob_path, meta_path, err := l.paths(upload.Key)
+	if err != nil {
+		return "", err
+	}
+
+	err = writeAtomic(blob_path, io.MultiReader(readers...))
+	if err != nil {
+		return "", err
+	}
+
+	metadata, err := json.Marshal(upload.Metadata)
+	if err != nil {
+		return "", err
+	}
+
+	err = writeAtomic(meta_path, bytes.NewReader(metadata))
+	if err != nil {
+		return "", err
+	}
+
+	err = os.RemoveAll(dir)
+	if err != nil {
+		return "", err
+	}
+
+	return l.signer.location(upload.Key), nil
+}
+
+func (l *LocalStore) AbortMultipart(ctx context.Context, key, upload_id string) error {
+	dir, err := l.uploadDir(upload_id)
+	if err != nil {
+		return err
+	}
+
+	return os.RemoveAll(dir)
+}
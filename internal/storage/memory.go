@@ -0,0 +1,233 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps blobs in process memory, useful for development and tests, everything is lost on restart.
+type MemoryStore struct {
+	mu      sync.RWMutex
+	objects map[string]memoryObject
+	uploads map[string]*memoryUpload
+	signer  signer
+}
+
+type memoryUpload struct {
+	key   string
+	opts  PutOptions
+	parts map[int32][]byte
+}
+
+type memoryObject struct {
+	data []byte
+	info ObjectInfo
+}
+
+type nopSeekCloser struct {
+	*bytes.Reader
+}
+
+func (nopSeekCloser) Close() error {
+	return nil
+}
+
+func bytesReader(b []byte) nopSeekCloser {
+	return nopSeekCloser{bytes.NewReader(b)}
+}
+
+func NewMemoryStore(base_url, secret string) (*MemoryStore, error) {
+	link_signer, err := newSigner(base_url, secret)
+	if err != nil {
+		return nil, err
+	}
+
+	return &MemoryStore{
+		objects: make(map[string]memoryObject),
+		uploads: make(map[string]*memoryUpload),
+		signer:  link_signer,
+	}, nil
+}
+
+func (m *MemoryStore) Put(ctx context.Context, key string, body io.Reader, opts PutOptions) (string, error) {
+	key, err := cleanKey(key)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return "", err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.objects[key] = memoryObject{
+		data: data,
+		info: ObjectInfo{
+			Key:                 key,
+			Size:                int64(len(data)),
+			Content_type:        opts.Content_type,
+			Content_disposition: opts.Content_disposition,
+			Last_modified:       time.Now(),
+		},
+	}
+
+	return m.signer.location(key), nil
+}
+
+func (m *MemoryStore) Copy(ctx context.Context, src_key, dst_key string, opts PutOptions) (string, error) {
+	src, _, err := m.open(src_key)
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+
+	return m.Put(ctx, dst_key, src, opts)
+}
+
+func (m *MemoryStore) open(key string) (io.ReadSeekCloser, *ObjectInfo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	object, ok := m.objects[key]
+	if !ok {
+		return nil, nil, ErrObjectNotFound
+	}
+
+	info := object.info
+	return bytesReader(object.data), &info, nil
+}
+
+func (m *MemoryStore) Get(ctx context.Context, key string) (io.ReadCloser, *ObjectInfo, error) {
+	return m.open(key)
+}
+
+func (m *MemoryStore) GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	blob, _, err := m.open(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return sectionOf(blob, offset, length)
+}
+
+func (m *MemoryStore) Delete(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.objects, key)
+
+	return nil
+}
+
+func (m *MemoryStore) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	object, ok := m.objects[key]
+	if !ok {
+		return nil, ErrObjectNotFound
+	}
+
+	info := object.info
+	return &info, nil
+}
+
+func (m *MemoryStore) PresignGet(ctx context.Context, key string, ttl time.Duration, opts PresignOptions) (string, error) {
+	key, err := cleanKey(key)
+	if err != nil {
+		return "", err
+	}
+
+	return m.signer.presign(key, ttl, opts), nil
+}
+
+func (m *MemoryStore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	serveBlob(w, r, m.signer, m.open)
+}
+
+func (m *MemoryStore) CreateMultipart(ctx context.Context, key string, opts PutOptions) (string, error) {
+	key, err := cleanKey(key)
+	if err != nil {
+		return "", err
+	}
+
+	random_bytes := make([]byte, 16)
+	_, err = rand.Read(random_bytes)
+	if err != nil {
+		return "", err
+	}
+	upload_id := hex.EncodeToString(random_bytes)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.uploads[upload_id] = &memoryUpload{key: key, opts: opts, parts: make(map[int32][]byte)}
+
+	return upload_id, nil
+}
+
+func (m *MemoryStore) UploadPart(ctx context.Context, key, upload_id string, part_number int32, body io.ReadSeeker, size int64) (string, error) {
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return "", err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	upload, ok := m.uploads[upload_id]
+	if !ok {
+		return "", ErrUploadNotFound
+	}
+	upload.parts[part_number] = data
+
+	hash := md5.Sum(data)
+	return hex.EncodeToString(hash[:]), nil
+}
+
+func (m *MemoryStore) CompleteMultipart(ctx context.Context, key, upload_id string, parts []CompletedPart) (string, error) {
+	m.mu.Lock()
+	upload, ok := m.uploads[upload_id]
+	if !ok {
+		m.mu.Unlock()
+		return "", ErrUploadNotFound
+	}
+
+	blob := bytes.Buffer{}
+	for _, part := range parts {
+		data, ok := upload.parts[part.Part_number]
+		if !ok {
+			m.mu.Unlock()
+			return "", fmt.Errorf("missing part %d", part.Part_number)
+		}
+		blob.Write(data)
+	}
+	delete(m.uploads, upload_id)
+	m.mu.Unlock()
+
+	return m.Put(ctx, upload.key, &blob, upload.opts)
+}
+
+func (m *MemoryStore) AbortMultipart(ctx context.Context, key, upload_id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, ok := m.uploads[upload_id]
+	if !ok {
+		return ErrUploadNotFound
+	}
+	delete(m.uploads, upload_id)
+
+	return nil
+}
@@ -0,0 +1,243 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+type S3Store struct {
+	client *s3.Client
+	bucket string
+	region string
+}
+
+func NewS3Store(client *s3.Client, bucket, region string) *S3Store {
+	return &S3Store{client: client, bucket: bucket, region: region}
+}
+
+func (s *S3Store) location(key string) string {
+	return fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", s.bucket, s.region, (&url.URL{Path: key}).EscapedPath())
+}
+
+func isS3NotFound(err error) bool {
+	var no_such_key *types.NoSuchKey
+	var not_found *types.NotFound
+
+	return errors.As(err, &no_such_key) || errors.As(err, &not_found)
+}
+
+func (s *S3Store) Put(ctx context.Context, key string, body io.Reader, opts PutOptions) (string, error) {
+	uploader := manager.NewUploader(s.client)
+	res, err := uploader.Upload(ctx, &s3.PutObjectInput{
+		Bucket:             aws.String(s.bucket),
+		Key:                aws.String(key),
+		Body:               body,
+		ContentDisposition: aws.String(opts.Content_disposition),
+		ContentType:        aws.String(opts.Content_type),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return res.Location, nil
+}
+
+func (s *S3Store) Get(ctx context.Context, key string) (io.ReadCloser, *ObjectInfo, error) {
+	res, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		if isS3NotFound(err) {
+			return nil, nil, ErrObjectNotFound
+		}
+		return nil, nil, err
+	}
+
+	info := &ObjectInfo{
+		Key:                 key,
+		Size:                res.ContentLength,
+		Content_type:        aws.ToString(res.ContentType),
+		Content_disposition: aws.ToString(res.ContentDisposition),
+		Last_modified:       aws.ToTime(res.LastModified),
+	}
+
+	return res.Body, info, nil
+}
+
+func (s *S3Store) GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	res, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+		Range:  aws.String(fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)),
+	})
+	if err != nil {
+		if isS3NotFound(err) {
+			return nil, ErrObjectNotFound
+		}
+		return nil, err
+	}
+
+	return res.Body, nil
+}
+
+func (s *S3Store) Copy(ctx context.Context, src_key, dst_key string, opts PutOptions) (string, error) {
+	_, err := s.client.CopyObject(ctx, &s3.CopyObjectInput{
+		Bucket:             aws.String(s.bucket),
+		Key:                aws.String(dst_key),
+		CopySource:         aws.String((&url.URL{Path: s.bucket + "/" + src_key}).EscapedPath()),
+		MetadataDirective:  types.MetadataDirectiveReplace,
+		ContentDisposition: aws.String(opts.Content_disposition),
+		ContentType:        aws.String(opts.Content_type),
+	})
+	if err != nil {
+		if isS3NotFound(err) {
+			return "", ErrObjectNotFound
+		}
+		return "", err
+	}
+
+	return s.location(dst_key), nil
+}
+
+func (s *S3Store) Delete(ctx context.Context, key string) error {
+	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *S3Store) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	res, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		if isS3NotFound(err) {
+			return nil, ErrObjectNotFound
+		}
+		return nil, err
+	}
+
+	info := &ObjectInfo{
+		Key:                 key,
+		Size:                res.ContentLength,
+		Content_type:        aws.ToString(res.ContentType),
+		Content_disposition: aws.ToString(res.ContentDisposition),
+		Last_modified:       aws.ToTime(res.LastModified),
+	}
+
+	return info, nil
+}
+
+func (s *S3Store) PresignGet(ctx context.Context, key string, ttl time.Duration, opts PresignOptions) (string, error) {
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	}
+	if opts.Content_type != "" {
+		input.ResponseContentType = aws.String(opts.Content_type)
+	}
+	if opts.Content_disposition != "" {
+		input.ResponseContentDisposition = aws.String(opts.Content_disposition)
+	}
+
+	presign_client := s3.NewPresignClient(s.client)
+	req, err := presign_client.PresignGetObject(ctx, input, s3.WithPresignExpires(ttl))
+	if err != nil {
+		return "", err
+	}
+
+	return req.URL, nil
+}
+
+func (s *S3Store) CreateMultipart(ctx context.Context, key string, opts PutOptions) (string, error) {
+	res, err := s.client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+		Bucket:             aws.String(s.bucket),
+		Key:                aws.String(key),
+		ContentDisposition: aws.String(opts.Content_disposition),
+		ContentType:        aws.String(opts.Content_type),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return aws.ToString(res.UploadId), nil
+}
+
+func (s *S3Store) UploadPart(ctx context.Context, key, upload_id string, part_number int32, body io.ReadSeeker, size int64) (string, error) {
+	res, err := s.client.UploadPart(ctx, &s3.UploadPartInput{
+		Bucket:        aws.String(s.bucket),
+		Key:           aws.String(key),
+		UploadId:      aws.String(upload_id),
+		PartNumber:    part_number,
+		Body:          body,
+		ContentLength: size,
+	})
+	if err != nil {
+		var no_such_upload *types.NoSuchUpload
+		if errors.As(err, &no_such_upload) {
+			return "", ErrUploadNotFound
+		}
+		return "", err
+	}
+
+	return aws.ToString(res.ETag), nil
+}
+
+func (s *S3Store) CompleteMultipart(ctx context.Context, key, upload_id string, parts []CompletedPart) (string, error) {
+	completed_parts := make([]types.CompletedPart, 0, len(parts))
+	for _, part := range parts {
+		completed_parts = append(completed_parts, types.CompletedPart{
+			PartNumber: part.Part_number,
+			ETag:       aws.String(part.ETag),
+		})
+	}
+
+	res, err := s.client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(s.bucket),
+		Key:             aws.String(key),
+		UploadId:        aws.String(upload_id),
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: completed_parts},
+	})
+	if err != nil {
+		var no_such_upload *types.NoSuchUpload
+		if errors.As(err, &no_such_upload) {
+			return "", ErrUploadNotFound
+		}
+		return "", err
+	}
+
+	return aws.ToString(res.Location), nil
+}
+
+func (s *S3Store) AbortMultipart(ctx context.Context, key, upload_id string) error {
+	_, err := s.client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(s.bucket),
+		Key:      aws.String(key),
+		UploadId: aws.String(upload_id),
+	})
+	if err != nil {
+		var no_such_upload *types.NoSuchUpload
+		if errors.As(err, &no_such_upload) {
+			return ErrUploadNotFound
+		}
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,311 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrObjectNotFound   = errors.New("object not found")
+	ErrInvalidKey       = errors.New("invalid object key")
+	ErrInvalidSignature = errors.New("invalid or expired signature")
+	ErrUploadNotFound   = errors.New("multipart upload not found")
+	ErrWeakSecret       = fmt.Errorf("signing secret must be at least %d bytes", MinSecretSize)
+)
+
+// MinSecretSize is the minimum length of secret presigned links are signed with, shorter ones could be guessed.
+const MinSecretSize = 32
+
+type PutOptions struct {
+	Content_type        string
+	Content_disposition string
+}
+
+// PresignOptions override headers of the response served through presigned link, so blob shared
+// by many documents is downloaded under each document's own name.
+type PresignOptions struct {
+	Content_type        string
+	Content_disposition string
+}
+
+type ObjectInfo struct {
+	Key                 string
+	Size                int64
+	Content_type        string
+	Content_disposition string
+	Last_modified       time.Time
+}
+
+// BlobStore is implemented by every storage driver, handlers should only talk to documents' blobs through it.
+type BlobStore interface {
+	Put(ctx context.Context, key string, body io.Reader, opts PutOptions) (string, error)
+	Get(ctx context.Context, key string) (io.ReadCloser, *ObjectInfo, error)
+	GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error)
+	Copy(ctx context.Context, src_key, dst_key string, opts PutOptions) (string, error)
+	Delete(ctx context.Context, key string) error
+	Stat(ctx context.Context, key string) (*ObjectInfo, error)
+	PresignGet(ctx context.Context, key string, ttl time.Duration, opts PresignOptions) (string, error)
+}
+
+type CompletedPart struct {
+	Part_number int32
+	ETag        string
+}
+
+// MultipartStore is implemented by drivers able to assemble a blob from separately uploaded parts,
+// used by resumable uploads.
+type MultipartStore interface {
+	CreateMultipart(ctx context.Context, key string, opts PutOptions) (string, error)
+	UploadPart(ctx context.Context, key, upload_id string, part_number int32, body io.ReadSeeker, size int64) (string, error)
+	CompleteMultipart(ctx context.Context, key, upload_id string, parts []CompletedPart) (string, error)
+	AbortMultipart(ctx context.Context, key, upload_id string) error
+}
+
+// NewKey generates opaque, collision-free key for blob owned by given user, in the form of users/<id>/<uuid>.
+func NewKey(user_id int) (string, error) {
+	uuid, err := newUUID()
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("users/%d/%s", user_id, uuid), nil
+}
+
+// NewExportKey generates key for export archive of given user, archives are kept apart from documents' blobs
+// under exports/ prefix, so they can be also expired with bucket's lifecycle rule.
+func NewExportKey(user_id int) (string, error) {
+	uuid, err := newUUID()
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("exports/%d/%s.zip", user_id, uuid), nil
+}
+
+// PreviewKey returns key of preview image of given blob, it is kept next to the blob and shared by
+// all documents pointing at it.
+func PreviewKey(blob_key string) string {
+	return blob_key + ".preview.png"
+}
+
+func newUUID() (string, error) {
+	uuid := make([]byte, 16)
+	_, err := rand.Read(uuid)
+	if err != nil {
+		return "", err
+	}
+
+	//? random (version 4) UUID, RFC 4122 variant
+	uuid[6] = (uuid[6] & 0x0f) | 0x40
+	uuid[8] = (uuid[8] & 0x3f) | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", uuid[0:4], uuid[4:6], uuid[6:8], uuid[8:10], uuid[10:16]), nil
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// sectionOf limits blob opened for reading to length bytes starting at offset.
+func sectionOf(blob io.ReadSeekCloser, offset, length int64) (io.ReadCloser, error) {
+	_, err := blob.Seek(offset, io.SeekStart)
+	if err != nil {
+		blob.Close()
+		return nil, err
+	}
+
+	return readCloser{Reader: io.LimitReader(blob, length), Closer: blob}, nil
+}
+
+// RangeReader lets blob of known size be read at arbitrary offsets, every seek which moves away from
+// current position starts a new ranged read, so serving a range never downloads the whole blob.
+type RangeReader struct {
+	ctx    context.Context
+	store  BlobStore
+	key    string
+	size   int64
+	offset int64
+	body   io.ReadCloser
+}
+
+func NewRangeReader(ctx context.Context, store BlobStore, key string, size int64) *RangeReader {
+	return &RangeReader{ctx: ctx, store: store, key: key, size: size}
+}
+
+func (r *RangeReader) Read(p []byte) (int, error) {
+	if r.offset >= r.size {
+		return 0, io.EOF
+	}
+
+	if r.body == nil {
+		body, err := r.store.GetRange(r.ctx, r.key, r.offset, r.size-r.offset)
+		if err != nil {
+			return 0, err
+		}
+		r.body = body
+	}
+
+	n, err := r.body.Read(p)
+	r.offset += int64(n)
+	if errors.Is(err, io.EOF) && r.offset < r.size {
+		err = io.ErrUnexpectedEOF
+	}
+
+	return n, err
+}
+
+func (r *RangeReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.size
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+
+	if offset != r.offset {
+		r.Close()
+		r.offset = offset
+	}
+
+	return offset, nil
+}
+
+func (r *RangeReader) Close() error {
+	if r.body == nil {
+		return nil
+	}
+
+	err := r.body.Close()
+	r.body = nil
+
+	return err
+}
+
+func cleanKey(key string) (string, error) {
+	cleaned := path.Clean("/" + key)[1:]
+	if cleaned == "" || cleaned != key || strings.Contains(key, "\\") {
+		return "", ErrInvalidKey
+	}
+
+	return cleaned, nil
+}
+
+// signer builds and verifies links to blobs for drivers which are served by the API itself (local, memory).
+type signer struct {
+	base_url string
+	secret   []byte
+}
+
+func newSigner(base_url, secret string) (signer, error) {
+	if len(secret) < MinSecretSize {
+		return signer{}, ErrWeakSecret
+	}
+
+	return signer{base_url: base_url, secret: []byte(secret)}, nil
+}
+
+func (s signer) location(key string) string {
+	return strings.TrimSuffix(s.base_url, "/") + "/" + (&url.URL{Path: key}).EscapedPath()
+}
+
+func (s signer) signature(key string, expires int64, opts PresignOptions) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(key + "\n" + strconv.FormatInt(expires, 10) + "\n" + opts.Content_type + "\n" + opts.Content_disposition))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (s signer) presign(key string, ttl time.Duration, opts PresignOptions) string {
+	expires := time.Now().Add(ttl).Unix()
+
+	qs := url.Values{}
+	qs.Set("expires", strconv.FormatInt(expires, 10))
+	if opts.Content_type != "" {
+		qs.Set("response-content-type", opts.Content_type)
+	}
+	if opts.Content_disposition != "" {
+		qs.Set("response-content-disposition", opts.Content_disposition)
+	}
+	qs.Set("signature", s.signature(key, expires, opts))
+
+	return s.location(key) + "?" + qs.Encode()
+}
+
+// verify checks link signature and returns response overrides it was signed with.
+func (s signer) verify(key string, qs url.Values) (PresignOptions, error) {
+	opts := PresignOptions{
+		Content_type:        qs.Get("response-content-type"),
+		Content_disposition: qs.Get("response-content-disposition"),
+	}
+
+	expires, err := strconv.ParseInt(qs.Get("expires"), 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return opts, ErrInvalidSignature
+	}
+
+	expected := s.signature(key, expires, opts)
+	if !hmac.Equal([]byte(expected), []byte(qs.Get("signature"))) {
+		return opts, ErrInvalidSignature
+	}
+
+	return opts, nil
+}
+
+// serveBlob writes blob to the response, blobs are private so only links with valid signature are served.
+func serveBlob(w http.ResponseWriter, r *http.Request, s signer, open func(key string) (io.ReadSeekCloser, *ObjectInfo, error)) {
+	key, err := cleanKey(strings.TrimPrefix(r.URL.Path, "/"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	opts, err := s.verify(key, r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	blob, info, err := open(key)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrObjectNotFound):
+			http.NotFound(w, r)
+		default:
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		}
+		return
+	}
+	defer blob.Close()
+
+	if opts.Content_type == "" {
+		opts.Content_type = info.Content_type
+	}
+	if opts.Content_disposition == "" {
+		opts.Content_disposition = info.Content_disposition
+	}
+	if opts.Content_type != "" {
+		w.Header().Set("Content-Type", opts.Content_type)
+	}
+	if opts.Content_disposition != "" {
+		w.Header().Set("Content-Disposition", opts.Content_disposition)
+	}
+	w.Header().Set("Cache-Control", "private")
+
+	http.ServeContent(w, r, path.Base(key), info.Last_modified, blob)
+}
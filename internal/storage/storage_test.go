@@ -0,0 +1,267 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+var test_secret = strings.Repeat("s", MinSecretSize)
+
+func TestNewSigner(t *testing.T) {
+	tests := []struct {
+		name     string
+		secret   string
+		want_err error
+	}{
+		{name: "empty secret", secret: "", want_err: ErrWeakSecret},
+		{name: "short secret", secret: strings.Repeat("s", MinSecretSize-1), want_err: ErrWeakSecret},
+		{name: "minimal secret", secret: test_secret},
+		{name: "long secret", secret: strings.Repeat("s", 2*MinSecretSize)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newSigner("http://localhost/v1/storage", tt.secret)
+			if !errors.Is(err, tt.want_err) {
+				t.Fatalf("err = %v, want %v", err, tt.want_err)
+			}
+		})
+	}
+}
+
+func TestSignerVerify(t *testing.T) {
+	s, err := newSigner("http://localhost/v1/storage", test_secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := newSigner("http://localhost/v1/storage", strings.Repeat("o", MinSecretSize))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key := "users/1/document"
+	opts := PresignOptions{Content_type: "application/pdf", Content_disposition: `attachment; filename="contract.pdf"`}
+
+	query := func(link string) url.Values {
+		parsed, err := url.Parse(link)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parsed.Query()
+	}
+
+	tests := []struct {
+		name      string
+		key       string
+		qs        url.Values
+		tamper    func(qs url.Values)
+		want_err  error
+		want_opts PresignOptions
+	}{
+		{name: "valid link", key: key, qs: query(s.presign(key, time.Minute, PresignOptions{}))},
+		{name: "valid link with overrides", key: key, qs: query(s.presign(key, time.Minute, opts)), want_opts: opts},
+		{name: "other key", key: "users/1/other", qs: query(s.presign(key, time.Minute, PresignOptions{})), want_err: ErrInvalidSignature},
+		{name: "expired link", key: key, qs: query(s.presign(key, -time.Minute, PresignOptions{})), want_err: ErrInvalidSignature},
+		{name: "signed with other secret", key: key, qs: query(other.presign(key, time.Minute, PresignOptions{})), want_err: ErrInvalidSignature},
+		{
+			name: "extended expiry", key: key, qs: query(s.presign(key, time.Minute, PresignOptions{})), want_err: ErrInvalidSignature,
+			tamper: func(qs url.Values) {
+				qs.Set("expires", strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10))
+			},
+		},
+		{
+			name: "malformed expiry", key: key, qs: query(s.presign(key, time.Minute, PresignOptions{})), want_err: ErrInvalidSignature,
+			tamper: func(qs url.Values) {
+				qs.Set("expires", "never")
+			},
+		},
+		{
+			name: "added content type", key: key, qs: query(s.presign(key, time.Minute, PresignOptions{})), want_err: ErrInvalidSignature,
+			tamper: func(qs url.Values) {
+				qs.Set("response-content-type", "text/html")
+			},
+		},
+		{
+			name: "changed disposition", key: key, qs: query(s.presign(key, time.Minute, opts)), want_err: ErrInvalidSignature,
+			tamper: func(qs url.Values) {
+				qs.Set("response-content-disposition", "inline")
+			},
+		},
+		{
+			name: "changed signature", key: key, qs: query(s.presign(key, time.Minute, PresignOptions{})), want_err: ErrInvalidSignature,
+			tamper: func(qs url.Values) {
+				signature := []byte(qs.Get("signature"))
+				signature[0] ^= 1
+				qs.Set("signature", string(signature))
+			},
+		},
+		{
+			name: "missing signature", key: key, qs: query(s.presign(key, time.Minute, PresignOptions{})), want_err: ErrInvalidSignature,
+			tamper: func(qs url.Values) {
+				qs.Del("signature")
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.tamper != nil {
+				tt.tamper(tt.qs)
+			}
+
+			got, err := s.verify(tt.key, tt.qs)
+			if !errors.Is(err, tt.want_err) {
+				t.Fatalf("err = %v, want %v", err, tt.want_err)
+			}
+			if err == nil && got != tt.want_opts {
+				t.Fatalf("opts = %+v, want %+v", got, tt.want_opts)
+			}
+		})
+	}
+}
+
+func newTestMemoryStore(t *testing.T, objects map[string]string) *MemoryStore {
+	t.Helper()
+
+	m, err := NewMemoryStore("http://localhost/v1/storage", test_secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for key, content := range objects {
+		_, err = m.Put(context.Background(), key, strings.NewReader(content), PutOptions{Content_type: "text/plain"})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return m
+}
+
+func TestServeBlob(t *testing.T) {
+	key := "users/1/document"
+	m := newTestMemoryStore(t, map[string]string{key: "0123456789"})
+
+	link := func(key string) string {
+		location, err := m.PresignGet(context.Background(), key, time.Minute, PresignOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return strings.TrimPrefix(location, "http://localhost/v1/storage")
+	}
+
+	tests := []struct {
+		name         string
+		target       string
+		range_header string
+		want_status  int
+		want_body    string
+	}{
+		{name: "whole blob", target: link(key), want_status: http.StatusOK, want_body: "0123456789"},
+		{name: "range", target: link(key), range_header: "bytes=2-5", want_status: http.StatusPartialContent, want_body: "2345"},
+		{name: "suffix range", target: link(key), range_header: "bytes=-3", want_status: http.StatusPartialContent, want_body: "789"},
+		{name: "unsigned link", target: "/" + key, want_status: http.StatusForbidden},
+		{name: "link to other key", target: strings.Replace(link(key), "document", "other", 1), want_status: http.StatusForbidden},
+		{name: "missing blob", target: link("users/1/missing"), want_status: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			if tt.range_header != "" {
+				r.Header.Set("Range", tt.range_header)
+			}
+			w := httptest.NewRecorder()
+
+			m.ServeHTTP(w, r)
+
+			if w.Code != tt.want_status {
+				t.Fatalf("status = %d, want %d", w.Code, tt.want_status)
+			}
+			if tt.want_body != "" && w.Body.String() != tt.want_body {
+				t.Fatalf("body = %q, want %q", w.Body.String(), tt.want_body)
+			}
+		})
+	}
+}
+
+func TestRangeReader(t *testing.T) {
+	key := "users/1/document"
+	content := "0123456789"
+	m := newTestMemoryStore(t, map[string]string{key: content})
+
+	tests := []struct {
+		name   string
+		offset int64
+		whence int
+		length int64
+		want   string
+	}{
+		{name: "from start", offset: 0, whence: io.SeekStart, length: 4, want: "0123"},
+		{name: "from offset", offset: 6, whence: io.SeekStart, length: 10, want: "6789"},
+		{name: "from end", offset: -3, whence: io.SeekEnd, length: 10, want: "789"},
+		{name: "past end", offset: 12, whence: io.SeekStart, length: 10, want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRangeReader(context.Background(), m, key, int64(len(content)))
+			defer r.Close()
+
+			_, err := r.Seek(tt.offset, tt.whence)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := io.ReadAll(io.LimitReader(r, tt.length))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Fatalf("read %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("seek back after read", func(t *testing.T) {
+		r := NewRangeReader(context.Background(), m, key, int64(len(content)))
+		defer r.Close()
+
+		first := make([]byte, 5)
+		_, err := io.ReadFull(r, first)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = r.Seek(1, io.SeekStart)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		second := make([]byte, 3)
+		_, err = io.ReadFull(r, second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(first) != "01234" || string(second) != "123" {
+			t.Fatalf("read %q and %q", first, second)
+		}
+	})
+
+	t.Run("negative position", func(t *testing.T) {
+		r := NewRangeReader(context.Background(), m, key, int64(len(content)))
+
+		_, err := r.Seek(-1, io.SeekStart)
+		if err == nil {
+			t.Fatal("seek to negative position succeeded")
+		}
+	})
+}
@@ -0,0 +1,3 @@
+UPDATE documents
+SET filetype = '.pdf'
+WHERE filetype = 'application/pdf';
\ No newline at end of file
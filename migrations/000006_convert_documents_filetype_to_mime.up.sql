@@ -0,0 +1,3 @@
+UPDATE documents
+SET filetype = 'application/pdf'
+WHERE filetype = '.pdf';
\ No newline at end of file
@@ -0,0 +1,2 @@
+ALTER TABLE users
+ADD max_upload_size bigint;
\ No newline at end of file
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS uploads (
+    upload_id serial PRIMARY KEY,
+    user_id integer NOT NULL REFERENCES users ON DELETE CASCADE,
+    filename text NOT NULL,
+    filetype text NOT NULL DEFAULT '',
+    tags text[],
+    is_hidden boolean,
+    size bigint NOT NULL,
+    uploaded_size bigint NOT NULL DEFAULT 0,
+    storage_key text NOT NULL,
+    storage_upload_id text NOT NULL DEFAULT '',
+    part_etags text[] NOT NULL DEFAULT '{}',
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    updated_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS uploads_updated_at_index ON uploads (updated_at);
\ No newline at end of file
@@ -0,0 +1,2 @@
+ALTER TABLE documents
+ADD description text NOT NULL DEFAULT '';
\ No newline at end of file
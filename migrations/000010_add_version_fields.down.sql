@@ -0,0 +1,5 @@
+ALTER TABLE documents
+DROP COLUMN version;
+
+ALTER TABLE users
+DROP COLUMN version;
\ No newline at end of file
@@ -0,0 +1,5 @@
+ALTER TABLE documents
+ADD version integer NOT NULL DEFAULT 1;
+
+ALTER TABLE users
+ADD version integer NOT NULL DEFAULT 1;
\ No newline at end of file
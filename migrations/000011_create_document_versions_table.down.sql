@@ -0,0 +1,5 @@
+ALTER TABLE documents
+DROP COLUMN revised_at,
+DROP COLUMN current_version;
+
+DROP TABLE IF EXISTS document_versions;
\ No newline at end of file
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS document_versions (
+    document_id integer NOT NULL REFERENCES documents ON DELETE CASCADE,
+    version_number integer NOT NULL,
+    storage_key text NOT NULL,
+    filetype text NOT NULL,
+    uploaded_at timestamp(0) with time zone NOT NULL,
+    archived_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (document_id, version_number)
+);
+
+ALTER TABLE documents
+ADD current_version integer NOT NULL DEFAULT 1,
+ADD revised_at timestamp(0) with time zone NOT NULL DEFAULT NOW();
+
+UPDATE documents SET revised_at = uploaded_at WHERE uploaded_at IS NOT NULL;
\ No newline at end of file
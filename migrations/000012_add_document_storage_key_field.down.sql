@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS documents_storage_key_index;
+
+UPDATE documents
+SET title = users.username || '_' || documents.title
+FROM users
+WHERE users.user_id = documents.user_id;
+
+ALTER TABLE documents
+DROP COLUMN storage_key;
\ No newline at end of file
@@ -0,0 +1,18 @@
+ALTER TABLE documents
+ADD storage_key text;
+
+-- rows with duplicate titles were stored under the same object key, they keep pointing at that one object,
+-- rows without title get the key from path of their url, or a placeholder when they have neither
+UPDATE documents
+SET storage_key = COALESCE(title, NULLIF(regexp_replace(url_s3, '^[a-z]+://[^/]+/', ''), ''), 'legacy/' || document_id);
+
+UPDATE documents
+SET title = substr(documents.title, length(users.username) + 2)
+FROM users
+WHERE users.user_id = documents.user_id
+AND left(documents.title, length(users.username) + 1) = users.username || '_';
+
+ALTER TABLE documents
+ALTER COLUMN storage_key SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS documents_storage_key_index ON documents (storage_key);
\ No newline at end of file
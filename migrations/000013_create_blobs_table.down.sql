@@ -0,0 +1,12 @@
+ALTER TABLE uploads
+DROP COLUMN hash_state;
+
+ALTER TABLE document_versions
+DROP CONSTRAINT IF EXISTS document_versions_storage_key_fkey,
+DROP COLUMN checksum;
+
+ALTER TABLE documents
+DROP CONSTRAINT IF EXISTS documents_storage_key_fkey,
+DROP COLUMN checksum;
+
+DROP TABLE IF EXISTS blobs;
\ No newline at end of file
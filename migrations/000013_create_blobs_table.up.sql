@@ -0,0 +1,27 @@
+CREATE TABLE IF NOT EXISTS blobs (
+    storage_key text PRIMARY KEY,
+    checksum text UNIQUE,
+    location text NOT NULL,
+    ref_count integer NOT NULL DEFAULT 1,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+INSERT INTO blobs (storage_key, location, ref_count)
+SELECT storage_key, max(location), count(*)
+FROM (
+    SELECT documents.storage_key, COALESCE(documents.url_s3, '') AS location FROM documents
+    UNION ALL
+    SELECT document_versions.storage_key, '' AS location FROM document_versions
+) AS refs
+GROUP BY storage_key;
+
+ALTER TABLE documents
+ADD checksum text,
+ADD FOREIGN KEY (storage_key) REFERENCES blobs (storage_key);
+
+ALTER TABLE document_versions
+ADD checksum text,
+ADD FOREIGN KEY (storage_key) REFERENCES blobs (storage_key);
+
+ALTER TABLE uploads
+ADD hash_state bytea;
\ No newline at end of file
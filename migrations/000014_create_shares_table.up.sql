@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS shares (
+    share_id serial PRIMARY KEY,
+    document_id integer NOT NULL REFERENCES documents ON DELETE CASCADE,
+    user_id integer NOT NULL REFERENCES users ON DELETE CASCADE,
+    hash bytea NOT NULL UNIQUE,
+    expiry timestamp(0) with time zone,
+    max_downloads integer,
+    downloads integer NOT NULL DEFAULT 0,
+    password_hash bytea,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS shares_document_id_index ON shares (document_id);
\ No newline at end of file
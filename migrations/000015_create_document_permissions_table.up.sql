@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS document_permissions (
+    document_id integer NOT NULL REFERENCES documents ON DELETE CASCADE,
+    user_id integer NOT NULL REFERENCES users ON DELETE CASCADE,
+    role text NOT NULL CHECK (role IN ('read', 'edit')),
+    granted_by integer REFERENCES users ON DELETE SET NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (document_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS document_permissions_user_id_index ON document_permissions (user_id);
\ No newline at end of file
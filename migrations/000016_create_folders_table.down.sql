@@ -0,0 +1,2 @@
+ALTER TABLE documents DROP COLUMN IF EXISTS folder_id;
+DROP TABLE IF EXISTS folders;
\ No newline at end of file
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS folders (
+    folder_id serial PRIMARY KEY,
+    user_id integer NOT NULL REFERENCES users ON DELETE CASCADE,
+    parent_id integer REFERENCES folders ON DELETE CASCADE,
+    name text NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    version integer NOT NULL DEFAULT 1
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS folders_name_index ON folders (user_id, COALESCE(parent_id, 0), name);
+CREATE INDEX IF NOT EXISTS folders_parent_id_index ON folders (parent_id);
+
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS folder_id integer REFERENCES folders ON DELETE SET NULL;
+CREATE INDEX IF NOT EXISTS documents_folder_id_index ON documents (folder_id);
\ No newline at end of file
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS documents_deleted_at_index;
+ALTER TABLE documents DROP COLUMN IF EXISTS deleted_at;
\ No newline at end of file
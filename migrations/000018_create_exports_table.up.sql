@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS exports (
+    export_id serial PRIMARY KEY,
+    user_id integer NOT NULL,
+    storage_key text NOT NULL,
+    documents_count integer NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    expiry timestamp(0) with time zone NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS exports_expiry_index ON exports (expiry);
\ No newline at end of file
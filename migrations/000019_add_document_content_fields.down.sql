@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS documents_unindexed_index;
+DROP INDEX IF EXISTS documents_content_tsv_index;
+
+ALTER TABLE documents DROP COLUMN IF EXISTS content_tsv;
+ALTER TABLE documents DROP COLUMN IF EXISTS content;
\ No newline at end of file
@@ -0,0 +1,5 @@
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS content text;
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS content_tsv tsvector GENERATED ALWAYS AS (to_tsvector('simple', coalesce(content, ''))) STORED;
+
+CREATE INDEX IF NOT EXISTS documents_content_tsv_index ON documents USING GIN (content_tsv);
+CREATE INDEX IF NOT EXISTS documents_unindexed_index ON documents (document_id) WHERE content IS NULL;
\ No newline at end of file
@@ -0,0 +1,11 @@
+DROP INDEX IF EXISTS documents_uninspected_index;
+DROP INDEX IF EXISTS documents_page_count_index;
+DROP INDEX IF EXISTS documents_size_index;
+
+ALTER TABLE documents DROP COLUMN IF EXISTS is_encrypted;
+ALTER TABLE documents DROP COLUMN IF EXISTS pdf_created_at;
+ALTER TABLE documents DROP COLUMN IF EXISTS pdf_producer;
+ALTER TABLE documents DROP COLUMN IF EXISTS pdf_author;
+ALTER TABLE documents DROP COLUMN IF EXISTS pdf_title;
+ALTER TABLE documents DROP COLUMN IF EXISTS page_count;
+ALTER TABLE documents DROP COLUMN IF EXISTS size;
\ No newline at end of file
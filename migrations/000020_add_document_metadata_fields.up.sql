@@ -0,0 +1,11 @@
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS size bigint;
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS page_count integer;
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS pdf_title text;
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS pdf_author text;
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS pdf_producer text;
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS pdf_created_at timestamp(0) with time zone;
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS is_encrypted boolean NOT NULL DEFAULT false;
+
+CREATE INDEX IF NOT EXISTS documents_size_index ON documents (size);
+CREATE INDEX IF NOT EXISTS documents_page_count_index ON documents (page_count);
+CREATE INDEX IF NOT EXISTS documents_uninspected_index ON documents (document_id) WHERE size IS NULL;
\ No newline at end of file
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS document_jobs;
\ No newline at end of file
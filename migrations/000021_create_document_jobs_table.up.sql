@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS document_jobs (
+    job_id serial PRIMARY KEY,
+    user_id integer NOT NULL REFERENCES users ON DELETE CASCADE,
+    operation text NOT NULL,
+    status text NOT NULL DEFAULT 'pending',
+    document_ids integer[] NOT NULL,
+    pages text[] NOT NULL DEFAULT '{}',
+    title text NOT NULL DEFAULT '',
+    result_ids integer[] NOT NULL DEFAULT '{}',
+    error text NOT NULL DEFAULT '',
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    finished_at timestamp(0) with time zone
+);
+
+CREATE INDEX IF NOT EXISTS document_jobs_finished_at_index ON document_jobs (finished_at);
\ No newline at end of file
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS documents_unpreviewed_index;
+
+ALTER TABLE documents DROP COLUMN IF EXISTS preview_key;
\ No newline at end of file
@@ -0,0 +1,3 @@
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS preview_key text;
+
+CREATE INDEX IF NOT EXISTS documents_unpreviewed_index ON documents (document_id) WHERE preview_key IS NULL;
\ No newline at end of file
@@ -0,0 +1,2 @@
+ALTER TABLE shares DROP COLUMN IF EXISTS watermark;
+ALTER TABLE documents DROP COLUMN IF EXISTS watermark;
\ No newline at end of file
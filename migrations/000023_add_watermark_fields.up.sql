@@ -0,0 +1,2 @@
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS watermark jsonb;
+ALTER TABLE shares ADD COLUMN IF NOT EXISTS watermark jsonb;
\ No newline at end of file
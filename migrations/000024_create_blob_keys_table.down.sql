@@ -0,0 +1 @@
+DROP TABLE IF EXISTS blob_keys;
\ No newline at end of file
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS blob_keys (
+    storage_key text PRIMARY KEY,
+    wrapped_key bytea NOT NULL,
+    key_id text NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS blob_keys_key_id_index ON blob_keys (key_id);
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE uploads DROP COLUMN IF EXISTS leased_until;
\ No newline at end of file
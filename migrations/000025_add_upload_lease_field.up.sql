@@ -0,0 +1 @@
+ALTER TABLE uploads ADD COLUMN IF NOT EXISTS leased_until timestamp with time zone;
\ No newline at end of file
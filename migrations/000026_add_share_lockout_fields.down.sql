@@ -0,0 +1,2 @@
+ALTER TABLE shares DROP COLUMN IF EXISTS locked_until;
+ALTER TABLE shares DROP COLUMN IF EXISTS failed_attempts;
\ No newline at end of file
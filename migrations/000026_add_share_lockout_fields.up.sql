@@ -0,0 +1,2 @@
+ALTER TABLE shares ADD COLUMN IF NOT EXISTS failed_attempts integer NOT NULL DEFAULT 0;
+ALTER TABLE shares ADD COLUMN IF NOT EXISTS locked_until timestamp with time zone;
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE exports DROP COLUMN IF EXISTS hash;
\ No newline at end of file
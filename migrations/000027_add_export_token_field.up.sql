@@ -0,0 +1 @@
+ALTER TABLE exports ADD COLUMN IF NOT EXISTS hash bytea UNIQUE;
\ No newline at end of file
@@ -3,6 +3,7 @@ package utils
 import (
 	"fmt"
 	"net/http"
+	"strconv"
 
 	"github.com/charmbracelet/log"
 )
@@ -50,6 +51,37 @@ func EditConflictResponse(w http.ResponseWriter, r *http.Request) {
 	errorResponse(w, r, http.StatusConflict, message)
 }
 
+func UnsupportedFiletypeResponse(w http.ResponseWriter, r *http.Request, filetype string) {
+	message := fmt.Sprintf("unsupported file type: %s", filetype)
+	errorResponse(w, r, http.StatusUnsupportedMediaType, message)
+}
+
+func FileTooLargeResponse(w http.ResponseWriter, r *http.Request, limit int64) {
+	message := fmt.Sprintf("the uploaded file exceeds the maximum allowed size of %d bytes", limit)
+	errorResponse(w, r, http.StatusRequestEntityTooLarge, message)
+}
+
+func UploadOffsetConflictResponse(w http.ResponseWriter, r *http.Request, offset int64) {
+	w.Header().Set("Upload-Offset", strconv.FormatInt(offset, 10))
+	message := fmt.Sprintf("upload offset mismatch, next chunk must start at byte %d", offset)
+	errorResponse(w, r, http.StatusConflict, message)
+}
+
+func FolderNotEmptyResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the folder is not empty, use recursive=true to delete it with its contents"
+	errorResponse(w, r, http.StatusConflict, message)
+}
+
+func WatermarkUnavailableResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the document can only be downloaded with a watermark, which can't be applied to its file"
+	errorResponse(w, r, http.StatusConflict, message)
+}
+
+func PreconditionFailedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the resource was modified since it was last fetched, fetch it again and retry"
+	errorResponse(w, r, http.StatusPreconditionFailed, message)
+}
+
 func MethodNotAllowedResponse(w http.ResponseWriter, r *http.Request) {
 	message := fmt.Sprintf("the %s method is not supported for this resource", r.Method)
 	errorResponse(w, r, http.StatusMethodNotAllowed, message)
@@ -0,0 +1,74 @@
+package utils
+
+import (
+	"bytes"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	FiletypePDF      = "application/pdf"
+	FiletypeText     = "text/plain"
+	FiletypeMarkdown = "text/markdown"
+	FiletypeRTF      = "application/rtf"
+	FiletypeDOCX     = "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
+)
+
+var DefaultAllowedFiletypes = []string{FiletypePDF, FiletypeText, FiletypeMarkdown, FiletypeRTF, FiletypeDOCX}
+
+// DetectFiletype sniffs MIME type from file's first bytes, extension is only used to narrow down
+// generic types (zip, plain text) and can never change what the content itself looks like.
+func DetectFiletype(head []byte, filename string) string {
+	sniffed, _, err := mime.ParseMediaType(http.DetectContentType(head))
+	if err != nil {
+		return "application/octet-stream"
+	}
+
+	extension := strings.ToLower(filepath.Ext(filename))
+
+	switch {
+	case sniffed == "application/zip" && extension == ".docx":
+		return FiletypeDOCX
+	case sniffed == FiletypeText && bytes.HasPrefix(head, []byte(`{\rtf`)):
+		return FiletypeRTF
+	case sniffed == FiletypeText && (extension == ".md" || extension == ".markdown"):
+		return FiletypeMarkdown
+	}
+
+	return sniffed
+}
+
+func IsFiletypeAllowed(filetype string, allowed []string) bool {
+	for _, allowed_filetype := range allowed {
+		if filetype == allowed_filetype {
+			return true
+		}
+	}
+
+	return false
+}
+
+// FiletypeExtension returns file extension (with leading dot) for MIME type, empty when none is known.
+func FiletypeExtension(filetype string) string {
+	switch filetype {
+	case FiletypePDF:
+		return ".pdf"
+	case FiletypeText:
+		return ".txt"
+	case FiletypeMarkdown:
+		return ".md"
+	case FiletypeRTF:
+		return ".rtf"
+	case FiletypeDOCX:
+		return ".docx"
+	}
+
+	extensions, err := mime.ExtensionsByType(filetype)
+	if err != nil || len(extensions) == 0 {
+		return ""
+	}
+
+	return extensions[0]
+}
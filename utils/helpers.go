@@ -1,10 +1,10 @@
 package utils
 
 import (
-	"bytes"
 	"encoding/json"
 	"errors"
-	"mime/multipart"
+	"fmt"
+	"io"
 	"net/http"
 	"net/url"
 	"strconv"
@@ -68,35 +68,84 @@ func ReadJSON(w http.ResponseWriter, r *http.Request, source interface{}) error
 	return nil
 }
 
-func ReadMultipartJSON(w http.ResponseWriter, r *http.Request, source interface{}) (multipart.File, *multipart.FileHeader, error) {
-	err := r.ParseMultipartForm(32 << 20)
-	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		return nil, nil, err
+var (
+	ErrFileTooLarge = errors.New("file exceeds maximum upload size")
+)
+
+// sizeLimitedReader fails with ErrFileTooLarge as soon as more than limit bytes were read.
+type sizeLimitedReader struct {
+	reader io.Reader
+	limit  int64
+	read   int64
+}
+
+func (l *sizeLimitedReader) Read(p []byte) (int, error) {
+	n, err := l.reader.Read(p)
+	l.read += int64(n)
+	if l.read > l.limit {
+		return n, ErrFileTooLarge
 	}
 
-	metadata := r.FormValue("metadata")
-	b := bytes.NewBufferString(metadata)
+	return n, err
+}
 
-	decoder := json.NewDecoder(b)
-	decoder.DisallowUnknownFields()
+// ReadMultipartStream decodes metadata part into source and returns document part without buffering it,
+// metadata is optional but has to be sent before the document.
+func ReadMultipartStream(w http.ResponseWriter, r *http.Request, source interface{}, maxFileSize int64) (io.Reader, string, error) {
+	metadataLimit := int64(1048576)
+	r.Body = http.MaxBytesReader(w, r.Body, maxFileSize+metadataLimit)
 
-	err = decoder.Decode(source)
+	reader, err := r.MultipartReader()
 	if err != nil {
-		return nil, nil, err
+		return nil, "", err
 	}
 
-	file, file_data, err := r.FormFile("document")
+	part, err := reader.NextPart()
 	if err != nil {
-		return nil, nil, err
+		return nil, "", err
+	}
+	if part.FormName() == "metadata" {
+		decoder := json.NewDecoder(io.LimitReader(part, metadataLimit))
+		decoder.DisallowUnknownFields()
+
+		err = decoder.Decode(source)
+		if err != nil {
+			return nil, "", err
+		}
+
+		part, err = reader.NextPart()
+		if err != nil {
+			return nil, "", err
+		}
+	}
+	if part.FormName() != "document" {
+		return nil, "", errors.New("missing document part, metadata part must be sent before it")
+	}
+
+	return &sizeLimitedReader{reader: part, limit: maxFileSize}, part.FileName(), nil
+}
+
+func VersionETag(version int) string {
+	return fmt.Sprintf(`"%d"`, version)
+}
+
+// IfMatch reports whether If-Match header allows modifying resource with given ETag, missing header always matches.
+func IfMatch(r *http.Request, etag string) bool {
+	values := r.Header.Values("If-Match")
+	if len(values) == 0 {
+		return true
 	}
 
-	extension := file_data.Filename[len(file_data.Filename)-4:]
-	if extension != ".pdf" {
-		return nil, nil, errors.New("invalid file format, for now Viadro only accepts PDF files")
+	for _, value := range values {
+		for _, candidate := range strings.Split(value, ",") {
+			candidate = strings.TrimSpace(candidate)
+			if candidate == "*" || candidate == etag {
+				return true
+			}
+		}
 	}
 
-	return file, file_data, nil
+	return false
 }
 
 func ReadIDParam(r *http.Request) (int, error) {
@@ -108,6 +157,16 @@ func ReadIDParam(r *http.Request) (int, error) {
 	return int(id), nil
 }
 
+// ReadNamedIDParam reads positive integer route parameter other than the resource's id, e.g. revision number.
+func ReadNamedIDParam(r *http.Request, name string) (int, error) {
+	params := httprouter.ParamsFromContext(r.Context())
+	id, err := strconv.ParseInt(params.ByName(name), 10, 64)
+	if err != nil || id < 1 {
+		return 0, fmt.Errorf("invalid %s parameter", name)
+	}
+	return int(id), nil
+}
+
 func ReadStringParam(qs url.Values, key string, defaultValue string) string {
 	s := qs.Get(key)
 	if s == "" {
@@ -140,6 +199,38 @@ func ReadIntParam(qs url.Values, key string, defaultValue int) int {
 	return i
 }
 
+// ReadOptionalIntParam reads number used as optional filter, nil is returned when key is missing and
+// ok is false when its value isn't a number.
+func ReadOptionalIntParam(qs url.Values, key string) (*int64, bool) {
+	s := qs.Get(key)
+	if s == "" {
+		return nil, true
+	}
+
+	i, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return nil, false
+	}
+
+	return &i, true
+}
+
+// ReadOptionalBoolParam reads boolean used as optional filter, nil is returned when key is missing and
+// ok is false when its value isn't a boolean.
+func ReadOptionalBoolParam(qs url.Values, key string) (*bool, bool) {
+	s := qs.Get(key)
+	if s == "" {
+		return nil, true
+	}
+
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		return nil, false
+	}
+
+	return &b, true
+}
+
 func CacheSave() {
 
 }